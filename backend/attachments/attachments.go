@@ -0,0 +1,264 @@
+// attachments/attachments.go
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/harip/GoTasker/blobstore"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// collectBatchSize bounds how many blobs one Collect call removes.
+const collectBatchSize = 100
+
+var (
+	// ErrTooLarge is returned by Save for a file over the size limit.
+	ErrTooLarge = errors.New("file exceeds the attachment size limit")
+	// ErrQuotaExceeded is returned by Save when the file would take the
+	// user over their storage quota.
+	ErrQuotaExceeded = errors.New("attachment storage quota exceeded")
+	// ErrNotInitialized is returned while no blob store is configured.
+	ErrNotInitialized = errors.New("attachments are not initialized")
+)
+
+// Limits bounds the size of a single file and the total size of a user's
+// attachments, in bytes.
+type Limits struct {
+	MaxFileSize int64
+	UserQuota   int64
+}
+
+var (
+	mu     sync.RWMutex
+	db     *gorm.DB
+	store  blobstore.BlobStore
+	limits Limits
+)
+
+// Init sets the database, where file contents are kept and the limits
+// uploads are held to.
+func Init(database *gorm.DB, blobs blobstore.BlobStore, l Limits) {
+	mu.Lock()
+	db, store, limits = database, blobs, l
+	mu.Unlock()
+}
+
+// CurrentLimits returns the limits set by Init.
+func CurrentLimits() Limits {
+	mu.RLock()
+	defer mu.RUnlock()
+	return limits
+}
+
+func state() (*gorm.DB, blobstore.BlobStore, Limits, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	if db == nil || store == nil {
+		return nil, nil, limits, ErrNotInitialized
+	}
+	return db, store, limits, nil
+}
+
+// Usage returns how many bytes of attachments userID has. Attachments are
+// deleted along with their task, so every one still stored counts.
+func Usage(userID uint) (int64, error) {
+	database, _, _, err := state()
+	if err != nil {
+		return 0, err
+	}
+	var used int64
+	err = database.Model(&models.Attachment{}).Where("user_id = ?", userID).
+		Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	return used, err
+}
+
+// CleanFilename reduces a client-supplied file name to a safe base name.
+func CleanFilename(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	if name == "" || name == "." || name == "/" {
+		name = "attachment"
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[len(runes)-255:])
+	}
+	return name
+}
+
+// Save stores content as an attachment of task. The content is spooled to
+// a temporary file while its size is checked and its SHA-256 computed;
+// if a blob with that hash already exists it is reused instead of being
+// stored again. The content type is sniffed from the data, not taken from
+// the client.
+func Save(ctx context.Context, task models.Task, userID uint, filename string, content io.Reader) (models.Attachment, error) {
+	attachment := models.Attachment{TaskID: task.ID, UserID: userID, Filename: CleanFilename(filename)}
+	database, blobs, l, err := state()
+	if err != nil {
+		return attachment, err
+	}
+
+	tmp, err := os.CreateTemp("", "gotasker-upload-*")
+	if err != nil {
+		return attachment, err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hash), io.LimitReader(content, l.MaxFileSize+1))
+	if err != nil {
+		return attachment, err
+	}
+	if size > l.MaxFileSize {
+		return attachment, ErrTooLarge
+	}
+	used, err := Usage(userID)
+	if err != nil {
+		return attachment, err
+	}
+	if used+size > l.UserQuota {
+		return attachment, ErrQuotaExceeded
+	}
+
+	head := make([]byte, 512)
+	n, _ := tmp.ReadAt(head, 0)
+	attachment.ContentType = http.DetectContentType(head[:n])
+	attachment.Size = size
+	attachment.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if err := ensureBlob(ctx, database, blobs, attachment.SHA256, tmp, size); err != nil {
+		return attachment, err
+	}
+	attachment.CreatedAt = time.Now()
+	if err := database.Create(&attachment).Error; err != nil {
+		return attachment, err
+	}
+	return attachment, nil
+}
+
+// ensureBlob makes sure the content with hash sum is stored, uploading it
+// from content unless an existing blob can be reused.
+func ensureBlob(ctx context.Context, database *gorm.DB, blobs blobstore.BlobStore, sum string, content io.ReadSeeker, size int64) error {
+	now := time.Now()
+	// Bumping LastUsedAt both finds a reusable blob and keeps the collector
+	// from removing it before the attachment row refers to it
+	result := database.Model(&models.Blob{}).Where("sha256 = ?", sum).Update("last_used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Reusing stored blob %s", sum)
+		return nil
+	}
+
+	// Each upload gets its own key, so a collector removing an earlier
+	// blob with the same content can never remove this one
+	suffix, err := secure.RandomToken(8)
+	if err != nil {
+		return err
+	}
+	key := sum + "-" + suffix
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := blobs.Put(ctx, key, content, size); err != nil {
+		return err
+	}
+
+	blob := models.Blob{SHA256: sum, StorageKey: key, Size: size, CreatedAt: now, LastUsedAt: now}
+	result = database.Clauses(clause.OnConflict{DoNothing: true}).Create(&blob)
+	if result.Error == nil && result.RowsAffected == 0 {
+		// A concurrent upload of the same content won; use its blob
+		if err := blobs.Delete(ctx, key); err != nil {
+			log.Printf("Error removing duplicate blob %s: %v", key, err)
+		}
+		return database.Model(&models.Blob{}).Where("sha256 = ?", sum).Update("last_used_at", now).Error
+	}
+	return result.Error
+}
+
+// Open returns the content of attachment for reading and seeking.
+func Open(ctx context.Context, attachment models.Attachment) (*blobstore.Reader, error) {
+	database, blobs, _, err := state()
+	if err != nil {
+		return nil, err
+	}
+	var blob models.Blob
+	if err := database.Where("sha256 = ?", attachment.SHA256).First(&blob).Error; err != nil {
+		return nil, err
+	}
+	return blobstore.NewReader(ctx, blobs, blob.StorageKey, blob.Size), nil
+}
+
+// Collect removes blobs that no attachment refers to and that no upload
+// has used since before, and returns how many were removed.
+func Collect(ctx context.Context, before time.Time) (int, error) {
+	database, blobs, _, err := state()
+	if err == ErrNotInitialized {
+		return 0, nil
+	}
+	const unreferenced = "last_used_at < ? AND NOT EXISTS (SELECT 1 FROM attachments WHERE attachments.sha256 = blobs.sha256)"
+
+	var candidates []models.Blob
+	if err := database.Where(unreferenced, before).Limit(collectBatchSize).Find(&candidates).Error; err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, blob := range candidates {
+		// Deleting the row first, with the condition checked again, stops a
+		// concurrent upload from picking up a blob that is going away
+		result := database.Where("sha256 = ? AND storage_key = ? AND "+unreferenced, blob.SHA256, blob.StorageKey, before).Delete(&models.Blob{})
+		if result.Error != nil {
+			return removed, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		if err := blobs.Delete(ctx, blob.StorageKey); err != nil {
+			log.Printf("Error deleting blob %s from storage: %v", blob.StorageKey, err)
+			continue
+		}
+		removed++
+	}
+	if removed > 0 {
+		log.Printf("Removed %d unreferenced attachment blobs", removed)
+	}
+	return removed, nil
+}
+
+// Start runs Collect in the background at the given interval, removing
+// blobs unreferenced for longer than grace.
+func Start(interval, grace time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := Collect(context.Background(), time.Now().Add(-grace)); err != nil {
+				log.Printf("Error collecting attachment blobs: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,81 @@
+// audit/audit.go
+package audit
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/harip/GoTasker/clientip"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+// Event names.
+const (
+	LoginSucceeded  = "login.succeeded"
+	LoginFailed     = "login.failed"
+	LoginThrottled  = "login.throttled"
+	MFAFailed       = "login.mfa_failed"
+	AccountLocked   = "account.locked"
+	AccountUnlocked = "account.unlocked"
+	IdentityLinked  = "account.identity_linked"
+	UserProvisioned = "account.provisioned"
+	ProfileUpdated  = "account.profile_updated"
+	PasswordChanged = "account.password_changed"
+	AccountDeleted  = "account.deleted"
+	DataExported    = "account.data_exported"
+	SessionRevoked  = "account.session_revoked"
+
+	AdminUserDisabled  = "admin.user_disabled"
+	AdminUserEnabled   = "admin.user_enabled"
+	AdminUserDeleted   = "admin.user_deleted"
+	AdminRoleChanged   = "admin.role_changed"
+	AdminPasswordReset = "admin.password_reset_sent"
+	AdminImpersonated  = "admin.impersonation_started"
+	ImpersonatedAction = "admin.impersonated_request"
+)
+
+const maxUserAgentLength = 255
+
+var (
+	mu sync.RWMutex
+	db *gorm.DB
+)
+
+// Init sets the database events are written to. Until it is called events
+// are only logged.
+func Init(database *gorm.DB) {
+	mu.Lock()
+	db = database
+	mu.Unlock()
+}
+
+// Record stores event for userID (0 if unknown) with the request's client
+// address. Failures are logged rather than returned so auditing never
+// breaks the request being audited.
+func Record(r *http.Request, event string, userID uint, detail string) {
+	record := models.AuditEvent{
+		Event:     event,
+		IP:        clientip.FromRequest(r),
+		UserAgent: r.UserAgent(),
+		Detail:    detail,
+	}
+	if len(record.UserAgent) > maxUserAgentLength {
+		record.UserAgent = record.UserAgent[:maxUserAgentLength]
+	}
+	if userID != 0 {
+		record.UserID = &userID
+	}
+	log.Printf("Audit: %s user_id=%d ip=%s %s", event, userID, record.IP, detail)
+
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return
+	}
+	if err := database.Create(&record).Error; err != nil {
+		log.Printf("Error writing audit event %s: %v", event, err)
+	}
+}
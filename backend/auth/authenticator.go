@@ -0,0 +1,49 @@
+// auth/authenticator.go
+package auth
+
+import (
+	"errors"
+	"net/http"
+)
+
+// ErrNoCredentials is returned by an Authenticator when the request carries
+// no credential it understands, so the next one in the chain should try.
+var ErrNoCredentials = errors.New("no credentials")
+
+// Error rejects a request that presented a credential which is invalid.
+// Message is safe to show to the client.
+type Error struct {
+	Status  int
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Unauthorized returns a 401 Error with message.
+func Unauthorized(message string) *Error {
+	return &Error{Status: http.StatusUnauthorized, Message: message}
+}
+
+// Authenticator turns the credential on a request into a Principal.
+type Authenticator interface {
+	// Authenticate returns the caller of r, ErrNoCredentials if r carries
+	// no credential of this kind, or an *Error if the credential is bad.
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn and uses the first that finds a
+// credential. A bad credential stops the chain rather than falling through.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
@@ -0,0 +1,92 @@
+// auth/principal.go
+package auth
+
+import (
+	"context"
+	"time"
+)
+
+// Ways a principal can authenticate.
+const (
+	MethodJWT     = "jwt"
+	MethodAPIKey  = "api_key"
+	MethodSession = "session"
+)
+
+// Principal is the authenticated caller of a request.
+type Principal struct {
+	UserID   uint
+	Username string
+	Roles    []string
+	// Scopes limits what the credential may be used for. Nil means it
+	// carries the user's full authority, as a login does.
+	Scopes []string
+	// TokenID identifies the credential, such as a JWT's jti, so it can be
+	// revoked on its own.
+	TokenID string
+	// SessionID is the login session the credential belongs to, or 0 for
+	// credentials outside a session such as API keys.
+	SessionID uint
+	ExpiresAt time.Time
+	Method    string
+	// Actor is the admin acting as the user when the credential is an
+	// impersonation token, or nil when the user is acting themselves.
+	Actor *Actor
+}
+
+// Actor identifies the party acting on a user's behalf, as carried in the
+// act claim of RFC 8693.
+type Actor struct {
+	UserID   uint
+	Username string
+}
+
+// Impersonated reports whether someone other than the user is acting.
+func (p *Principal) Impersonated() bool {
+	return p.Actor != nil
+}
+
+// HasRole reports whether the principal holds role.
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the credential may be used for scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p.Scopes == nil {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored by NewContext, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok && p != nil
+}
+
+// UserID returns the authenticated user's ID from ctx.
+func UserID(ctx context.Context) (uint, bool) {
+	p, ok := FromContext(ctx)
+	if !ok {
+		return 0, false
+	}
+	return p.UserID, true
+}
@@ -0,0 +1,98 @@
+// blobstore/blobstore.go
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"regexp"
+)
+
+// ErrNotFound is returned by Get for a key that holds no blob.
+var ErrNotFound = errors.New("blob not found")
+
+// ErrInvalidKey is returned for keys that are not safe to store under.
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// BlobStore keeps opaque blobs under string keys. Implementations must be
+// safe for concurrent use.
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any blob
+	// already there.
+	Put(ctx context.Context, key string, r io.Reader, size int64) error
+	// Get reads length bytes of the blob starting at offset, or everything
+	// from offset on if length is negative.
+	Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	// Delete removes the blob. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// Keys are limited to characters that are safe both as file names and in
+// URLs, so no implementation has to escape them.
+var validKey = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{1,127}$`)
+
+func checkKey(key string) error {
+	if !validKey.MatchString(key) {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// Reader reads a blob of known size through ranged Gets, so it can be
+// handed to http.ServeContent to answer range requests without fetching
+// the whole blob. A Get is only made once reading starts at an offset.
+type Reader struct {
+	ctx    context.Context
+	store  BlobStore
+	key    string
+	size   int64
+	offset int64
+	body   io.ReadCloser
+}
+
+func NewReader(ctx context.Context, store BlobStore, key string, size int64) *Reader {
+	return &Reader{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.Get(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("blobstore: negative position")
+	}
+	if offset != r.offset && r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *Reader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,98 @@
+// blobstore/local.go
+package blobstore
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore keeps blobs as files below Dir, spread over subdirectories
+// named after the first two characters of their keys.
+type LocalStore struct {
+	Dir string
+}
+
+func NewLocalStore(dir string) (*LocalStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &LocalStore{Dir: dir}, nil
+}
+
+func (s *LocalStore) path(key string) string {
+	return filepath.Join(s.Dir, key[:2], key)
+}
+
+// Put writes to a temporary file first and renames it into place, so a
+// blob is never seen half written.
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, size int64) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	path := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(r, size))
+	if err == nil && written != size {
+		err = io.ErrUnexpectedEOF
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// limitedFile reads part of a file and closes the whole of it.
+type limitedFile struct {
+	r io.Reader
+	f *os.File
+}
+
+func (l limitedFile) Read(p []byte) (int, error) { return l.r.Read(p) }
+func (l limitedFile) Close() error               { return l.f.Close() }
+
+func (s *LocalStore) Get(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return limitedFile{r: io.LimitReader(f, length), f: f}, nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
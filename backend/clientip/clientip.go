@@ -0,0 +1,37 @@
+// clientip/clientip.go
+package clientip
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+var trustProxy atomic.Bool
+
+// SetTrustProxy controls whether X-Forwarded-For is believed. Only enable it
+// when the server is reachable solely through a proxy that sets the header,
+// otherwise clients can claim any address.
+func SetTrustProxy(trust bool) {
+	trustProxy.Store(trust)
+}
+
+// FromRequest returns the client's IP address without the port.
+func FromRequest(r *http.Request) string {
+	if trustProxy.Load() {
+		// The proxy appends the address it saw, so the last entry is the
+		// only one not supplied by the client.
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			parts := strings.Split(forwarded, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,75 @@
+// Command export writes a user's personal data archive to a file, for
+// answering data-subject requests without going through the API:
+//
+//	go run ./cmd/export -username alice -out alice.zip
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/dataexport"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func main() {
+	userID := flag.Uint("user-id", 0, "ID of the user to export")
+	username := flag.String("username", "", "username of the user to export")
+	out := flag.String("out", "", "file to write (default gotasker-export-<username>.zip)")
+	flag.Parse()
+	if (*userID == 0) == (*username == "") {
+		fmt.Fprintln(os.Stderr, "export: exactly one of -user-id or -username is required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	config.LoadConfig()
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+		config.AppConfig.DBHost,
+		config.AppConfig.DBUser,
+		config.AppConfig.DBPassword,
+		config.AppConfig.DBName,
+		config.AppConfig.DBPort,
+	)
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+
+	// Deleted accounts awaiting purge can still be exported
+	var user models.User
+	query := db.Unscoped()
+	if *username != "" {
+		err = query.Where("username = ?", *username).First(&user).Error
+	} else {
+		err = query.First(&user, *userID).Error
+	}
+	if err != nil {
+		log.Fatalf("User not found: %v", err)
+	}
+
+	path := *out
+	if path == "" {
+		path = fmt.Sprintf("gotasker-export-%s.zip", user.Username)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		log.Fatalf("Failed to create %s: %v", path, err)
+	}
+	if err := dataexport.Write(db, user.ID, f); err != nil {
+		f.Close()
+		os.Remove(path)
+		log.Fatalf("Failed to export user_id %d: %v", user.ID, err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatalf("Failed to write %s: %v", path, err)
+	}
+	log.Printf("Wrote data export for %s (user_id %d) to %s", user.Username, user.ID, path)
+}
@@ -3,17 +3,73 @@ package config
 import (
 	"log"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	JWTSecret  string
-	DBHost     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBPort     string
+	JWTSecret             string
+	DBHost                string
+	DBUser                string
+	DBPassword            string
+	DBName                string
+	DBPort                string
+	PasswordHashAlgorithm string
+	AccessTokenTTL        time.Duration
+	RefreshTokenTTL       time.Duration
+	JWTSigningAlgorithm   string
+	JWTKeyRotation        time.Duration
+	AppBaseURL            string
+	MailDriver            string
+	MailFrom              string
+	MailLogPath           string
+	SMTPHost              string
+	SMTPPort              string
+	SMTPUsername          string
+	SMTPPassword          string
+	PasswordResetTTL      time.Duration
+	EmailVerificationTTL  time.Duration
+	MFATokenTTL           time.Duration
+	TOTPIssuer            string
+	LoginMaxFailures      int
+	LoginMaxFailuresPerIP int
+	LoginBackoffAfter     int
+	LoginBackoffBase      time.Duration
+	LoginBackoffMax       time.Duration
+	LoginLockoutDuration  time.Duration
+	LoginFailureWindow    time.Duration
+	AccountUnlockTTL      time.Duration
+	TrustProxyHeaders     bool
+	OIDCIssuerURL         string
+	OIDCClientID          string
+	OIDCClientSecret      string
+	OIDCRedirectURL       string
+	OIDCScopes            string
+	OIDCAutoProvision     bool
+	AdminUsernames        string
+	AccountPurgeGrace     time.Duration
+	APIBaseURL            string
+	ExportDir             string
+	ExportTTL             time.Duration
+	CORSAllowedOrigins    string
+	SessionTTL            time.Duration
+	SessionCookieSecure   bool
+	SessionCookieSameSite string
+	SessionCookieDomain   string
+	WebhookSecret         string
+	WebhookAllowPrivate   bool
+	BlobDriver            string
+	BlobDir               string
+	S3Endpoint            string
+	S3Region              string
+	S3Bucket              string
+	S3AccessKey           string
+	S3SecretKey           string
+	AttachmentMaxSize     int
+	AttachmentUserQuota   int
 }
 
 var AppConfig *Config
@@ -25,12 +81,65 @@ func LoadConfig() {
 	}
 
 	AppConfig = &Config{
-		JWTSecret:  getEnv("JWT_SECRET", "mysecretkey123"),
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", ""),
-		DBName:     getEnv("DB_NAME", "gotasker"),
-		DBPort:     getEnv("DB_PORT", "5432"),
+		JWTSecret:             getEnv("JWT_SECRET", ""),
+		DBHost:                getEnv("DB_HOST", "localhost"),
+		DBUser:                getEnv("DB_USER", "postgres"),
+		DBPassword:            getEnv("DB_PASSWORD", ""),
+		DBName:                getEnv("DB_NAME", "gotasker"),
+		DBPort:                getEnv("DB_PORT", "5432"),
+		PasswordHashAlgorithm: getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		AccessTokenTTL:        getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:       getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		JWTSigningAlgorithm:   getEnv("JWT_SIGNING_ALGORITHM", "HS256"),
+		JWTKeyRotation:        getEnvDuration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		AppBaseURL:            getEnv("APP_BASE_URL", "http://localhost:3000"),
+		MailDriver:            getEnv("MAIL_DRIVER", "log"),
+		MailFrom:              getEnv("MAIL_FROM", "GoTasker <no-reply@gotasker.local>"),
+		MailLogPath:           getEnv("MAIL_LOG_PATH", ""),
+		SMTPHost:              getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:              getEnv("SMTP_PORT", "1025"),
+		SMTPUsername:          getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:          getEnv("SMTP_PASSWORD", ""),
+		PasswordResetTTL:      getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL:  getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		MFATokenTTL:           getEnvDuration("MFA_TOKEN_TTL", 5*time.Minute),
+		TOTPIssuer:            getEnv("TOTP_ISSUER", "GoTasker"),
+		LoginMaxFailures:      getEnvInt("LOGIN_MAX_FAILURES", 10),
+		LoginMaxFailuresPerIP: getEnvInt("LOGIN_MAX_FAILURES_PER_IP", 100),
+		LoginBackoffAfter:     getEnvInt("LOGIN_BACKOFF_AFTER", 3),
+		LoginBackoffBase:      getEnvDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:       getEnvDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		LoginLockoutDuration:  getEnvDuration("LOGIN_LOCKOUT_DURATION", 30*time.Minute),
+		LoginFailureWindow:    getEnvDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		AccountUnlockTTL:      getEnvDuration("ACCOUNT_UNLOCK_TTL", 24*time.Hour),
+		TrustProxyHeaders:     getEnvBool("TRUST_PROXY_HEADERS", false),
+		OIDCIssuerURL:         getEnv("OIDC_ISSUER_URL", ""),
+		OIDCClientID:          getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret:      getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:       getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/auth/oidc/callback"),
+		OIDCScopes:            getEnv("OIDC_SCOPES", "openid email profile"),
+		OIDCAutoProvision:     getEnvBool("OIDC_AUTO_PROVISION", true),
+		AdminUsernames:        getEnv("ADMIN_USERNAMES", ""),
+		AccountPurgeGrace:     getEnvDuration("ACCOUNT_PURGE_GRACE", 30*24*time.Hour),
+		APIBaseURL:            getEnv("API_BASE_URL", "http://localhost:8080"),
+		ExportDir:             getEnv("EXPORT_DIR", filepath.Join(os.TempDir(), "gotasker-exports")),
+		ExportTTL:             getEnvDuration("EXPORT_TTL", 24*time.Hour),
+		CORSAllowedOrigins:    getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000"),
+		SessionTTL:            getEnvDuration("SESSION_TTL", 7*24*time.Hour),
+		SessionCookieSecure:   getEnvBool("SESSION_COOKIE_SECURE", false),
+		SessionCookieSameSite: getEnv("SESSION_COOKIE_SAMESITE", "lax"),
+		SessionCookieDomain:   getEnv("SESSION_COOKIE_DOMAIN", ""),
+		WebhookSecret:         getEnv("WEBHOOK_SECRET", ""),
+		WebhookAllowPrivate:   getEnvBool("WEBHOOK_ALLOW_PRIVATE", false),
+		BlobDriver:            getEnv("BLOB_DRIVER", "local"),
+		BlobDir:               getEnv("BLOB_DIR", filepath.Join(os.TempDir(), "gotasker-blobs")),
+		S3Endpoint:            getEnv("S3_ENDPOINT", ""),
+		S3Region:              getEnv("S3_REGION", "us-east-1"),
+		S3Bucket:              getEnv("S3_BUCKET", ""),
+		S3AccessKey:           getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:           getEnv("S3_SECRET_KEY", ""),
+		AttachmentMaxSize:     getEnvInt("ATTACHMENT_MAX_SIZE", 25<<20),
+		AttachmentUserQuota:   getEnvInt("ATTACHMENT_USER_QUOTA", 500<<20),
 	}
 }
 
@@ -40,3 +149,42 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvDuration(key string, defaultValue time.Duration) time.Duration {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Warning: invalid duration for %s (%q), using %s", key, value, defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Warning: invalid integer for %s (%q), using %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: invalid boolean for %s (%q), using %t", key, value, defaultValue)
+		return defaultValue
+	}
+	return b
+}
@@ -0,0 +1,220 @@
+// dataexport/archive.go
+package dataexport
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/workflows"
+	"gorm.io/gorm"
+)
+
+// exportedTask includes the deletion time the API normally hides, since
+// soft-deleted tasks are still personal data we hold.
+type exportedTask struct {
+	models.Task
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type exportedAccessToken struct {
+	models.PersonalAccessToken
+	Scopes []string `json:"scopes"`
+}
+
+// archive is everything stored about one user.
+type archive struct {
+	GeneratedAt  time.Time
+	Profile      models.User
+	Tasks        []exportedTask
+	Workflow     *models.Workflow
+	Comments     []models.Comment
+	Attachments  []models.Attachment
+	Reminders    []models.Reminder
+	Inbox        []models.Notification
+	AccessTokens []exportedAccessToken
+	Sessions     []models.Session
+	Identities   []models.UserIdentity
+	AuditEvents  []models.AuditEvent
+}
+
+func load(db *gorm.DB, userID uint) (*archive, error) {
+	a := &archive{GeneratedAt: time.Now().UTC()}
+	// Unscoped so accounts and tasks awaiting purge are exported too
+	if err := db.Unscoped().First(&a.Profile, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var tasks []models.Task
+	if err := db.Unscoped().Preload("Tags").Where("user_id = ?", int(userID)).Order("id asc").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	a.Tasks = make([]exportedTask, len(tasks))
+	for i, task := range tasks {
+		a.Tasks[i].Task = task
+		if task.DeletedAt.Valid {
+			deletedAt := task.DeletedAt.Time
+			a.Tasks[i].DeletedAt = &deletedAt
+		}
+	}
+
+	// A user who never changed their workflow gets the default one here
+	workflow, err := workflows.ForUser(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	a.Workflow = workflow
+
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Comments).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Attachments).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Reminders).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Inbox).Error; err != nil {
+		return nil, err
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	a.AccessTokens = make([]exportedAccessToken, len(tokens))
+	for i, token := range tokens {
+		a.AccessTokens[i] = exportedAccessToken{PersonalAccessToken: token, Scopes: token.ScopeList()}
+	}
+
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Sessions).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.Identities).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Where("user_id = ?", userID).Order("id asc").Find(&a.AuditEvents).Error; err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// Write builds the export archive for userID as a ZIP and writes it to w.
+// It holds one JSON file per kind of record and an index.html summary.
+func Write(db *gorm.DB, userID uint, w io.Writer) error {
+	a, err := load(db, userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", a.Profile},
+		{"tasks.json", a.Tasks},
+		{"workflow.json", a.Workflow},
+		{"comments.json", a.Comments},
+		{"attachments.json", a.Attachments},
+		{"reminders.json", a.Reminders},
+		{"notifications.json", a.Inbox},
+		{"personal_access_tokens.json", a.AccessTokens},
+		{"sessions.json", a.Sessions},
+		{"identities.json", a.Identities},
+		{"audit_events.json", a.AuditEvents},
+	}
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: a.GeneratedAt})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.data); err != nil {
+			return err
+		}
+	}
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: a.GeneratedAt})
+	if err != nil {
+		return err
+	}
+	if err := summaryTemplate.Execute(fw, a); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+var summaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"date": func(t interface{}) string {
+		switch v := t.(type) {
+		case time.Time:
+			return v.UTC().Format("2006-01-02 15:04 MST")
+		case *time.Time:
+			if v != nil {
+				return v.UTC().Format("2006-01-02 15:04 MST")
+			}
+		}
+		return "-"
+	},
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>GoTasker data export for {{.Profile.Username}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+</style>
+</head>
+<body>
+<h1>Your GoTasker data</h1>
+<p>Generated {{date .GeneratedAt}}. The JSON files in this archive contain the complete records.</p>
+
+<h2>Profile</h2>
+<table>
+<tr><th>Username</th><td>{{.Profile.Username}}</td></tr>
+<tr><th>Email</th><td>{{.Profile.Email}}</td></tr>
+<tr><th>Email verified</th><td>{{date .Profile.EmailVerifiedAt}}</td></tr>
+<tr><th>Role</th><td>{{.Profile.Role}}</td></tr>
+<tr><th>Two-factor authentication enabled</th><td>{{date .Profile.TOTPEnabledAt}}</td></tr>
+<tr><th>Registered</th><td>{{date .Profile.CreatedAt}}</td></tr>
+</table>
+
+<h2>Tasks ({{len .Tasks}})</h2>
+<table>
+<tr><th>Title</th><th>Description</th><th>Status</th><th>Due</th><th>Created</th><th>Deleted</th></tr>
+{{range .Tasks}}<tr><td>{{.Title}}</td><td>{{.Description}}</td><td>{{.Status}}</td><td>{{date .DueDate}}</td><td>{{date .CreatedAt}}</td><td>{{date .DeletedAt}}</td></tr>
+{{end}}</table>
+
+<h2>Personal access tokens ({{len .AccessTokens}})</h2>
+<table>
+<tr><th>Name</th><th>Scopes</th><th>Created</th><th>Last used</th><th>Revoked</th></tr>
+{{range .AccessTokens}}<tr><td>{{.Name}}</td><td>{{range $i, $s := .Scopes}}{{if $i}}, {{end}}{{$s}}{{end}}</td><td>{{date .CreatedAt}}</td><td>{{date .LastUsedAt}}</td><td>{{date .RevokedAt}}</td></tr>
+{{end}}</table>
+
+<h2>Linked sign-in providers ({{len .Identities}})</h2>
+<table>
+<tr><th>Provider</th><th>Email</th><th>Last sign-in</th></tr>
+{{range .Identities}}<tr><td>{{.Issuer}}</td><td>{{.Email}}</td><td>{{date .LastLoginAt}}</td></tr>
+{{end}}</table>
+
+<h2>Sessions ({{len .Sessions}})</h2>
+<table>
+<tr><th>Signed in</th><th>IP address</th><th>User agent</th><th>Last seen</th><th>Signed out</th></tr>
+{{range .Sessions}}<tr><td>{{date .CreatedAt}}</td><td>{{.IP}}</td><td>{{.UserAgent}}</td><td>{{date .LastSeenAt}}</td><td>{{date .RevokedAt}}</td></tr>
+{{end}}</table>
+
+<h2>Security events ({{len .AuditEvents}})</h2>
+<table>
+<tr><th>Time</th><th>Event</th><th>IP address</th><th>User agent</th></tr>
+{{range .AuditEvents}}<tr><td>{{date .CreatedAt}}</td><td>{{.Event}}</td><td>{{.IP}}</td><td>{{.UserAgent}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,186 @@
+// dataexport/dataexport.go
+package dataexport
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+// stalePendingAge is how long an export may stay pending before it is
+// assumed lost, for example because the process restarted mid-build.
+const stalePendingAge = time.Hour
+
+// ErrInProgress is returned by Request while an earlier export for the same
+// user is still being built.
+var ErrInProgress = errors.New("an export is already in progress")
+
+var (
+	mu  sync.RWMutex
+	db  *gorm.DB
+	dir string
+	ttl time.Duration
+)
+
+// Init sets the database, the directory archives are written to and how
+// long a finished archive can be downloaded.
+func Init(database *gorm.DB, directory string, lifetime time.Duration) error {
+	if err := os.MkdirAll(directory, 0o700); err != nil {
+		return err
+	}
+	mu.Lock()
+	db, dir, ttl = database, directory, lifetime
+	mu.Unlock()
+	return nil
+}
+
+// Request records a new export for userID and builds it in the background.
+// done, if not nil, is called with the finished export whether it
+// succeeded or failed.
+func Request(userID uint, done func(models.DataExport)) (models.DataExport, error) {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	export := models.DataExport{UserID: userID, Status: models.ExportPending, CreatedAt: time.Now()}
+	if database == nil {
+		return export, errors.New("data export is not initialized")
+	}
+
+	var pending int64
+	if err := database.Model(&models.DataExport{}).
+		Where("user_id = ? AND status = ? AND created_at > ?", userID, models.ExportPending, time.Now().Add(-stalePendingAge)).
+		Count(&pending).Error; err != nil {
+		return export, err
+	}
+	if pending > 0 {
+		return export, ErrInProgress
+	}
+	if err := database.Create(&export).Error; err != nil {
+		return export, err
+	}
+
+	go func() {
+		result := build(export)
+		if done != nil {
+			done(result)
+		}
+	}()
+	return export, nil
+}
+
+// build writes the archive for export and records the outcome.
+func build(export models.DataExport) models.DataExport {
+	mu.RLock()
+	database, directory, lifetime := db, dir, ttl
+	mu.RUnlock()
+
+	path := filepath.Join(directory, fmt.Sprintf("export-%d-%d.zip", export.UserID, export.ID))
+	size, err := writeFile(database, export.UserID, path)
+	now := time.Now()
+	updates := map[string]interface{}{"completed_at": now}
+	if err != nil {
+		log.Printf("Error building data export %d for user_id %d: %v", export.ID, export.UserID, err)
+		os.Remove(path)
+		export.Status = models.ExportFailed
+		updates["status"] = models.ExportFailed
+		updates["error"] = err.Error()
+	} else {
+		expiresAt := now.Add(lifetime)
+		export.Status = models.ExportReady
+		export.FilePath = path
+		export.Size = size
+		export.ExpiresAt = &expiresAt
+		updates["status"] = models.ExportReady
+		updates["file_path"] = path
+		updates["size"] = size
+		updates["expires_at"] = expiresAt
+		log.Printf("Data export %d for user_id %d is ready (%d bytes)", export.ID, export.UserID, size)
+	}
+	export.CompletedAt = &now
+	if err := database.Model(&models.DataExport{}).Where("id = ?", export.ID).Updates(updates).Error; err != nil {
+		log.Printf("Error recording data export %d: %v", export.ID, err)
+	}
+	return export
+}
+
+func writeFile(database *gorm.DB, userID uint, path string) (int64, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	if err := Write(database, userID, f); err != nil {
+		f.Close()
+		return 0, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+	return info.Size(), f.Close()
+}
+
+// Sweep deletes archives past their expiry and fails exports that have been
+// pending too long.
+func Sweep() error {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return nil
+	}
+
+	now := time.Now()
+	var expired []models.DataExport
+	if err := database.Where("status = ? AND expires_at < ?", models.ExportReady, now).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, export := range expired {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing data export file %s: %v", export.FilePath, err)
+			continue
+		}
+		if err := database.Model(&models.DataExport{}).Where("id = ?", export.ID).
+			Updates(map[string]interface{}{"status": models.ExportExpired, "file_path": ""}).Error; err != nil {
+			return err
+		}
+	}
+	return database.Model(&models.DataExport{}).
+		Where("status = ? AND created_at < ?", models.ExportPending, now.Add(-stalePendingAge)).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": "timed out"}).Error
+}
+
+// Start runs Sweep in the background at the given interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Sweep(); err != nil {
+				log.Printf("Error sweeping data exports: %v", err)
+			}
+		}
+	}()
+}
+
+// Discard deletes every archive built for userID along with its records,
+// used when the account itself is purged.
+func Discard(database *gorm.DB, userID uint) error {
+	var exports []models.DataExport
+	if err := database.Where("user_id = ? AND file_path <> ''", userID).Find(&exports).Error; err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if err := os.Remove(export.FilePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return database.Where("user_id = ?", userID).Delete(&models.DataExport{}).Error
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/secure"
+)
+
+type accessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Token      string     `json:"token,omitempty"`
+}
+
+func newAccessTokenResponse(pat models.PersonalAccessToken) accessTokenResponse {
+	return accessTokenResponse{
+		ID:         pat.ID,
+		Name:       pat.Name,
+		Prefix:     pat.Prefix,
+		Scopes:     pat.ScopeList(),
+		ExpiresAt:  pat.ExpiresAt,
+		LastUsedAt: pat.LastUsedAt,
+		RevokedAt:  pat.RevokedAt,
+		CreatedAt:  pat.CreatedAt,
+	}
+}
+
+func isValidScope(scope string) bool {
+	for _, s := range models.ValidScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateAccessToken(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Name      string     `json:"name"`
+		Scopes    []string   `json:"scopes"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body: `+err.Error()+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" || len(input.Name) > 100 {
+		http.Error(w, `{"error": "Name is required and must be at most 100 characters"}`, http.StatusBadRequest)
+		return
+	}
+	if len(input.Scopes) == 0 {
+		http.Error(w, `{"error": "At least one scope is required"}`, http.StatusBadRequest)
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !isValidScope(scope) {
+			log.Printf("Invalid token scope: %s", scope)
+			http.Error(w, `{"error": "Scopes must be one of `+strings.Join(models.ValidScopes, ", ")+`"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		http.Error(w, `{"error": "Expiry must be in the future"}`, http.StatusBadRequest)
+		return
+	}
+
+	secret, err := secure.RandomToken(32)
+	if err != nil {
+		log.Printf("Error generating access token: %v", err)
+		http.Error(w, `{"error": "Failed to create token"}`, http.StatusInternalServerError)
+		return
+	}
+	value := models.PersonalAccessTokenPrefix + secret
+
+	pat := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      input.Name,
+		TokenHash: secure.HashToken(value),
+		Prefix:    value[:len(models.PersonalAccessTokenPrefix)+6],
+		Scopes:    strings.Join(input.Scopes, " "),
+		ExpiresAt: input.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&pat).Error; err != nil {
+		log.Printf("Error creating access token for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to create token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// The plaintext token is only ever returned here
+	response := newAccessTokenResponse(pat)
+	response.Token = value
+
+	log.Printf("Access token created for user_id %d: ID=%d, Name=%s", userID, pat.ID, pat.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+func GetAccessTokens(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var tokens []models.PersonalAccessToken
+	if err := db.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens).Error; err != nil {
+		log.Printf("Error listing access tokens for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to list tokens"}`, http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]accessTokenResponse, 0, len(tokens))
+	for _, pat := range tokens {
+		response = append(response, newAccessTokenResponse(pat))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tokens": response})
+}
+
+func RevokeAccessToken(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		log.Printf("Invalid token ID: %v", err)
+		http.Error(w, `{"error": "Invalid token ID"}`, http.StatusBadRequest)
+		return
+	}
+
+	result := db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Error revoking access token for user_id %d: ID=%d, error=%v", userID, id, result.Error)
+		http.Error(w, `{"error": "Failed to revoke token"}`, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, `{"error": "Token not found"}`, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Access token revoked for user_id %d: ID=%d", userID, id)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Token revoked"})
+}
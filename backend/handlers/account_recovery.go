@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/lockout"
+	"github.com/harip/GoTasker/mailer"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// createUserToken replaces any outstanding token of the same purpose for
+// userID with a new one and returns its plaintext value.
+func createUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	value, err := secure.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	if err := db.Model(&models.UserToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", now).Error; err != nil {
+		return "", err
+	}
+	token := models.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: secure.HashToken(value),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := db.Create(&token).Error; err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// consumeUserToken marks the token used and returns it. A token can only be
+// consumed once even under concurrent requests.
+func consumeUserToken(value, purpose string) (models.UserToken, error) {
+	var token models.UserToken
+	if err := db.Where("token_hash = ? AND purpose = ?", secure.HashToken(value), purpose).First(&token).Error; err != nil {
+		return token, errInvalidUserToken
+	}
+	if token.UsedAt != nil || time.Now().After(token.ExpiresAt) {
+		return token, errInvalidUserToken
+	}
+	result := db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return token, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return token, errInvalidUserToken
+	}
+	return token, nil
+}
+
+func appLink(path, token string) string {
+	return strings.TrimRight(config.AppConfig.AppBaseURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail mails user a link that confirms their address
+func sendVerificationEmail(user models.User) error {
+	token, err := createUserToken(user.ID, models.TokenPurposeEmailVerification, config.AppConfig.EmailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	return sendMail(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Confirm your GoTasker email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link expires in %s. If you did not create a GoTasker account you can ignore this email.\n",
+			user.Username, appLink("/verify-email", token), config.AppConfig.EmailVerificationTTL),
+	})
+}
+
+// sendPasswordResetEmail mails user a single-use password reset link
+func sendPasswordResetEmail(user models.User) error {
+	token, err := createUserToken(user.ID, models.TokenPurposePasswordReset, config.AppConfig.PasswordResetTTL)
+	if err != nil {
+		return err
+	}
+	return sendMail(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Reset your GoTasker password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your GoTasker account. "+
+			"To choose a new password, open this link:\n\n%s\n\n"+
+			"The link expires in %s and can only be used once. If you did not ask for this you can ignore this email.\n",
+			user.Username, appLink("/reset-password", token), config.AppConfig.PasswordResetTTL),
+	})
+}
+
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Email == "" {
+		http.Error(w, `{"error": "Email is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The response is the same whether or not the address is registered so
+	// this endpoint cannot be used to discover accounts.
+	var user models.User
+	if err := db.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		if err := sendPasswordResetEmail(user); err != nil {
+			log.Printf("Error sending password reset email to user_id %d: %v", user.ID, err)
+		} else {
+			log.Printf("Password reset email sent to user_id %d", user.ID)
+		}
+	} else {
+		log.Printf("Password reset requested for unknown email")
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "If that email is registered, a reset link has been sent"})
+}
+
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Password == "" {
+		http.Error(w, `{"error": "Password is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposePasswordReset)
+	if err != nil {
+		log.Printf("Password reset with invalid token: %v", err)
+		http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusBadRequest)
+		return
+	}
+
+	hashed, err := password.Hash(input.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, `{"error": "Failed to reset password"}`, http.StatusInternalServerError)
+		return
+	}
+	// Following the emailed link also proves the user controls the address
+	if err := db.Model(&models.User{}).Where("id = ?", token.UserID).Updates(map[string]interface{}{
+		"password":          hashed,
+		"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+	}).Error; err != nil {
+		log.Printf("Error resetting password for user_id %d: %v", token.UserID, err)
+		http.Error(w, `{"error": "Failed to reset password"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := revokeUserSessions(token.UserID); err != nil {
+		log.Printf("Error revoking sessions after password reset for user_id %d: %v", token.UserID, err)
+	}
+	// Whoever reset the password controls the inbox, so lift any lockout
+	var user models.User
+	if err := db.Select("id", "username").First(&user, token.UserID).Error; err == nil {
+		lockout.Reset(user.Username)
+	}
+
+	log.Printf("Password reset for user_id %d", token.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
+
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposeEmailVerification)
+	if err != nil {
+		log.Printf("Email verification with invalid token: %v", err)
+		http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusBadRequest)
+		return
+	}
+	if err := db.Model(&models.User{}).Where("id = ?", token.UserID).
+		Update("email_verified_at", gorm.Expr("COALESCE(email_verified_at, ?)", time.Now())).Error; err != nil {
+		log.Printf("Error verifying email for user_id %d: %v", token.UserID, err)
+		http.Error(w, `{"error": "Failed to verify email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Email verified for user_id %d", token.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email verified"})
+}
+
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, `{"error": "Email is already verified"}`, http.StatusConflict)
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification email to user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to send verification email"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
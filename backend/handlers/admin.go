@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+	"gorm.io/gorm"
+)
+
+func isValidRole(role string) bool {
+	for _, r := range models.ValidRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// loadAdminTarget returns the acting admin's ID and the user named in the
+// URL, writing an error response if either is missing.
+func loadAdminTarget(w http.ResponseWriter, r *http.Request) (uint, models.User, bool) {
+	var user models.User
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return 0, user, false
+	}
+
+	adminID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return 0, user, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Invalid user ID: %v", err)
+		http.Error(w, `{"error": "Invalid user ID"}`, http.StatusBadRequest)
+		return 0, user, false
+	}
+	if err := db.First(&user, id).Error; err != nil {
+		log.Printf("User not found: ID=%d, error=%v", id, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return 0, user, false
+	}
+	return adminID, user, true
+}
+
+// rejectLockingOutAdmins refuses changes that would take away the acting
+// admin's own access or leave no active admin at all.
+func rejectLockingOutAdmins(w http.ResponseWriter, adminID uint, user models.User) bool {
+	if user.ID == adminID {
+		http.Error(w, `{"error": "Admins cannot disable, delete or demote themselves"}`, http.StatusConflict)
+		return true
+	}
+	if user.Role != models.RoleAdmin || user.DisabledAt != nil {
+		return false
+	}
+	var others int64
+	if err := db.Model(&models.User{}).
+		Where("role = ? AND disabled_at IS NULL AND id <> ?", models.RoleAdmin, user.ID).
+		Count(&others).Error; err != nil {
+		log.Printf("Error counting admins: %v", err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return true
+	}
+	if others == 0 {
+		http.Error(w, `{"error": "At least one active admin is required"}`, http.StatusConflict)
+		return true
+	}
+	return false
+}
+
+func AdminListUsers(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	offset := (page - 1) * limit
+
+	dbQuery := db.Model(&models.User{})
+	if search := strings.TrimSpace(query.Get("q")); search != "" {
+		pattern := "%" + strings.ToLower(search) + "%"
+		dbQuery = dbQuery.Where("LOWER(username) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+	if role := query.Get("role"); role != "" {
+		if !isValidRole(role) {
+			http.Error(w, `{"error": "Role must be one of `+strings.Join(models.ValidRoles, ", ")+`"}`, http.StatusBadRequest)
+			return
+		}
+		dbQuery = dbQuery.Where("role = ?", role)
+	}
+	switch query.Get("status") {
+	case "", "all":
+	case "active":
+		dbQuery = dbQuery.Where("disabled_at IS NULL")
+	case "disabled":
+		dbQuery = dbQuery.Where("disabled_at IS NOT NULL")
+	default:
+		http.Error(w, `{"error": "Status must be one of active, disabled, all"}`, http.StatusBadRequest)
+		return
+	}
+
+	var total int64
+	dbQuery.Count(&total)
+	var users []models.User
+	if err := dbQuery.Order("id asc").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		log.Printf("Error listing users: %v", err)
+		http.Error(w, `{"error": "Failed to list users"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"users": users,
+		"page":  page,
+		"limit": limit,
+		"total": total,
+	})
+}
+
+func AdminDisableUser(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, `{"error": "User is already disabled"}`, http.StatusConflict)
+		return
+	}
+	if rejectLockingOutAdmins(w, adminID, user) {
+		return
+	}
+
+	now := time.Now()
+	if err := db.Model(&user).Update("disabled_at", now).Error; err != nil {
+		log.Printf("Error disabling user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to disable user"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := revokeUserSessions(user.ID); err != nil {
+		log.Printf("Error revoking sessions for disabled user_id %d: %v", user.ID, err)
+	}
+	middleware.ForgetAccountStatus(user.ID)
+	audit.Record(r, audit.AdminUserDisabled, user.ID, fmt.Sprintf("by=%d", adminID))
+
+	user.DisabledAt = &now
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func AdminEnableUser(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+	if user.DisabledAt == nil {
+		http.Error(w, `{"error": "User is not disabled"}`, http.StatusConflict)
+		return
+	}
+
+	if err := db.Model(&user).Update("disabled_at", nil).Error; err != nil {
+		log.Printf("Error enabling user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to enable user"}`, http.StatusInternalServerError)
+		return
+	}
+	middleware.ForgetAccountStatus(user.ID)
+	audit.Record(r, audit.AdminUserEnabled, user.ID, fmt.Sprintf("by=%d", adminID))
+
+	user.DisabledAt = nil
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func AdminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+	if rejectLockingOutAdmins(w, adminID, user) {
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return softDeleteUser(tx, &user)
+	}); err != nil {
+		log.Printf("Error deleting user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to delete user"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := revokeUserSessions(user.ID); err != nil {
+		log.Printf("Error revoking sessions for deleted user_id %d: %v", user.ID, err)
+	}
+	middleware.ForgetAccountStatus(user.ID)
+	audit.Record(r, audit.AdminUserDeleted, user.ID, fmt.Sprintf("by=%d", adminID))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "User deleted"})
+}
+
+func AdminSetUserRole(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if !isValidRole(input.Role) {
+		http.Error(w, `{"error": "Role must be one of `+strings.Join(models.ValidRoles, ", ")+`"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Role == user.Role {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(user)
+		return
+	}
+	if user.Role == models.RoleAdmin && rejectLockingOutAdmins(w, adminID, user) {
+		return
+	}
+
+	if err := db.Model(&user).Update("role", input.Role).Error; err != nil {
+		log.Printf("Error changing role for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to change role"}`, http.StatusInternalServerError)
+		return
+	}
+	// Access tokens carry the old role; cutting them off makes the client
+	// refresh and pick up the new one.
+	if err := revocation.RevokeAllForUser(user.ID); err != nil {
+		log.Printf("Error revoking access tokens for user_id %d: %v", user.ID, err)
+	}
+	audit.Record(r, audit.AdminRoleChanged, user.ID, fmt.Sprintf("by=%d from=%s to=%s", adminID, user.Role, input.Role))
+
+	user.Role = input.Role
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func AdminSendPasswordReset(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := sendPasswordResetEmail(user); err != nil {
+		log.Printf("Error sending password reset email to user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to send password reset email"}`, http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, audit.AdminPasswordReset, user.ID, fmt.Sprintf("by=%d", adminID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password reset email sent"})
+}
+
+// AdminImpersonate issues a short-lived access token that lets an admin see
+// the API exactly as the user does. The token names the admin in its act
+// claim, cannot be refreshed, and every request made with it is audited.
+func AdminImpersonate(w http.ResponseWriter, r *http.Request) {
+	adminID, user, ok := loadAdminTarget(w, r)
+	if !ok {
+		return
+	}
+	principal, _ := auth.FromContext(r.Context())
+	if user.ID == adminID {
+		http.Error(w, `{"error": "Cannot impersonate yourself"}`, http.StatusBadRequest)
+		return
+	}
+	if user.DisabledAt != nil {
+		http.Error(w, `{"error": "User is disabled"}`, http.StatusConflict)
+		return
+	}
+	// Impersonating another admin would hand over their admin rights
+	if user.Role == models.RoleAdmin {
+		http.Error(w, `{"error": "Admins cannot be impersonated"}`, http.StatusForbidden)
+		return
+	}
+
+	expiresAt := time.Now().Add(config.AppConfig.AccessTokenTTL)
+	token, err := newImpersonationToken(user, principal, expiresAt)
+	if err != nil {
+		log.Printf("Error issuing impersonation token for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to impersonate user"}`, http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, audit.AdminImpersonated, user.ID, fmt.Sprintf("by=%d", adminID))
+
+	log.Printf("Admin %d impersonating user_id %d until %s", adminID, user.ID, expiresAt.Format(time.RFC3339))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"token":      token,
+		"token_type": "Bearer",
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"user":       user,
+	})
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/attachments"
+	"github.com/harip/GoTasker/models"
+)
+
+// multipartOverhead is allowed on top of the file size limit for the
+// multipart framing and any other form fields.
+const multipartOverhead = 1 << 20
+
+// loadAttachment returns the attachment named in the URL on task, writing
+// an error response if it cannot.
+func loadAttachment(w http.ResponseWriter, r *http.Request, task models.Task) (models.Attachment, bool) {
+	var attachment models.Attachment
+	attachmentID, err := strconv.Atoi(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		log.Printf("Invalid attachment ID: %v", err)
+		http.Error(w, `{"error": "Invalid attachment ID"}`, http.StatusBadRequest)
+		return attachment, false
+	}
+	if err := db.Where("id = ? AND task_id = ?", attachmentID, task.ID).First(&attachment).Error; err != nil {
+		log.Printf("Attachment not found on task %d: ID=%d, error=%v", task.ID, attachmentID, err)
+		http.Error(w, `{"error": "Attachment not found"}`, http.StatusNotFound)
+		return attachment, false
+	}
+	return attachment, true
+}
+
+func GetAttachments(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	list := []models.Attachment{}
+	if err := db.Where("task_id = ?", task.ID).Order("created_at asc, id asc").Find(&list).Error; err != nil {
+		log.Printf("Error listing attachments of task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to list attachments"}`, http.StatusInternalServerError)
+		return
+	}
+	used, err := attachments.Usage(userID)
+	if err != nil {
+		log.Printf("Error computing attachment usage for user_id %d: %v", userID, err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attachments": list,
+		"used":        used,
+		"quota":       attachments.CurrentLimits().UserQuota,
+	})
+}
+
+// UploadAttachment stores the "file" part of a multipart/form-data
+// request. The file is streamed rather than parsed into memory.
+func UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	limits := attachments.CurrentLimits()
+	r.Body = http.MaxBytesReader(w, r.Body, limits.MaxFileSize+multipartOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, `{"error": "Expected a multipart/form-data upload"}`, http.StatusBadRequest)
+		return
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			http.Error(w, `{"error": "No file field in the upload"}`, http.StatusBadRequest)
+			return
+		}
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			http.Error(w, `{"error": "File is too large"}`, http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			log.Printf("Error reading upload for task %d: %v", task.ID, err)
+			http.Error(w, `{"error": "Invalid multipart body"}`, http.StatusBadRequest)
+			return
+		}
+		if part.FormName() != "file" {
+			part.Close()
+			continue
+		}
+
+		attachment, err := attachments.Save(r.Context(), task, userID, part.FileName(), part)
+		part.Close()
+		switch {
+		case errors.Is(err, attachments.ErrTooLarge), errors.As(err, &tooBig):
+			http.Error(w, `{"error": "File is larger than `+strconv.FormatInt(limits.MaxFileSize, 10)+` bytes"}`, http.StatusRequestEntityTooLarge)
+			return
+		case errors.Is(err, attachments.ErrQuotaExceeded):
+			http.Error(w, `{"error": "Attachment storage quota exceeded"}`, http.StatusRequestEntityTooLarge)
+			return
+		case err != nil:
+			log.Printf("Error saving attachment for task %d of user_id %d: %v", task.ID, userID, err)
+			http.Error(w, `{"error": "Failed to store attachment"}`, http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("Attachment %d uploaded to task %d by user_id %d (%d bytes, %s)", attachment.ID, task.ID, userID, attachment.Size, attachment.ContentType)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(attachment)
+		return
+	}
+}
+
+// DownloadAttachment streams an attachment, answering range requests. It
+// is always served as a download so uploaded HTML cannot run in the API's
+// origin.
+func DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	attachment, ok := loadAttachment(w, r, task)
+	if !ok {
+		return
+	}
+
+	content, err := attachments.Open(r.Context(), attachment)
+	if err != nil {
+		log.Printf("Error opening attachment %d for user_id %d: %v", attachment.ID, userID, err)
+		http.Error(w, `{"error": "Failed to read attachment"}`, http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Filename}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("ETag", `"`+attachment.SHA256+`"`)
+	http.ServeContent(w, r, "", attachment.CreatedAt, content)
+}
+
+// DeleteAttachment removes an attachment. Its blob is removed by the
+// collector once no other attachment shares it.
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	attachment, ok := loadAttachment(w, r, task)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(&attachment).Error; err != nil {
+		log.Printf("Error deleting attachment %d of task %d: %v", attachment.ID, task.ID, err)
+		http.Error(w, `{"error": "Failed to delete attachment"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Attachment %d of task %d deleted by user_id %d", attachment.ID, task.ID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted"})
+}
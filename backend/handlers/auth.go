@@ -1,23 +1,30 @@
 package handlers
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"log"
 	"net/http"
 	"regexp"
-	"time"
+	"sync"
 
-	"github.com/dgrijalva/jwt-go"
-	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/lockout"
 	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
 )
 
+var emailPattern = regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
+
 type Credentials struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 	Email    string `json:"email"`
+	// Session selects how Login authenticates the client afterwards:
+	// "bearer" (default) for tokens, "cookie" for a session cookie.
+	Session string `json:"session,omitempty"`
 }
 
 func Login(w http.ResponseWriter, r *http.Request) {
@@ -34,40 +41,71 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	log.Printf("Login attempt for username: %s", creds.Username)
+	if !isValidSessionMode(creds.Session) {
+		http.Error(w, `{"error": "Session must be bearer or cookie"}`, http.StatusBadRequest)
+		return
+	}
+
+	if rejectThrottledLogin(w, r, creds.Username) {
+		return
+	}
 
 	var user models.User
 	if err := db.Where("username = ?", creds.Username).First(&user).Error; err != nil {
 		log.Printf("User not found or query error for username '%s': %v", creds.Username, err)
+		// Spend the same time as a real verification so response timing
+		// does not reveal which usernames exist.
+		password.Verify(creds.Password, dummyPasswordHash())
+		recordLoginFailure(r, audit.LoginFailed, creds.Username, nil)
 		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
 		return
 	}
 
-	if creds.Password != user.Password {
-		hash := sha256.Sum256([]byte(creds.Password))
-		inputHash := hex.EncodeToString(hash[:])
-		storedHash := sha256.Sum256([]byte(user.Password))
-		storedHashStr := hex.EncodeToString(storedHash[:])
-		log.Printf("Password verification failed for username: %s, stored password (hashed for log): %s, input password (hashed for log): %s",
-			creds.Username, storedHashStr, inputHash)
+	match, err := password.Verify(creds.Password, user.Password)
+	if err != nil || !match {
+		log.Printf("Password verification failed for username: %s (err=%v)", creds.Username, err)
+		recordLoginFailure(r, audit.LoginFailed, creds.Username, &user)
 		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
 		return
 	}
+	// Only reveal that the account is disabled once the password is known
+	if user.DisabledAt != nil {
+		log.Printf("Login attempt for disabled user_id %d", user.ID)
+		audit.Record(r, audit.LoginFailed, user.ID, "reason=disabled")
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusForbidden)
+		return
+	}
+	if password.NeedsRehash(user.Password) {
+		upgradePasswordHash(&user, creds.Password)
+	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  float64(user.ID),
-		"username": creds.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
+	// With two-factor enabled the password alone only earns a pending token
+	// that must be exchanged at /login/mfa together with a code. Failures
+	// are not reset until the second factor is also correct.
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := newMFAPendingToken(user)
+		if err != nil {
+			log.Printf("Error generating MFA token: %v", err)
+			http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"mfa_required": "true", "mfa_token": mfaToken})
+		log.Printf("Password accepted for username: %s, awaiting second factor", creds.Username)
+		return
+	}
 
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
+	response, err := loginResponse(w, r, user, creds.Session)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
 		return
 	}
+	lockout.Reset(user.Username)
+	audit.Record(r, audit.LoginSucceeded, user.ID, "")
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	json.NewEncoder(w).Encode(response)
 	log.Printf("Login successful for username: %s", creds.Username)
 }
 
@@ -102,30 +140,39 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	emailRegex := regexp.MustCompile(`^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\.[a-zA-Z]{2,}$`)
-	if !emailRegex.MatchString(creds.Email) {
+	if !emailPattern.MatchString(creds.Email) {
 		log.Printf("Invalid email format: %s", creds.Email)
 		http.Error(w, `{"error": "Invalid email format"}`, http.StatusBadRequest)
 		return
 	}
 
+	// Unscoped: soft-deleted accounts keep their username and email until
+	// they are purged
 	var existingUser models.User
-	if err := db.Where("username = ?", creds.Username).First(&existingUser).Error; err == nil {
+	if err := db.Unscoped().Where("username = ?", creds.Username).First(&existingUser).Error; err == nil {
 		log.Printf("Username %s already exists", creds.Username)
 		http.Error(w, `{"error": "Username already taken"}`, http.StatusConflict)
 		return
 	}
 
-	if err := db.Where("email = ?", creds.Email).First(&existingUser).Error; err == nil {
+	if err := db.Unscoped().Where("email = ?", creds.Email).First(&existingUser).Error; err == nil {
 		log.Printf("Email %s already exists", creds.Email)
 		http.Error(w, `{"error": "Email already taken"}`, http.StatusConflict)
 		return
 	}
 
+	hashedPassword, err := password.Hash(creds.Password)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, `{"error": "Failed to create user"}`, http.StatusInternalServerError)
+		return
+	}
+
 	user := models.User{
 		Username: creds.Username,
-		Password: creds.Password,
+		Password: hashedPassword,
 		Email:    creds.Email,
+		Role:     models.RoleMember,
 	}
 	if err := db.Create(&user).Error; err != nil {
 		log.Printf("Error creating user: %v", err)
@@ -133,24 +180,137 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":  float64(user.ID),
-		"username": creds.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenString, err := token.SignedString([]byte(config.AppConfig.JWTSecret))
+	tokens, err := issueTokens(r, user)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
 		return
 	}
 
-	hash := sha256.Sum256([]byte(user.Password))
-	hashedPassword := hex.EncodeToString(hash[:])
-	log.Printf("User %s created successfully with password (hashed for log): %s", creds.Username, hashedPassword)
+	log.Printf("User %s created successfully", creds.Username)
+
+	if err := sendVerificationEmail(user); err != nil {
+		log.Printf("Error sending verification email to user_id %d: %v", user.ID, err)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]string{"token": tokenString})
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	userID, jti, expiresAt := principal.UserID, principal.TokenID, principal.ExpiresAt
+	if principal.Method == auth.MethodSession {
+		if err := endCookieSession(w, principal); err != nil {
+			log.Printf("Error ending session for user_id %d: %v", userID, err)
+			http.Error(w, `{"error": "Failed to log out"}`, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Logout successful for user_id %d", userID)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+		return
+	}
+	if jti == "" {
+		log.Printf("Logout with a token lacking jti for user_id %d", userID)
+		http.Error(w, `{"error": "Token cannot be revoked individually, use /logout-all"}`, http.StatusBadRequest)
+		return
+	}
+
+	// The refresh token is optional; when present its family is revoked so
+	// the client cannot silently obtain a new access token.
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			log.Printf("Error decoding logout request body: %v", err)
+			http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := revocation.Revoke(jti, userID, expiresAt); err != nil {
+		log.Printf("Error revoking token for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to log out"}`, http.StatusInternalServerError)
+		return
+	}
+	if input.RefreshToken != "" {
+		var stored models.RefreshToken
+		if err := db.Where("token_hash = ? AND user_id = ?", secure.HashToken(input.RefreshToken), userID).
+			First(&stored).Error; err == nil {
+			if err := revokeTokenFamily(stored.FamilyID); err != nil {
+				log.Printf("Error revoking token family %s: %v", stored.FamilyID, err)
+			}
+		}
+	}
+
+	log.Printf("Logout successful for user_id %d", userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out"})
+}
+
+func LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if err := revokeUserSessions(userID); err != nil {
+		log.Printf("Error revoking sessions for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to log out"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Logged out all sessions for user_id %d", userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out of all sessions"})
+}
+
+// upgradePasswordHash re-hashes a legacy plaintext or weaker stored password
+// with the current default parameters after a successful login. Failures are
+// logged only; the user is already authenticated.
+func upgradePasswordHash(user *models.User, plain string) {
+	hashed, err := password.Hash(plain)
+	if err != nil {
+		log.Printf("Error re-hashing password for user_id %d: %v", user.ID, err)
+		return
+	}
+	if err := db.Model(user).UpdateColumn("password", hashed).Error; err != nil {
+		log.Printf("Error storing upgraded password hash for user_id %d: %v", user.ID, err)
+		return
+	}
+	log.Printf("Upgraded password hash for user_id %d", user.ID)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = password.Hash("gotasker-dummy-password")
+	})
+	return dummyHash
 }
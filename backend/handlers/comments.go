@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/markdown"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/notify"
+	"gorm.io/gorm"
+)
+
+const (
+	maxCommentLength = 10000
+)
+
+func renderComments(comments []models.Comment) {
+	for i := range comments {
+		comments[i].BodyHTML = markdown.Render(comments[i].Body)
+	}
+}
+
+// attachCommentCounts fills in the comment count of each task, using one
+// query for the whole slice.
+func attachCommentCounts(tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	var rows []struct {
+		TaskID int
+		Count  int
+	}
+	if err := db.Model(&models.Comment{}).Select("task_id, COUNT(*) AS count").
+		Where("task_id IN ?", ids).Group("task_id").Scan(&rows).Error; err != nil {
+		return err
+	}
+	counts := make(map[int]int, len(rows))
+	for _, row := range rows {
+		counts[row.TaskID] = row.Count
+	}
+	for i := range tasks {
+		tasks[i].CommentCount = counts[tasks[i].ID]
+	}
+	return nil
+}
+
+// validCommentBody trims body and checks it, writing an error response if
+// it is empty or too long.
+func validCommentBody(w http.ResponseWriter, body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		http.Error(w, `{"error": "Comment body is required"}`, http.StatusBadRequest)
+		return "", false
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		http.Error(w, `{"error": "Comment body must be at most 10000 characters"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+// notifyMentions puts a notification in the inbox of every user mentioned
+// in comment who was not already mentioned in its previous body. Authors
+// are not notified of their own mentions, nor are disabled accounts.
+//
+// Tasks are private to their owner, so the notification only names the
+// author and links the task by ID: neither its title nor the comment is
+// quoted to a user who may not be able to open it.
+func notifyMentions(tx *gorm.DB, task models.Task, comment models.Comment, previous string) error {
+	names := markdown.Mentions(comment.Body)
+	if previous != "" {
+		already := map[string]bool{}
+		for _, name := range markdown.Mentions(previous) {
+			already[name] = true
+		}
+		fresh := names[:0]
+		for _, name := range names {
+			if !already[name] {
+				fresh = append(fresh, name)
+			}
+		}
+		names = fresh
+	}
+	if len(names) == 0 {
+		return nil
+	}
+
+	var author models.User
+	if err := tx.Select("id", "username").First(&author, comment.UserID).Error; err != nil {
+		return err
+	}
+	var mentioned []models.User
+	if err := tx.Where("username IN ? AND id <> ? AND disabled_at IS NULL", names, comment.UserID).
+		Find(&mentioned).Error; err != nil {
+		return err
+	}
+
+	title := notify.Truncate(author.Username+" mentioned you in a comment", notify.MaxTitleLength)
+	inbox := notify.NewInboxNotifier(tx)
+	for _, user := range mentioned {
+		if err := inbox.Notify(context.Background(), notify.Message{
+			User:   user,
+			Kind:   notify.KindMention,
+			Title:  title,
+			TaskID: &task.ID,
+			SentAt: time.Now(),
+		}); err != nil {
+			return err
+		}
+		log.Printf("User %d mentioned user %d in comment %d on task %d", comment.UserID, user.ID, comment.ID, task.ID)
+	}
+	return nil
+}
+
+// loadComment returns the comment named in the URL on task, writing an
+// error response if it cannot. Only the author may change a comment, so
+// with forChange set another user's comment is refused.
+func loadComment(w http.ResponseWriter, r *http.Request, userID uint, task models.Task, forChange bool) (models.Comment, bool) {
+	var comment models.Comment
+	commentID, err := strconv.Atoi(mux.Vars(r)["comment_id"])
+	if err != nil {
+		log.Printf("Invalid comment ID: %v", err)
+		http.Error(w, `{"error": "Invalid comment ID"}`, http.StatusBadRequest)
+		return comment, false
+	}
+	if err := db.Where("id = ? AND task_id = ?", commentID, task.ID).First(&comment).Error; err != nil {
+		log.Printf("Comment not found on task %d: ID=%d, error=%v", task.ID, commentID, err)
+		http.Error(w, `{"error": "Comment not found"}`, http.StatusNotFound)
+		return comment, false
+	}
+	if forChange && comment.UserID != userID {
+		http.Error(w, `{"error": "Only the author can change a comment"}`, http.StatusForbidden)
+		return comment, false
+	}
+	return comment, true
+}
+
+func GetComments(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	var total int64
+	db.Model(&models.Comment{}).Where("task_id = ?", task.ID).Count(&total)
+	comments := []models.Comment{}
+	if err := db.Where("task_id = ?", task.ID).Order("created_at asc, id asc").
+		Offset((page - 1) * limit).Limit(limit).Find(&comments).Error; err != nil {
+		log.Printf("Error listing comments on task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to list comments"}`, http.StatusInternalServerError)
+		return
+	}
+	renderComments(comments)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"comments": comments,
+		"page":     page,
+		"limit":    limit,
+		"total":    total,
+	})
+}
+
+func CreateComment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	body, ok := validCommentBody(w, input.Body)
+	if !ok {
+		return
+	}
+
+	comment := models.Comment{
+		TaskID:    task.ID,
+		UserID:    userID,
+		Body:      body,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		return notifyMentions(tx, task, comment, "")
+	}); err != nil {
+		log.Printf("Error creating comment on task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to create comment"}`, http.StatusInternalServerError)
+		return
+	}
+	comment.BodyHTML = markdown.Render(comment.Body)
+
+	log.Printf("Comment %d created on task %d by user_id %d", comment.ID, task.ID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// UpdateComment replaces a comment's body, keeping the old one in its
+// history. Users newly mentioned by the edit are notified.
+func UpdateComment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := loadComment(w, r, userID, task, true)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	body, ok := validCommentBody(w, input.Body)
+	if !ok {
+		return
+	}
+
+	if body != comment.Body {
+		previous := comment.Body
+		now := time.Now()
+		if err := db.Transaction(func(tx *gorm.DB) error {
+			revision := models.CommentRevision{CommentID: comment.ID, Body: previous, CreatedAt: now}
+			if err := tx.Create(&revision).Error; err != nil {
+				return err
+			}
+			comment.Body = body
+			comment.EditedAt = &now
+			comment.UpdatedAt = now
+			if err := tx.Model(&comment).Updates(map[string]interface{}{
+				"body": body, "edited_at": now, "updated_at": now,
+			}).Error; err != nil {
+				return err
+			}
+			return notifyMentions(tx, task, comment, previous)
+		}); err != nil {
+			log.Printf("Error updating comment %d on task %d: %v", comment.ID, task.ID, err)
+			http.Error(w, `{"error": "Failed to update comment"}`, http.StatusInternalServerError)
+			return
+		}
+		log.Printf("Comment %d on task %d edited by user_id %d", comment.ID, task.ID, userID)
+	}
+	comment.BodyHTML = markdown.Render(comment.Body)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := loadComment(w, r, userID, task, true)
+	if !ok {
+		return
+	}
+
+	if err := db.Delete(&comment).Error; err != nil {
+		log.Printf("Error deleting comment %d on task %d: %v", comment.ID, task.ID, err)
+		http.Error(w, `{"error": "Failed to delete comment"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Comment %d on task %d deleted by user_id %d", comment.ID, task.ID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted"})
+}
+
+// GetCommentHistory lists the earlier bodies of a comment, oldest first.
+func GetCommentHistory(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := loadComment(w, r, userID, task, false)
+	if !ok {
+		return
+	}
+
+	revisions := []models.CommentRevision{}
+	if err := db.Where("comment_id = ?", comment.ID).Order("created_at asc, id asc").Find(&revisions).Error; err != nil {
+		log.Printf("Error listing revisions of comment %d: %v", comment.ID, err)
+		http.Error(w, `{"error": "Failed to load comment history"}`, http.StatusInternalServerError)
+		return
+	}
+	for i := range revisions {
+		revisions[i].BodyHTML = markdown.Render(revisions[i].Body)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"comment_id": comment.ID, "revisions": revisions})
+}
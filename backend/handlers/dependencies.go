@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/models"
+)
+
+// upstreamCTE is a recursive query over every open task that, directly or
+// through other open tasks, blocks the task ID bound to it.
+const upstreamCTE = `WITH RECURSIVE upstream (task_id, blocker_id) AS (
+	SELECT task_dependencies.task_id, task_dependencies.blocker_id FROM task_dependencies
+	JOIN tasks ON tasks.id = task_dependencies.blocker_id
+	WHERE task_dependencies.task_id = ? AND tasks.status_category <> ? AND tasks.deleted_at IS NULL
+	UNION
+	SELECT task_dependencies.task_id, task_dependencies.blocker_id FROM task_dependencies
+	JOIN upstream ON task_dependencies.task_id = upstream.blocker_id
+	JOIN tasks ON tasks.id = task_dependencies.blocker_id
+	WHERE tasks.status_category <> ? AND tasks.deleted_at IS NULL
+) `
+
+// openBlockers returns the tasks directly blocking taskID that are not yet
+// completed.
+func openBlockers(taskID int) ([]models.Task, error) {
+	var blockers []models.Task
+	err := db.Where("id IN (?) AND status_category <> ?",
+		db.Model(&models.TaskDependency{}).Select("blocker_id").Where("task_id = ?", taskID), models.CategoryDone).
+		Order("id asc").Find(&blockers).Error
+	return blockers, err
+}
+
+// blocks reports whether taskID is blocked, directly or transitively, by
+// blockerID, open or not.
+func blocks(blockerID, taskID int) (bool, error) {
+	var count int64
+	err := db.Raw(`WITH RECURSIVE reachable (id) AS (
+		SELECT blocker_id FROM task_dependencies WHERE task_id = ?
+		UNION
+		SELECT task_dependencies.blocker_id FROM task_dependencies
+		JOIN reachable ON task_dependencies.task_id = reachable.id
+	) SELECT COUNT(*) FROM reachable WHERE id = ?`, taskID, blockerID).Scan(&count).Error
+	return count > 0, err
+}
+
+// taskIDList formats IDs for an error message.
+func taskIDList(tasks []models.Task) string {
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = strconv.Itoa(task.ID)
+	}
+	return strings.Join(ids, ", ")
+}
+
+func GetBlockers(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	blockers := []models.Task{}
+	if err := preloadTags(db).Where("id IN (?)",
+		db.Model(&models.TaskDependency{}).Select("blocker_id").Where("task_id = ?", task.ID)).
+		Order("id asc").Find(&blockers).Error; err != nil {
+		log.Printf("Error listing blockers of task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to list blockers"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"blockers": blockers})
+}
+
+func AddBlocker(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		BlockerID int `json:"blocker_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.BlockerID == task.ID {
+		http.Error(w, `{"error": "A task cannot block itself"}`, http.StatusBadRequest)
+		return
+	}
+	var blocker models.Task
+	if err := db.Where("id = ? AND user_id = ?", input.BlockerID, int(userID)).First(&blocker).Error; err != nil {
+		log.Printf("Blocker not found for user_id %d: ID=%d, error=%v", userID, input.BlockerID, err)
+		http.Error(w, `{"error": "Blocking task not found"}`, http.StatusBadRequest)
+		return
+	}
+
+	var existing int64
+	db.Model(&models.TaskDependency{}).Where("task_id = ? AND blocker_id = ?", task.ID, blocker.ID).Count(&existing)
+	if existing > 0 {
+		http.Error(w, `{"error": "Task is already blocked by that task"}`, http.StatusConflict)
+		return
+	}
+	// The new edge closes a cycle if the task already blocks its blocker
+	cycle, err := blocks(task.ID, blocker.ID)
+	if err != nil {
+		log.Printf("Error checking dependency cycle between %d and %d: %v", task.ID, blocker.ID, err)
+		http.Error(w, `{"error": "Failed to add blocker"}`, http.StatusInternalServerError)
+		return
+	}
+	if cycle {
+		http.Error(w, fmt.Sprintf(`{"error": "Task %d already depends on task %d; adding this blocker would create a cycle"}`, blocker.ID, task.ID), http.StatusConflict)
+		return
+	}
+
+	dependency := models.TaskDependency{
+		UserID:    userID,
+		TaskID:    task.ID,
+		BlockerID: blocker.ID,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&dependency).Error; err != nil {
+		log.Printf("Error adding blocker %d to task %d: %v", blocker.ID, task.ID, err)
+		http.Error(w, `{"error": "Failed to add blocker"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Task %d now blocked by task %d for user_id %d", task.ID, blocker.ID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(dependency)
+}
+
+func RemoveBlocker(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	blockerID, err := strconv.Atoi(mux.Vars(r)["blocker_id"])
+	if err != nil {
+		log.Printf("Invalid blocker ID: %v", err)
+		http.Error(w, `{"error": "Invalid blocker ID"}`, http.StatusBadRequest)
+		return
+	}
+	result := db.Where("task_id = ? AND blocker_id = ?", task.ID, blockerID).Delete(&models.TaskDependency{})
+	if result.Error != nil {
+		log.Printf("Error removing blocker %d from task %d: %v", blockerID, task.ID, result.Error)
+		http.Error(w, `{"error": "Failed to remove blocker"}`, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, `{"error": "Blocker not found"}`, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Task %d no longer blocked by task %d for user_id %d", task.ID, blockerID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Blocker removed"})
+}
+
+// criticalStep is one task on a critical path. Late marks a task due after
+// the task it blocks, which cannot then start on time.
+type criticalStep struct {
+	models.Task
+	Late bool `json:"late"`
+}
+
+// longerChain reports whether chain a should be preferred over chain b:
+// more open tasks first, then the chain whose first task is due earlier.
+func longerChain(a, b []models.Task) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	if len(a) == 0 || a[0].DueDate == nil {
+		return false
+	}
+	return b[0].DueDate == nil || a[0].DueDate.Before(*b[0].DueDate)
+}
+
+// GetCriticalPath returns the longest chain of open blockers leading up to
+// a task, ending with the task itself. Nothing on the chain can start
+// before the task ahead of it is completed, so it is what decides when the
+// task can start.
+func GetCriticalPath(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	var edges []models.TaskDependency
+	if err := db.Raw(upstreamCTE+"SELECT task_id, blocker_id FROM upstream", task.ID, models.CategoryDone, models.CategoryDone).
+		Scan(&edges).Error; err != nil {
+		log.Printf("Error loading dependencies of task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to compute critical path"}`, http.StatusInternalServerError)
+		return
+	}
+	blockersOf := map[int][]int{}
+	ids := []int{task.ID}
+	for _, edge := range edges {
+		blockersOf[edge.TaskID] = append(blockersOf[edge.TaskID], edge.BlockerID)
+		ids = append(ids, edge.BlockerID)
+	}
+	var tasks []models.Task
+	if err := db.Where("id IN ?", ids).Find(&tasks).Error; err != nil {
+		log.Printf("Error loading dependencies of task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to compute critical path"}`, http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[int]models.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+
+	// The dependency graph is acyclic, so the longest chain ending at each
+	// task can be memoized
+	longest := map[int][]models.Task{}
+	var chainTo func(id int) []models.Task
+	chainTo = func(id int) []models.Task {
+		if chain, ok := longest[id]; ok {
+			return chain
+		}
+		var best []models.Task
+		for _, blockerID := range blockersOf[id] {
+			if chain := chainTo(blockerID); longerChain(chain, best) {
+				best = chain
+			}
+		}
+		chain := append(append([]models.Task{}, best...), byID[id])
+		longest[id] = chain
+		return chain
+	}
+	chain := chainTo(task.ID)
+
+	path := make([]criticalStep, len(chain))
+	for i, t := range chain {
+		path[i].Task = t
+		if i+1 < len(chain) {
+			next := chain[i+1]
+			path[i].Late = t.DueDate != nil && next.DueDate != nil && t.DueDate.After(*next.DueDate)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"task_id": task.ID,
+		"length":  len(path),
+		"path":    path,
+	})
+}
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/dataexport"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/mailer"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
+)
+
+const exportDownloadTokenType = "export_download"
+
+var errInvalidDownloadToken = errors.New("invalid or expired download link")
+
+// exportResponse adds a download link to ready exports
+type exportResponse struct {
+	models.DataExport
+	DownloadURL string `json:"download_url,omitempty"`
+}
+
+// newExportDownloadURL returns a link to export that works without a
+// bearer token, so it can be opened in a browser or mailed. It stops
+// working when the archive expires or the user signs out everywhere.
+func newExportDownloadURL(export models.DataExport) (string, error) {
+	jti, err := secure.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	token, err := keyring.Sign(jwt.MapClaims{
+		"typ":       exportDownloadTokenType,
+		"jti":       jti,
+		"user_id":   float64(export.UserID),
+		"export_id": float64(export.ID),
+		"iat":       float64(time.Now().UnixNano()) / 1e9,
+		"exp":       export.ExpiresAt.Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(config.AppConfig.APIBaseURL, "/") + "/exports/download?token=" + url.QueryEscape(token), nil
+}
+
+func parseExportDownloadToken(tokenStr string) (userID, exportID uint, err error) {
+	token, err := jwt.Parse(tokenStr, keyring.Keyfunc)
+	if err != nil || !token.Valid {
+		return 0, 0, errInvalidDownloadToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != exportDownloadTokenType {
+		return 0, 0, errInvalidDownloadToken
+	}
+	uid, _ := claims["user_id"].(float64)
+	eid, _ := claims["export_id"].(float64)
+	jti, _ := claims["jti"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	if uid == 0 || eid == 0 || revocation.IsRevoked(jti, uint(uid), time.Unix(0, int64(issuedAt*1e9))) {
+		return 0, 0, errInvalidDownloadToken
+	}
+	return uint(uid), uint(eid), nil
+}
+
+func toExportResponse(export models.DataExport) exportResponse {
+	response := exportResponse{DataExport: export}
+	if export.Status == models.ExportReady && export.ExpiresAt != nil && time.Now().Before(*export.ExpiresAt) {
+		link, err := newExportDownloadURL(export)
+		if err != nil {
+			log.Printf("Error creating download link for data export %d: %v", export.ID, err)
+		}
+		response.DownloadURL = link
+	}
+	return response
+}
+
+// sendExportReadyEmail mails user the download link for a finished export
+func sendExportReadyEmail(user models.User, export models.DataExport) error {
+	link, err := newExportDownloadURL(export)
+	if err != nil {
+		return err
+	}
+	return sendMail(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Your GoTasker data export is ready",
+		Body: fmt.Sprintf("Hi %s,\n\nThe copy of your GoTasker data you asked for is ready. Download it here:\n\n%s\n\n"+
+			"The link expires in %s. If you did not ask for this export, change your password.\n",
+			user.Username, link, config.AppConfig.ExportTTL),
+	})
+}
+
+func RequestDataExport(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := dataexport.Request(user.ID, func(done models.DataExport) {
+		if done.Status != models.ExportReady {
+			return
+		}
+		if err := sendExportReadyEmail(user, done); err != nil {
+			log.Printf("Error sending data export email to user_id %d: %v", user.ID, err)
+		}
+	})
+	if errors.Is(err, dataexport.ErrInProgress) {
+		http.Error(w, `{"error": "An export is already in progress"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error requesting data export for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to start export"}`, http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, audit.DataExported, user.ID, fmt.Sprintf("export=%d", export.ID))
+
+	log.Printf("Data export %d requested for user_id %d", export.ID, user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(export)
+}
+
+func GetDataExports(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var exports []models.DataExport
+	if err := db.Where("user_id = ?", userID).Order("created_at desc").Find(&exports).Error; err != nil {
+		log.Printf("Error listing data exports for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to list exports"}`, http.StatusInternalServerError)
+		return
+	}
+	response := make([]exportResponse, len(exports))
+	for i, export := range exports {
+		response[i] = toExportResponse(export)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"exports": response})
+}
+
+func GetDataExport(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Invalid export ID: %v", err)
+		http.Error(w, `{"error": "Invalid export ID"}`, http.StatusBadRequest)
+		return
+	}
+	var export models.DataExport
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&export).Error; err != nil {
+		log.Printf("Export not found or not owned: ID=%d, user_id=%d, error=%v", id, userID, err)
+		http.Error(w, `{"error": "Export not found"}`, http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(toExportResponse(export))
+}
+
+// DownloadDataExport serves a finished archive to the holder of a download
+// link. Range requests are supported so large downloads can resume.
+func DownloadDataExport(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, exportID, err := parseExportDownloadToken(r.URL.Query().Get("token"))
+	if err != nil {
+		http.Error(w, `{"error": "Invalid or expired download link"}`, http.StatusUnauthorized)
+		return
+	}
+	var export models.DataExport
+	if err := db.Where("id = ? AND user_id = ?", exportID, userID).First(&export).Error; err != nil ||
+		export.Status != models.ExportReady || export.ExpiresAt == nil || time.Now().After(*export.ExpiresAt) {
+		http.Error(w, `{"error": "Export is no longer available"}`, http.StatusGone)
+		return
+	}
+
+	f, err := os.Open(export.FilePath)
+	if err != nil {
+		log.Printf("Error opening data export %d: %v", export.ID, err)
+		http.Error(w, `{"error": "Export is no longer available"}`, http.StatusGone)
+		return
+	}
+	defer f.Close()
+
+	name := fmt.Sprintf("gotasker-export-%s.zip", export.CreatedAt.UTC().Format("20060102"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "private, no-store")
+	http.ServeContent(w, r, name, export.CreatedAt, f)
+}
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/harip/GoTasker/keyring"
+)
+
+// JWKS publishes the public signing keys so other services can verify
+// GoTasker tokens without sharing a secret.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keyring.JWKS())
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/clientip"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/lockout"
+	"github.com/harip/GoTasker/mailer"
+	"github.com/harip/GoTasker/models"
+)
+
+// rejectThrottledLogin answers 429 and returns true if username or the
+// client address must wait before trying again.
+func rejectThrottledLogin(w http.ResponseWriter, r *http.Request, username string) bool {
+	wait, locked := lockout.Check(username, clientip.FromRequest(r))
+	if wait <= 0 {
+		return false
+	}
+	audit.Record(r, audit.LoginThrottled, 0, "username="+username)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if locked {
+		http.Error(w, `{"error": "Too many failed login attempts. The account is temporarily locked; check your email to unlock it"}`, http.StatusTooManyRequests)
+		return true
+	}
+	http.Error(w, `{"error": "Too many failed login attempts, try again later"}`, http.StatusTooManyRequests)
+	return true
+}
+
+// recordLoginFailure counts a failed password or second-factor attempt and,
+// if it locked the account, mails the owner an unlock link. user is nil for
+// unknown usernames, which are throttled all the same.
+func recordLoginFailure(r *http.Request, event, username string, user *models.User) {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+	audit.Record(r, event, userID, "username="+username)
+
+	account, client := lockout.RecordFailure(username, clientip.FromRequest(r))
+	if client.Locked {
+		audit.Record(r, audit.AccountLocked, 0, "ip="+clientip.FromRequest(r))
+	}
+	if !account.Locked {
+		return
+	}
+	audit.Record(r, audit.AccountLocked, userID, "username="+username)
+	if user == nil {
+		return
+	}
+	if err := sendUnlockEmail(*user); err != nil {
+		log.Printf("Error sending unlock email to user_id %d: %v", user.ID, err)
+	}
+}
+
+// sendUnlockEmail mails user a link that lifts a login lockout early
+func sendUnlockEmail(user models.User) error {
+	token, err := createUserToken(user.ID, models.TokenPurposeAccountUnlock, config.AppConfig.AccountUnlockTTL)
+	if err != nil {
+		return err
+	}
+	return sendMail(mailer.Message{
+		To:      []string{user.Email},
+		Subject: "Your GoTasker account has been locked",
+		Body: fmt.Sprintf("Hi %s,\n\nWe locked your GoTasker account for %s after %d failed sign-in attempts. "+
+			"If that was you, open this link to unlock it now:\n\n%s\n\n"+
+			"If it was not you, your password is still safe, but consider changing it.\n",
+			user.Username, config.AppConfig.LoginLockoutDuration, config.AppConfig.LoginMaxFailures,
+			appLink("/unlock-account", token)),
+	})
+}
+
+func UnlockAccount(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Token == "" {
+		http.Error(w, `{"error": "Token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	token, err := consumeUserToken(input.Token, models.TokenPurposeAccountUnlock)
+	if err != nil {
+		log.Printf("Account unlock with invalid token: %v", err)
+		http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusBadRequest)
+		return
+	}
+	var user models.User
+	if err := db.First(&user, token.UserID).Error; err != nil {
+		log.Printf("User not found for unlock token: user_id %d, error=%v", token.UserID, err)
+		http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusBadRequest)
+		return
+	}
+
+	lockout.Reset(user.Username)
+	audit.Record(r, audit.AccountUnlocked, user.ID, "via=email")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Account unlocked"})
+}
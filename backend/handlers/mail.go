@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/harip/GoTasker/mailer"
+)
+
+var mail mailer.Mailer
+
+// SetMailer sets the mailer used for account emails
+func SetMailer(m mailer.Mailer) {
+	mail = m
+}
+
+// sendMail delivers msg, logging instead of failing when no mailer is set
+func sendMail(msg mailer.Message) error {
+	if mail == nil {
+		log.Printf("Warning: No mailer configured, dropping email %q to %v", msg.Subject, msg.To)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return mail.Send(ctx, msg)
+}
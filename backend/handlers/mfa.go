@@ -0,0 +1,444 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/lockout"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
+	"github.com/harip/GoTasker/totp"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+)
+
+const (
+	mfaPendingTokenType = "mfa_pending"
+	recoveryCodeCount   = 10
+	maxMFAAttempts      = 5
+	// totpSkew accepts the previous and next code to allow for clock drift
+	totpSkew = 1
+)
+
+var errInvalidMFAToken = errors.New("invalid mfa token")
+
+// mfaAttempts counts failed codes per pending token so the six-digit space
+// cannot be brute-forced within the token's lifetime.
+var mfaAttempts = cache.New(10*time.Minute, 10*time.Minute)
+
+// newMFAPendingToken returns a short-lived token that proves the password
+// step succeeded. RequireLogin refuses it; it can only be exchanged at
+// /login/mfa.
+func newMFAPendingToken(user models.User) (string, error) {
+	jti, err := secure.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return keyring.Sign(jwt.MapClaims{
+		"typ":     mfaPendingTokenType,
+		"jti":     jti,
+		"user_id": float64(user.ID),
+		"iat":     now.Unix(),
+		"exp":     now.Add(config.AppConfig.MFATokenTTL).Unix(),
+	})
+}
+
+func parseMFAPendingToken(tokenStr string) (userID uint, jti string, expiresAt time.Time, err error) {
+	token, err := jwt.Parse(tokenStr, keyring.Keyfunc)
+	if err != nil || !token.Valid {
+		return 0, "", time.Time{}, errInvalidMFAToken
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != mfaPendingTokenType {
+		return 0, "", time.Time{}, errInvalidMFAToken
+	}
+	id, _ := claims["user_id"].(float64)
+	jti, _ = claims["jti"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	exp, _ := claims["exp"].(float64)
+	if id == 0 || jti == "" || revocation.IsRevoked(jti, uint(id), time.Unix(int64(issuedAt), 0)) {
+		return 0, "", time.Time{}, errInvalidMFAToken
+	}
+	return uint(id), jti, time.Unix(int64(exp), 0), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the
+// new plaintext codes, formatted as xxxxx-xxxxx.
+func generateRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 8)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		// Lowercase base32 avoids characters that are easy to misread
+		code := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw))[:10]
+		record := models.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  secure.HashToken(code),
+			CreatedAt: time.Now(),
+		}
+		if err := tx.Create(&record).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code[:5]+"-"+code[5:])
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code that has not been
+// used before or an unused recovery code, consuming whichever matched.
+func verifySecondFactor(user models.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), totpSkew)
+		if !ok || step <= user.TOTPLastStep {
+			return false
+		}
+		result := db.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			UpdateColumn("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	if recoveryCode != "" {
+		result := db.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, secure.HashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error == nil && result.RowsAffected == 1 {
+			log.Printf("Recovery code used for user_id %d", user.ID)
+			return true
+		}
+	}
+	return false
+}
+
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		http.Error(w, `{"error": "Two-factor authentication is already enabled"}`, http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Printf("Error generating TOTP secret: %v", err)
+		http.Error(w, `{"error": "Failed to start enrollment"}`, http.StatusInternalServerError)
+		return
+	}
+	// The secret stays pending until a code generated from it is confirmed
+	if err := db.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+		log.Printf("Error storing TOTP secret for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to start enrollment"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("TOTP enrollment started for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": totp.URI(config.AppConfig.TOTPIssuer, user.Username, secret),
+	})
+}
+
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		http.Error(w, `{"error": "Two-factor authentication is already enabled"}`, http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, `{"error": "Start enrollment first"}`, http.StatusBadRequest)
+		return
+	}
+	step, ok := totp.Validate(user.TOTPSecret, input.Code, time.Now(), totpSkew)
+	if !ok {
+		log.Printf("Invalid TOTP confirmation code for user_id %d", user.ID)
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusBadRequest)
+		return
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error; err != nil {
+			return err
+		}
+		var err error
+		codes, err = generateRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		log.Printf("Error enabling TOTP for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to enable two-factor authentication"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("TOTP enabled for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		http.Error(w, `{"error": "Two-factor authentication is not enabled"}`, http.StatusConflict)
+		return
+	}
+	if match, err := password.Verify(input.Password, user.Password); err != nil || !match {
+		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	if !verifySecondFactor(user, input.Code, input.RecoveryCode) {
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		log.Printf("Error disabling TOTP for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to disable two-factor authentication"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("TOTP disabled for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+func RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		http.Error(w, `{"error": "Two-factor authentication is not enabled"}`, http.StatusConflict)
+		return
+	}
+	if !verifySecondFactor(user, input.Code, "") {
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	}
+
+	codes, err := generateRecoveryCodes(db, user.ID)
+	if err != nil {
+		log.Printf("Error regenerating recovery codes for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to regenerate recovery codes"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Recovery codes regenerated for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"recovery_codes": codes})
+}
+
+// LoginMFA exchanges the pending token from Login plus a TOTP or recovery
+// code for a normal access and refresh token pair, or a session cookie.
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+		Session      string `json:"session"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if !isValidSessionMode(input.Session) {
+		http.Error(w, `{"error": "Session must be bearer or cookie"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Code == "" && input.RecoveryCode == "" {
+		http.Error(w, `{"error": "Code or recovery code is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	userID, jti, expiresAt, err := parseMFAPendingToken(input.MFAToken)
+	if err != nil {
+		log.Printf("Invalid MFA token: %v", err)
+		http.Error(w, `{"error": "Invalid or expired MFA token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, userID).Error; err != nil || user.TOTPEnabledAt == nil || user.DisabledAt != nil {
+		log.Printf("MFA login for unknown or non-MFA user_id %d", userID)
+		http.Error(w, `{"error": "Invalid or expired MFA token"}`, http.StatusUnauthorized)
+		return
+	}
+
+	if rejectThrottledLogin(w, r, user.Username) {
+		return
+	}
+	if !verifySecondFactor(user, input.Code, input.RecoveryCode) {
+		recordLoginFailure(r, audit.MFAFailed, user.Username, &user)
+		attempts, err := mfaAttempts.IncrementInt(jti, 1)
+		if err != nil {
+			mfaAttempts.Set(jti, 1, cache.DefaultExpiration)
+			attempts = 1
+		}
+		if attempts >= maxMFAAttempts {
+			log.Printf("Too many MFA attempts for user_id %d, revoking pending token", user.ID)
+			revocation.Revoke(jti, user.ID, expiresAt)
+		}
+		log.Printf("Invalid MFA code for user_id %d", user.ID)
+		http.Error(w, `{"error": "Invalid code"}`, http.StatusUnauthorized)
+		return
+	}
+
+	// The pending token is single-use
+	if err := revocation.Revoke(jti, user.ID, expiresAt); err != nil {
+		log.Printf("Error revoking MFA token for user_id %d: %v", user.ID, err)
+	}
+	mfaAttempts.Delete(jti)
+
+	response, err := loginResponse(w, r, user, input.Session)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	lockout.Reset(user.Username)
+	audit.Record(r, audit.LoginSucceeded, user.ID, "mfa=true")
+
+	log.Printf("MFA login successful for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
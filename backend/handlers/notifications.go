@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+)
+
+// GetNotifications lists the user's inbox, newest first.
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit < 1 || limit > 50 {
+		limit = 20
+	}
+
+	dbQuery := db.Model(&models.Notification{}).Where("user_id = ?", userID)
+	if query.Get("unread") == "true" {
+		dbQuery = dbQuery.Where("read_at IS NULL")
+	}
+	notifications := []models.Notification{}
+	if err := dbQuery.Order("created_at desc, id desc").Offset((page - 1) * limit).Limit(limit).
+		Find(&notifications).Error; err != nil {
+		log.Printf("Error listing notifications for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to list notifications"}`, http.StatusInternalServerError)
+		return
+	}
+	var unread int64
+	db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID).Count(&unread)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"notifications": notifications,
+		"unread":        unread,
+		"page":          page,
+		"limit":         limit,
+	})
+}
+
+// MarkNotificationRead marks one inbox entry, or all of them when no ID is
+// given, as read.
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	dbQuery := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userID)
+	if key, ok := mux.Vars(r)["id"]; ok {
+		id, err := strconv.Atoi(key)
+		if err != nil {
+			http.Error(w, `{"error": "Invalid notification ID"}`, http.StatusBadRequest)
+			return
+		}
+		var count int64
+		db.Model(&models.Notification{}).Where("id = ? AND user_id = ?", id, userID).Count(&count)
+		if count == 0 {
+			http.Error(w, `{"error": "Notification not found"}`, http.StatusNotFound)
+			return
+		}
+		dbQuery = dbQuery.Where("id = ?", id)
+	}
+	result := dbQuery.Update("read_at", time.Now())
+	if result.Error != nil {
+		log.Printf("Error marking notifications read for user_id %d: %v", userID, result.Error)
+		http.Error(w, `{"error": "Failed to update notifications"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int64{"marked_read": result.RowsAffected})
+}
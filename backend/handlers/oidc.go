@@ -0,0 +1,399 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/oidc"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie    = "gotasker_oidc"
+	oidcStateTokenType = "oidc_state"
+	oidcStateTTL       = 10 * time.Minute
+	maxUsernameLength  = 50
+)
+
+var (
+	errOIDCEmailUnverified = errors.New("identity provider did not verify the email address")
+	errOIDCNoAccount       = errors.New("no account for this email and provisioning is disabled")
+)
+
+var usernameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+var oidcProvider *oidc.Provider
+
+// SetOIDCProvider enables single sign-on through provider. Passing nil
+// disables the /auth/oidc routes.
+func SetOIDCProvider(provider *oidc.Provider) {
+	oidcProvider = provider
+}
+
+// OIDCLogin starts the authorization code flow. State, nonce and the PKCE
+// verifier travel in a short-lived signed cookie so the callback can be
+// served by any replica and is bound to the browser that started the login.
+func OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.Error(w, `{"error": "Single sign-on is not configured"}`, http.StatusNotFound)
+		return
+	}
+
+	state, err := secure.RandomToken(16)
+	if err != nil {
+		log.Printf("Error generating OIDC state: %v", err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	nonce, err := secure.RandomToken(16)
+	if err != nil {
+		log.Printf("Error generating OIDC nonce: %v", err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	pkce, err := oidc.NewPKCE()
+	if err != nil {
+		log.Printf("Error generating PKCE verifier: %v", err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := oidcProvider.AuthCodeURL(r.Context(), state, nonce, pkce)
+	if err != nil {
+		log.Printf("Error building OIDC authorization URL: %v", err)
+		http.Error(w, `{"error": "Identity provider unavailable"}`, http.StatusBadGateway)
+		return
+	}
+
+	now := time.Now()
+	cookieValue, err := keyring.Sign(jwt.MapClaims{
+		"typ":           oidcStateTokenType,
+		"state":         state,
+		"nonce":         nonce,
+		"code_verifier": pkce.Verifier,
+		"iat":           now.Unix(),
+		"exp":           now.Add(oidcStateTTL).Unix(),
+	})
+	if err != nil {
+		log.Printf("Error signing OIDC state: %v", err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	setOIDCStateCookie(w, r, cookieValue, int(oidcStateTTL/time.Second))
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// setOIDCStateCookie is Lax rather than Strict because the callback is a
+// top-level navigation from the provider's site.
+func setOIDCStateCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || strings.HasPrefix(config.AppConfig.OIDCRedirectURL, "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// redirectToApp hands the result of the flow to the frontend in the URL
+// fragment, which browsers never send to a server.
+func redirectToApp(w http.ResponseWriter, r *http.Request, values url.Values) {
+	target := strings.TrimRight(config.AppConfig.AppBaseURL, "/") + "/auth/callback#" + values.Encode()
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+func redirectOIDCError(w http.ResponseWriter, r *http.Request, code string) {
+	redirectToApp(w, r, url.Values{"error": {code}})
+}
+
+func OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if oidcProvider == nil {
+		http.Error(w, `{"error": "Single sign-on is not configured"}`, http.StatusNotFound)
+		return
+	}
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	// The state cookie is single-use whatever the outcome
+	setOIDCStateCookie(w, r, "", -1)
+
+	query := r.URL.Query()
+	if providerError := query.Get("error"); providerError != "" {
+		log.Printf("OIDC provider returned error: %s %s", providerError, query.Get("error_description"))
+		redirectOIDCError(w, r, "access_denied")
+		return
+	}
+
+	nonce, verifier, ok := readOIDCState(r, query.Get("state"))
+	if !ok {
+		redirectOIDCError(w, r, "invalid_state")
+		return
+	}
+	code := query.Get("code")
+	if code == "" {
+		redirectOIDCError(w, r, "invalid_request")
+		return
+	}
+
+	tokens, err := oidcProvider.Exchange(r.Context(), code, verifier)
+	if err != nil {
+		log.Printf("Error exchanging OIDC code: %v", err)
+		redirectOIDCError(w, r, "login_failed")
+		return
+	}
+	idToken, err := oidcProvider.VerifyIDToken(r.Context(), tokens.IDToken, nonce)
+	if err != nil {
+		log.Printf("Error verifying OIDC ID token: %v", err)
+		redirectOIDCError(w, r, "login_failed")
+		return
+	}
+
+	user, err := resolveOIDCUser(r, idToken)
+	switch {
+	case errors.Is(err, errOIDCEmailUnverified):
+		redirectOIDCError(w, r, "email_not_verified")
+		return
+	case errors.Is(err, errOIDCNoAccount):
+		redirectOIDCError(w, r, "no_account")
+		return
+	case err != nil:
+		log.Printf("Error resolving OIDC user for subject %s: %v", idToken.Subject, err)
+		redirectOIDCError(w, r, "login_failed")
+		return
+	}
+
+	if user.DisabledAt != nil {
+		log.Printf("OIDC login for disabled user_id %d", user.ID)
+		redirectOIDCError(w, r, "account_disabled")
+		return
+	}
+
+	// A second factor configured in GoTasker still applies
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := newMFAPendingToken(user)
+		if err != nil {
+			log.Printf("Error generating MFA token: %v", err)
+			redirectOIDCError(w, r, "login_failed")
+			return
+		}
+		redirectToApp(w, r, url.Values{"mfa_required": {"true"}, "mfa_token": {mfaToken}})
+		return
+	}
+
+	issued, err := issueTokens(r, user)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		redirectOIDCError(w, r, "login_failed")
+		return
+	}
+	audit.Record(r, audit.LoginSucceeded, user.ID, "via=oidc")
+	log.Printf("OIDC login successful for user_id %d", user.ID)
+	redirectToApp(w, r, url.Values{
+		"token":         {issued.Token},
+		"refresh_token": {issued.RefreshToken},
+		"token_type":    {issued.TokenType},
+		"expires_at":    {issued.ExpiresAt},
+	})
+}
+
+// readOIDCState checks the state cookie against the state query parameter
+// and returns the nonce and PKCE verifier saved by OIDCLogin.
+func readOIDCState(r *http.Request, state string) (nonce, verifier string, ok bool) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" {
+		log.Printf("OIDC callback without state cookie or parameter")
+		return "", "", false
+	}
+	token, err := jwt.Parse(cookie.Value, keyring.Keyfunc)
+	if err != nil || !token.Valid {
+		log.Printf("Invalid OIDC state cookie: %v", err)
+		return "", "", false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != oidcStateTokenType {
+		return "", "", false
+	}
+	expected, _ := claims["state"].(string)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(state)) != 1 {
+		log.Printf("OIDC state mismatch")
+		return "", "", false
+	}
+	nonce, _ = claims["nonce"].(string)
+	verifier, _ = claims["code_verifier"].(string)
+	return nonce, verifier, nonce != "" && verifier != ""
+}
+
+// resolveOIDCUser finds the user linked to the identity, links an existing
+// user with the same verified email, or provisions a new one.
+func resolveOIDCUser(r *http.Request, id *oidc.IDToken) (models.User, error) {
+	var user models.User
+	var identity models.UserIdentity
+	err := db.Where("issuer = ? AND subject = ?", id.Issuer, id.Subject).First(&identity).Error
+	if err == nil {
+		if err := db.First(&user, identity.UserID).Error; err != nil {
+			return user, err
+		}
+		db.Model(&identity).Updates(map[string]interface{}{"last_login_at": time.Now(), "email": id.Email})
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	// Linking by email is only safe when the provider vouches for it
+	if id.Email == "" || !id.EmailVerified {
+		return user, errOIDCEmailUnverified
+	}
+
+	err = db.Where("LOWER(email) = LOWER(?)", id.Email).First(&user).Error
+	switch {
+	case err == nil:
+		return user, linkOIDCIdentity(r, user, id)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return user, err
+	case !config.AppConfig.OIDCAutoProvision:
+		return user, errOIDCNoAccount
+	}
+	return provisionOIDCUser(r, id)
+}
+
+func newUserIdentity(userID uint, id *oidc.IDToken) models.UserIdentity {
+	now := time.Now()
+	return models.UserIdentity{
+		UserID:      userID,
+		Issuer:      id.Issuer,
+		Subject:     id.Subject,
+		Email:       id.Email,
+		LastLoginAt: now,
+		CreatedAt:   now,
+	}
+}
+
+// linkOIDCIdentity attaches the identity to an existing user. If that user
+// never proved they own the email, whoever registered it may not be its
+// owner, so their password and sessions are discarded.
+func linkOIDCIdentity(r *http.Request, user models.User, id *oidc.IDToken) error {
+	unverified := user.EmailVerifiedAt == nil
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if unverified {
+			hashed, err := unusablePassword()
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"password":          hashed,
+				"email_verified_at": time.Now(),
+			}).Error; err != nil {
+				return err
+			}
+		}
+		identity := newUserIdentity(user.ID, id)
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return err
+	}
+	if unverified {
+		if err := revokeUserSessions(user.ID); err != nil {
+			log.Printf("Error revoking sessions for user_id %d after OIDC link: %v", user.ID, err)
+		}
+	}
+	audit.Record(r, audit.IdentityLinked, user.ID, "issuer="+id.Issuer)
+	return nil
+}
+
+func provisionOIDCUser(r *http.Request, id *oidc.IDToken) (models.User, error) {
+	hashed, err := unusablePassword()
+	if err != nil {
+		return models.User{}, err
+	}
+	base := id.PreferredUsername
+	if base == "" {
+		base = strings.SplitN(id.Email, "@", 2)[0]
+	}
+	username, err := availableUsername(base)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	now := time.Now()
+	user := models.User{
+		Username:        username,
+		Email:           id.Email,
+		Password:        hashed,
+		Role:            models.RoleMember,
+		EmailVerifiedAt: &now,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		identity := newUserIdentity(user.ID, id)
+		return tx.Create(&identity).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	audit.Record(r, audit.UserProvisioned, user.ID, "issuer="+id.Issuer)
+	log.Printf("Provisioned user %s from OIDC subject %s", user.Username, id.Subject)
+	return user, nil
+}
+
+// unusablePassword returns a hash of a random secret nobody knows, for users
+// who sign in through the identity provider only. They can still set a
+// password through the reset flow.
+func unusablePassword() (string, error) {
+	secret, err := secure.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	return password.Hash(secret)
+}
+
+// availableUsername derives a unique username from base, appending a
+// number if it is taken.
+func availableUsername(base string) (string, error) {
+	base = strings.Trim(usernameUnsafeChars.ReplaceAllString(base, ""), "._-")
+	if base == "" {
+		base = "user"
+	}
+	// Leave room for a numeric or random suffix
+	if len(base) > maxUsernameLength-6 {
+		base = base[:maxUsernameLength-6]
+	}
+	candidate := base
+	for i := 2; i < 100; i++ {
+		var count int64
+		if err := db.Unscoped().Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return candidate, nil
+		}
+		candidate = base + strconv.Itoa(i)
+	}
+	suffix, err := secure.RandomToken(3)
+	if err != nil {
+		return "", err
+	}
+	return base + "-" + strings.Trim(suffix, "-_"), nil
+}
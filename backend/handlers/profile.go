@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/notify"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/retention"
+	"gorm.io/gorm"
+)
+
+// loadCurrentUser returns the user the request's token belongs to, writing
+// an error response if there is none.
+func loadCurrentUser(w http.ResponseWriter, r *http.Request) (models.User, bool) {
+	var user models.User
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return user, false
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return user, false
+	}
+	if err := db.First(&user, userID).Error; err != nil {
+		log.Printf("User not found: ID=%d, error=%v", userID, err)
+		http.Error(w, `{"error": "User not found"}`, http.StatusNotFound)
+		return user, false
+	}
+	return user, true
+}
+
+// softDeleteUser marks user and everything they own as deleted. The rows
+// are erased for good by the retention job once the grace period passes.
+func softDeleteUser(tx *gorm.DB, user *models.User) error {
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Task{}).Error; err != nil {
+		return err
+	}
+	return tx.Delete(user).Error
+}
+
+func GetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func UpdateMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Username        *string `json:"username"`
+		Email           *string `json:"email"`
+		Timezone        *string `json:"timezone"`
+		WebhookURL      *string `json:"webhook_url"`
+		CurrentPassword string  `json:"current_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding profile update request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	emailChanged := false
+	if input.Username != nil && *input.Username != user.Username {
+		username := strings.TrimSpace(*input.Username)
+		if username == "" {
+			http.Error(w, `{"error": "Username is required"}`, http.StatusBadRequest)
+			return
+		}
+		if len(username) > maxUsernameLength {
+			http.Error(w, `{"error": "Username is too long"}`, http.StatusBadRequest)
+			return
+		}
+		// Soft-deleted accounts still hold their username until purged
+		var existing models.User
+		if err := db.Unscoped().Where("username = ? AND id <> ?", username, user.ID).First(&existing).Error; err == nil {
+			log.Printf("Username %s already exists", username)
+			http.Error(w, `{"error": "Username already taken"}`, http.StatusConflict)
+			return
+		}
+		updates["username"] = username
+	}
+	if input.Email != nil && *input.Email != user.Email {
+		email := strings.TrimSpace(*input.Email)
+		if email == "" {
+			http.Error(w, `{"error": "Email is required"}`, http.StatusBadRequest)
+			return
+		}
+		if !emailPattern.MatchString(email) {
+			log.Printf("Invalid email format: %s", email)
+			http.Error(w, `{"error": "Invalid email format"}`, http.StatusBadRequest)
+			return
+		}
+		// The email address is where password resets go, so changing it
+		// needs the same proof as changing the password.
+		if match, err := password.Verify(input.CurrentPassword, user.Password); err != nil || !match {
+			http.Error(w, `{"error": "Current password is incorrect"}`, http.StatusUnauthorized)
+			return
+		}
+		var existing models.User
+		if err := db.Unscoped().Where("email = ? AND id <> ?", email, user.ID).First(&existing).Error; err == nil {
+			log.Printf("Email %s already exists", email)
+			http.Error(w, `{"error": "Email already taken"}`, http.StatusConflict)
+			return
+		}
+		updates["email"] = email
+		updates["email_verified_at"] = nil
+		emailChanged = true
+	}
+	if input.Timezone != nil && *input.Timezone != user.Timezone {
+		// Recurring tasks are scheduled on the wall clock of this zone
+		if _, err := time.LoadLocation(*input.Timezone); err != nil || *input.Timezone == "" || *input.Timezone == "Local" {
+			http.Error(w, `{"error": "Timezone must be an IANA time zone such as Europe/Berlin"}`, http.StatusBadRequest)
+			return
+		}
+		updates["timezone"] = *input.Timezone
+	}
+	if input.WebhookURL != nil && *input.WebhookURL != user.WebhookURL {
+		// Reminders sent over the webhook channel are posted here
+		if *input.WebhookURL != "" && (len(*input.WebhookURL) > 512 || !notify.ValidWebhookURL(*input.WebhookURL)) {
+			http.Error(w, `{"error": "webhook_url must be an http or https URL"}`, http.StatusBadRequest)
+			return
+		}
+		updates["webhook_url"] = *input.WebhookURL
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&user).Updates(updates).Error; err != nil {
+			log.Printf("Error updating profile for user_id %d: %v", user.ID, err)
+			http.Error(w, `{"error": "Failed to update profile"}`, http.StatusInternalServerError)
+			return
+		}
+		if err := db.First(&user, user.ID).Error; err != nil {
+			log.Printf("Error reloading user_id %d: %v", user.ID, err)
+		}
+		audit.Record(r, audit.ProfileUpdated, user.ID, "")
+		log.Printf("Profile updated for user_id %d", user.ID)
+	}
+	if emailChanged {
+		if err := sendVerificationEmail(user); err != nil {
+			log.Printf("Error sending verification email to user_id %d: %v", user.ID, err)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+func ChangePassword(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding change password request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.NewPassword == "" {
+		http.Error(w, `{"error": "New password is required"}`, http.StatusBadRequest)
+		return
+	}
+	if match, err := password.Verify(input.CurrentPassword, user.Password); err != nil || !match {
+		log.Printf("Change password with wrong current password for user_id %d", user.ID)
+		http.Error(w, `{"error": "Current password is incorrect"}`, http.StatusUnauthorized)
+		return
+	}
+
+	hashed, err := password.Hash(input.NewPassword)
+	if err != nil {
+		log.Printf("Error hashing password: %v", err)
+		http.Error(w, `{"error": "Failed to change password"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := db.Model(&user).Update("password", hashed).Error; err != nil {
+		log.Printf("Error changing password for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to change password"}`, http.StatusInternalServerError)
+		return
+	}
+
+	// Every other session is signed out; the caller continues with the
+	// fresh credentials returned below, in the form it logged in with.
+	if err := revokeUserSessions(user.ID); err != nil {
+		log.Printf("Error revoking sessions for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to change password"}`, http.StatusInternalServerError)
+		return
+	}
+	mode := sessionModeBearer
+	if principal, ok := auth.FromContext(r.Context()); ok && principal.Method == auth.MethodSession {
+		mode = sessionModeCookie
+	}
+	response, err := loginResponse(w, r, user, mode)
+	if err != nil {
+		log.Printf("Error generating token: %v", err)
+		http.Error(w, `{"error": "Failed to generate token"}`, http.StatusInternalServerError)
+		return
+	}
+	audit.Record(r, audit.PasswordChanged, user.ID, "")
+
+	log.Printf("Password changed for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func DeleteMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := loadCurrentUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding delete account request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if match, err := password.Verify(input.Password, user.Password); err != nil || !match {
+		http.Error(w, `{"error": "Invalid credentials"}`, http.StatusUnauthorized)
+		return
+	}
+	if user.Role == models.RoleAdmin {
+		var others int64
+		db.Model(&models.User{}).
+			Where("role = ? AND disabled_at IS NULL AND id <> ?", models.RoleAdmin, user.ID).
+			Count(&others)
+		if others == 0 {
+			http.Error(w, `{"error": "At least one active admin is required"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return softDeleteUser(tx, &user)
+	}); err != nil {
+		log.Printf("Error deleting user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to delete account"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := revokeUserSessions(user.ID); err != nil {
+		log.Printf("Error revoking sessions for deleted user_id %d: %v", user.ID, err)
+	}
+	middleware.ForgetAccountStatus(user.ID)
+	audit.Record(r, audit.AccountDeleted, user.ID, "")
+
+	log.Printf("Account deleted for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":     "Account deleted",
+		"purge_after": retention.PurgeAt(time.Now()).UTC().Format(time.RFC3339),
+	})
+}
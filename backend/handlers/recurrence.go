@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/recurrence"
+	"github.com/harip/GoTasker/reminders"
+	"gorm.io/gorm"
+)
+
+// Values of the recurrence query parameter of UpdateTask, which decides
+// what completing an instance of a recurring task does to its series.
+const (
+	recurrenceNext = "next"
+	recurrenceStop = "stop"
+)
+
+const maxOccurrencePreview = 100
+
+// normalizeRecurrence validates an RRULE from a request and returns it in
+// canonical form, writing an error response if it is invalid.
+func normalizeRecurrence(w http.ResponseWriter, rule string, dueDate *time.Time) (string, bool) {
+	if rule == "" {
+		return "", true
+	}
+	parsed, err := recurrence.Parse(rule)
+	if err != nil {
+		log.Printf("Invalid task data: Recurrence=%s: %v", rule, err)
+		http.Error(w, `{"error": "Invalid recurrence rule"}`, http.StatusBadRequest)
+		return "", false
+	}
+	if dueDate == nil {
+		http.Error(w, `{"error": "A recurring task needs a due date"}`, http.StatusBadRequest)
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// userLocation returns the time zone recurring tasks of userID follow.
+func userLocation(userID uint) *time.Location {
+	var user models.User
+	if err := db.Select("id", "timezone").First(&user, userID).Error; err != nil {
+		log.Printf("Error loading timezone for user_id %d, using UTC: %v", userID, err)
+		return time.UTC
+	}
+	return user.Location()
+}
+
+// upcomingOccurrences lists up to n due dates of task's series after its
+// current one.
+func upcomingOccurrences(task models.Task, loc *time.Location, n int) ([]time.Time, error) {
+	rule, err := recurrence.Parse(task.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	start := task.RecurrenceStart
+	if start == nil {
+		start = task.DueDate
+	}
+	return rule.Between(*start, *task.DueDate, loc, n), nil
+}
+
+// createNextOccurrence creates the instance of a recurring series that
+// follows the completed task, in status initial, carrying the series' rule
+// on. It returns nil if the series has ended.
+func createNextOccurrence(tx *gorm.DB, completed models.Task, rule string, initial models.WorkflowStatus, loc *time.Location) (*models.Task, error) {
+	completed.Recurrence = rule
+	due, err := upcomingOccurrences(completed, loc, 1)
+	if err != nil || len(due) == 0 {
+		return nil, err
+	}
+
+	nextDue := due[0].UTC()
+	next := models.Task{
+		UserID:          completed.UserID,
+		ParentID:        completed.ParentID,
+		Title:           completed.Title,
+		Description:     completed.Description,
+		Status:          initial.Name,
+		StatusCategory:  initial.Category,
+		Priority:        completed.Priority,
+		DueDate:         &nextDue,
+		Tags:            completed.Tags,
+		Recurrence:      rule,
+		RecurrenceStart: completed.RecurrenceStart,
+		CreatedAt:       time.Now(),
+		UpdatedAt:       time.Now(),
+	}
+	if next.Tags == nil {
+		next.Tags = []models.Tag{}
+	}
+	// Omit the tag rows themselves; only the task_tags links are created
+	if err := tx.Omit("Tags.*").Create(&next).Error; err != nil {
+		return nil, err
+	}
+	if err := reminders.CopyOffsets(tx, completed, next); err != nil {
+		return nil, err
+	}
+	return &next, nil
+}
+
+// GetOccurrences previews the next due dates of a recurring task.
+func GetOccurrences(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+	if task.Recurrence == "" || task.DueDate == nil {
+		http.Error(w, `{"error": "Task does not recur"}`, http.StatusBadRequest)
+		return
+	}
+
+	count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+	if count < 1 {
+		count = 5
+	}
+	if count > maxOccurrencePreview {
+		count = maxOccurrencePreview
+	}
+
+	loc := userLocation(userID)
+	occurrences, err := upcomingOccurrences(task, loc, count)
+	if err != nil {
+		log.Printf("Error expanding recurrence of task %d: %v", task.ID, err)
+		http.Error(w, `{"error": "Invalid recurrence rule"}`, http.StatusInternalServerError)
+		return
+	}
+	dates := make([]string, len(occurrences))
+	for i, t := range occurrences {
+		dates[i] = t.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"recurrence":  task.Recurrence,
+		"timezone":    loc.String(),
+		"occurrences": dates,
+	})
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/reminders"
+)
+
+const (
+	maxRemindersPerTask = 10
+	maxReminderOffset   = 365 * 24 * 60
+)
+
+func isValidReminderChannel(channel string) bool {
+	for _, c := range models.ValidReminderChannels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+func GetReminders(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	list := []models.Reminder{}
+	if err := db.Where("task_id = ?", task.ID).Order("fire_at asc, id asc").Find(&list).Error; err != nil {
+		log.Printf("Error listing reminders of task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to list reminders"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reminders": list})
+}
+
+func CreateReminder(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		RemindAt      *time.Time `json:"remind_at"`
+		OffsetMinutes *int       `json:"offset_minutes"`
+		Channel       string     `json:"channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+
+	if (input.RemindAt == nil) == (input.OffsetMinutes == nil) {
+		http.Error(w, `{"error": "Give either remind_at or offset_minutes"}`, http.StatusBadRequest)
+		return
+	}
+	if input.RemindAt != nil && !input.RemindAt.After(time.Now()) {
+		http.Error(w, `{"error": "remind_at must be in the future"}`, http.StatusBadRequest)
+		return
+	}
+	if input.OffsetMinutes != nil {
+		if *input.OffsetMinutes < 0 || *input.OffsetMinutes > maxReminderOffset {
+			http.Error(w, `{"error": "offset_minutes must be between 0 and 525600"}`, http.StatusBadRequest)
+			return
+		}
+		if task.DueDate == nil {
+			http.Error(w, `{"error": "An offset reminder needs a task with a due date"}`, http.StatusBadRequest)
+			return
+		}
+	}
+	if input.Channel == "" {
+		input.Channel = models.ReminderInbox
+	} else if !isValidReminderChannel(input.Channel) {
+		http.Error(w, `{"error": "Channel must be one of `+strings.Join(models.ValidReminderChannels, ", ")+`"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Channel == models.ReminderWebhook {
+		var user models.User
+		if err := db.Select("id", "webhook_url").First(&user, userID).Error; err != nil || user.WebhookURL == "" {
+			http.Error(w, `{"error": "Set a webhook_url on your profile first"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	var count int64
+	db.Model(&models.Reminder{}).Where("task_id = ? AND status = ?", task.ID, models.ReminderPending).Count(&count)
+	if count >= maxRemindersPerTask {
+		http.Error(w, `{"error": "A task can have at most 10 pending reminders"}`, http.StatusConflict)
+		return
+	}
+
+	reminder := models.Reminder{
+		UserID:        userID,
+		TaskID:        task.ID,
+		Channel:       input.Channel,
+		RemindAt:      input.RemindAt,
+		OffsetMinutes: input.OffsetMinutes,
+		Status:        models.ReminderPending,
+		CreatedAt:     time.Now(),
+	}
+	reminder.FireAt = reminders.FireAt(reminder, task.DueDate)
+	if err := db.Create(&reminder).Error; err != nil {
+		log.Printf("Error creating reminder for task %d: %v", task.ID, err)
+		http.Error(w, `{"error": "Failed to create reminder"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Reminder %d created for task %d of user_id %d, firing at %v", reminder.ID, task.ID, userID, reminder.FireAt)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reminder)
+}
+
+func DeleteReminder(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	reminderID, err := strconv.Atoi(mux.Vars(r)["reminder_id"])
+	if err != nil {
+		log.Printf("Invalid reminder ID: %v", err)
+		http.Error(w, `{"error": "Invalid reminder ID"}`, http.StatusBadRequest)
+		return
+	}
+	result := db.Where("id = ? AND task_id = ?", reminderID, task.ID).Delete(&models.Reminder{})
+	if result.Error != nil {
+		log.Printf("Error deleting reminder %d of task %d: %v", reminderID, task.ID, result.Error)
+		http.Error(w, `{"error": "Failed to delete reminder"}`, http.StatusInternalServerError)
+		return
+	}
+	if result.RowsAffected == 0 {
+		http.Error(w, `{"error": "Reminder not found"}`, http.StatusNotFound)
+		return
+	}
+
+	log.Printf("Reminder %d of task %d deleted for user_id %d", reminderID, task.ID, userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Reminder deleted"})
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/clientip"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+)
+
+// maxUserAgentLength matches the user_agent column of sessions.
+const maxUserAgentLength = 255
+
+// Values of the "session" field on login requests.
+const (
+	sessionModeBearer = "bearer"
+	sessionModeCookie = "cookie"
+)
+
+// cookieSessionResponse is returned instead of tokens by a cookie-mode
+// login. The CSRF token must be sent back in the X-CSRF-Token header on
+// every state-changing request.
+type cookieSessionResponse struct {
+	Message   string `json:"message"`
+	CSRFToken string `json:"csrf_token"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+func isValidSessionMode(mode string) bool {
+	return mode == "" || mode == sessionModeBearer || mode == sessionModeCookie
+}
+
+func sessionCookieSameSite() http.SameSite {
+	switch strings.ToLower(config.AppConfig.SessionCookieSameSite) {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// setSessionCookies sets the HttpOnly session cookie and the readable CSRF
+// cookie. A maxAge below zero clears them.
+func setSessionCookies(w http.ResponseWriter, token, csrfToken string, maxAge int) {
+	sameSite := sessionCookieSameSite()
+	// Browsers drop SameSite=None cookies that are not Secure
+	secureCookie := config.AppConfig.SessionCookieSecure || sameSite == http.SameSiteNoneMode
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   config.AppConfig.SessionCookieDomain,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   secureCookie,
+		SameSite: sameSite,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookieName,
+		Value:    csrfToken,
+		Path:     "/",
+		Domain:   config.AppConfig.SessionCookieDomain,
+		MaxAge:   maxAge,
+		Secure:   secureCookie,
+		SameSite: sameSite,
+	})
+}
+
+// newSession describes a login from the client that sent r.
+func newSession(r *http.Request, userID uint, kind string, ttl time.Duration) models.Session {
+	userAgent := r.UserAgent()
+	if len(userAgent) > maxUserAgentLength {
+		userAgent = userAgent[:maxUserAgentLength]
+	}
+	now := time.Now()
+	return models.Session{
+		UserID:     userID,
+		Kind:       kind,
+		IP:         clientip.FromRequest(r),
+		UserAgent:  userAgent,
+		LastSeenAt: &now,
+		ExpiresAt:  now.Add(ttl),
+		CreatedAt:  now,
+	}
+}
+
+// sessionForFamily returns the session a refresh token belongs to, moving
+// its expiry along with the rotated token.
+func sessionForFamily(tx *gorm.DB, r *http.Request, stored models.RefreshToken) (models.Session, error) {
+	var session models.Session
+	err := tx.Where("family_id = ? AND user_id = ?", stored.FamilyID, stored.UserID).First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Logins from before sessions were recorded get one on refresh
+		session = newSession(r, stored.UserID, models.SessionKindBearer, config.AppConfig.RefreshTokenTTL)
+		session.FamilyID = stored.FamilyID
+		return session, tx.Create(&session).Error
+	}
+	if err != nil {
+		return session, err
+	}
+	now := time.Now()
+	return session, tx.Model(&session).Updates(map[string]interface{}{
+		"last_seen_at": now,
+		"expires_at":   now.Add(config.AppConfig.RefreshTokenTTL),
+	}).Error
+}
+
+// revokeSession signs one session out. Access tokens already minted for a
+// bearer session are blocked through the revocation list until they expire.
+func revokeSession(session models.Session) error {
+	now := time.Now()
+	if err := db.Model(&models.Session{}).Where("id = ?", session.ID).Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	if session.Kind != models.SessionKindBearer {
+		return nil
+	}
+	if err := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", session.FamilyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return revocation.Revoke(revocation.SessionKey(session.ID), session.UserID, now.Add(config.AppConfig.AccessTokenTTL))
+}
+
+// startCookieSession stores a new session for user and sets its cookies.
+func startCookieSession(w http.ResponseWriter, r *http.Request, user models.User) (*cookieSessionResponse, error) {
+	token, err := secure.RandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	ttl := config.AppConfig.SessionTTL
+	tokenHash := secure.HashToken(token)
+	session := newSession(r, user.ID, models.SessionKindCookie, ttl)
+	session.TokenHash = &tokenHash
+	if err := db.Create(&session).Error; err != nil {
+		return nil, err
+	}
+	csrfToken := middleware.CSRFToken(token)
+	setSessionCookies(w, token, csrfToken, int(ttl.Seconds()))
+	return &cookieSessionResponse{
+		Message:   "Logged in",
+		CSRFToken: csrfToken,
+		ExpiresAt: session.ExpiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// loginResponse completes a successful login with bearer tokens, or with a
+// session cookie when the client asked for cookie mode.
+func loginResponse(w http.ResponseWriter, r *http.Request, user models.User, mode string) (interface{}, error) {
+	if mode == sessionModeCookie {
+		return startCookieSession(w, r, user)
+	}
+	return issueTokens(r, user)
+}
+
+// endCookieSession revokes the session principal authenticated with and
+// clears its cookies.
+func endCookieSession(w http.ResponseWriter, principal *auth.Principal) error {
+	if err := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", principal.SessionID, principal.UserID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	setSessionCookies(w, "", "", -1)
+	return nil
+}
+
+// GetCSRFToken returns the CSRF token for the current cookie session, for
+// clients on another origin that cannot read the CSRF cookie.
+func GetCSRFToken(w http.ResponseWriter, r *http.Request) {
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+	cookie, err := r.Cookie(middleware.SessionCookieName)
+	if principal.Method != auth.MethodSession || err != nil {
+		http.Error(w, `{"error": "Not authenticated with a session cookie"}`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]string{"csrf_token": middleware.CSRFToken(cookie.Value)})
+}
+
+// sessionResponse marks the session the request itself was made with.
+type sessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func GetSessions(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var sessions []models.Session
+	if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", principal.UserID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions).Error; err != nil {
+		log.Printf("Error listing sessions for user_id %d: %v", principal.UserID, err)
+		http.Error(w, `{"error": "Failed to list sessions"}`, http.StatusInternalServerError)
+		return
+	}
+	response := make([]sessionResponse, len(sessions))
+	for i, session := range sessions {
+		response[i] = sessionResponse{Session: session, Current: session.ID == principal.SessionID}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"sessions": response})
+}
+
+func RevokeSession(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	principal, ok := auth.FromContext(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Invalid session ID: %v", err)
+		http.Error(w, `{"error": "Invalid session ID"}`, http.StatusBadRequest)
+		return
+	}
+	var session models.Session
+	if err := db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, principal.UserID).First(&session).Error; err != nil {
+		log.Printf("Session not found or not owned: ID=%d, user_id=%d, error=%v", id, principal.UserID, err)
+		http.Error(w, `{"error": "Session not found"}`, http.StatusNotFound)
+		return
+	}
+
+	if err := revokeSession(session); err != nil {
+		log.Printf("Error revoking session %d for user_id %d: %v", session.ID, principal.UserID, err)
+		http.Error(w, `{"error": "Failed to revoke session"}`, http.StatusInternalServerError)
+		return
+	}
+	if session.ID == principal.SessionID && principal.Method == auth.MethodSession {
+		setSessionCookies(w, "", "", -1)
+	}
+	audit.Record(r, audit.SessionRevoked, principal.UserID, fmt.Sprintf("session=%d", session.ID))
+
+	log.Printf("Session %d revoked for user_id %d", session.ID, principal.UserID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Session revoked"})
+}
@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Values of the subtasks query parameter, which decides what happens to a
+// task's subtasks when it is completed or deleted.
+const (
+	subtasksBlock    = "block"
+	subtasksCascade  = "cascade"
+	subtasksReparent = "reparent"
+)
+
+// errParentCycle is returned when a move would put a task below itself.
+var errParentCycle = errors.New("task would become its own ancestor")
+
+// descendantsCTE is a recursive query over the subtrees below the task IDs
+// bound to it, yielding each descendant with the top task it hangs from.
+// UNION rather than UNION ALL drops rows already seen, so the query still
+// ends should the parent links ever form a cycle.
+const descendantsCTE = `WITH RECURSIVE descendants (root_id, id, status_category) AS (
+	SELECT parent_id, id, status_category FROM tasks WHERE parent_id IN (?) AND deleted_at IS NULL
+	UNION
+	SELECT descendants.root_id, tasks.id, tasks.status_category FROM tasks
+	JOIN descendants ON tasks.parent_id = descendants.id
+	WHERE tasks.deleted_at IS NULL
+) `
+
+// descendantIDs returns the IDs of every task below taskID, open ones only
+// if openOnly is set.
+func descendantIDs(tx *gorm.DB, taskID int, openOnly bool) ([]int, error) {
+	query := descendantsCTE + "SELECT id FROM descendants"
+	args := []interface{}{taskID}
+	if openOnly {
+		query += " WHERE status_category <> ?"
+		args = append(args, models.CategoryDone)
+	}
+	var ids []int
+	err := tx.Raw(query, args...).Scan(&ids).Error
+	return ids, err
+}
+
+// forUpdate makes the rows tx reads stay locked until it ends, on postgres.
+// Elsewhere the transaction alone has to do.
+func forUpdate(tx *gorm.DB) *gorm.DB {
+	if tx.Dialector.Name() == "postgres" {
+		return tx.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	return tx
+}
+
+// moveTask sets the parent of task to parentID, refusing with
+// errParentCycle to put it below itself. The task and the chain of
+// ancestors above its new parent are locked while they are checked, so
+// concurrent moves cannot both pass and leave a cycle between them.
+func moveTask(tx *gorm.DB, task *models.Task, parentID *int) error {
+	var locked models.Task
+	if err := forUpdate(tx).Select("id").First(&locked, task.ID).Error; err != nil {
+		return err
+	}
+	seen := map[int]bool{}
+	for id := parentID; id != nil; {
+		if *id == task.ID {
+			return errParentCycle
+		}
+		// A cycle above the parent that does not pass through task is
+		// left alone rather than walked forever
+		if seen[*id] {
+			break
+		}
+		seen[*id] = true
+		var ancestor models.Task
+		if err := forUpdate(tx).Select("id", "parent_id").Where("id = ? AND user_id = ?", *id, task.UserID).
+			First(&ancestor).Error; err != nil {
+			return err
+		}
+		id = ancestor.ParentID
+	}
+
+	task.ParentID = parentID
+	task.UpdatedAt = time.Now()
+	return tx.Model(task).Updates(map[string]interface{}{"parent_id": parentID, "updated_at": task.UpdatedAt}).Error
+}
+
+// attachProgress fills in the progress of each task that has subtasks,
+// using one query for the whole slice.
+func attachProgress(tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	ids := make([]int, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.ID
+	}
+	var rows []struct {
+		RootID    int
+		Total     int
+		Completed int
+	}
+	if err := db.Raw(descendantsCTE+`SELECT root_id, COUNT(*) AS total,
+		SUM(CASE WHEN status_category = ? THEN 1 ELSE 0 END) AS completed
+		FROM descendants GROUP BY root_id`, ids, models.CategoryDone).Scan(&rows).Error; err != nil {
+		return err
+	}
+	progress := make(map[int]int, len(rows))
+	for _, row := range rows {
+		progress[row.RootID] = row.Completed * 100 / row.Total
+	}
+	for i := range tasks {
+		if p, ok := progress[tasks[i].ID]; ok {
+			tasks[i].Progress = &p
+		}
+	}
+	return nil
+}
+
+// loadTask returns the caller's task named in the URL, writing an error
+// response if it cannot.
+func loadTask(w http.ResponseWriter, r *http.Request) (uint, models.Task, bool) {
+	var task models.Task
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return 0, task, false
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return 0, task, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Invalid task ID: %v", err)
+		http.Error(w, `{"error": "Invalid task ID"}`, http.StatusBadRequest)
+		return 0, task, false
+	}
+	if err := preloadTags(db).Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
+		log.Printf("Task not found for user_id %d: ID=%d, error=%v", userID, id, err)
+		http.Error(w, `{"error": "Task not found"}`, http.StatusNotFound)
+		return 0, task, false
+	}
+	return userID, task, true
+}
+
+// validParent checks that parentID names one of userID's tasks, writing an
+// error response if not.
+func validParent(w http.ResponseWriter, userID uint, parentID int) bool {
+	var count int64
+	if err := db.Model(&models.Task{}).Where("id = ? AND user_id = ?", parentID, int(userID)).Count(&count).Error; err != nil {
+		log.Printf("Error checking parent task %d for user_id %d: %v", parentID, userID, err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return false
+	}
+	if count == 0 {
+		http.Error(w, `{"error": "Parent task not found"}`, http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+func GetSubtasks(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	children := []models.Task{}
+	if err := preloadTags(db).Where("parent_id = ? AND user_id = ?", task.ID, int(userID)).
+		Order("created_at asc").Order("id asc").Find(&children).Error; err != nil {
+		log.Printf("Error listing subtasks of task %d: %v", task.ID, err)
+		http.Error(w, `{"error": "Failed to list subtasks"}`, http.StatusInternalServerError)
+		return
+	}
+	if err := attachProgress(children); err != nil {
+		log.Printf("Error computing progress for subtasks of task %d: %v", task.ID, err)
+		http.Error(w, `{"error": "Failed to list subtasks"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tasks": children})
+}
+
+// MoveTask moves a task, with everything below it, under another parent or
+// to the top level.
+func MoveTask(w http.ResponseWriter, r *http.Request) {
+	userID, task, ok := loadTask(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ParentID *int `json:"parent_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.ParentID != nil {
+		if *input.ParentID == task.ID {
+			http.Error(w, `{"error": "A task cannot be its own parent"}`, http.StatusBadRequest)
+			return
+		}
+		if !validParent(w, userID, *input.ParentID) {
+			return
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return moveTask(tx, &task, input.ParentID)
+	})
+	if errors.Is(err, errParentCycle) {
+		http.Error(w, `{"error": "A task cannot be moved under one of its own subtasks"}`, http.StatusConflict)
+		return
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// Deleted since it was checked
+		http.Error(w, `{"error": "Parent task not found"}`, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Error moving task %d for user_id %d: %v", task.ID, userID, err)
+		http.Error(w, `{"error": "Failed to move task"}`, http.StatusInternalServerError)
+		return
+	}
+	tasks := []models.Task{task}
+	if err := attachProgress(tasks); err != nil {
+		log.Printf("Error computing progress for task %d: %v", task.ID, err)
+	}
+
+	log.Printf("Task %d moved under %v for user_id %d", task.ID, describeParent(input.ParentID), userID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks[0])
+}
+
+func describeParent(parentID *int) string {
+	if parentID == nil {
+		return "the top level"
+	}
+	return fmt.Sprintf("task %d", *parentID)
+}
@@ -0,0 +1,356 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+const maxTagNameLength = 50
+
+var tagColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// isValidTagName rejects names that could not be used in the tags filter of
+// GetTasks, where commas separate names and a leading "-" excludes one.
+func isValidTagName(name string) bool {
+	return name != "" && len(name) <= maxTagNameLength &&
+		!strings.Contains(name, ",") && !strings.HasPrefix(name, "-")
+}
+
+func isValidTagColor(color string) bool {
+	return tagColorPattern.MatchString(color)
+}
+
+// preloadTags loads each task's tags in name order.
+func preloadTags(query *gorm.DB) *gorm.DB {
+	return query.Preload("Tags", func(db *gorm.DB) *gorm.DB {
+		return db.Order("name asc")
+	})
+}
+
+// taggedTaskIDs selects the IDs of userID's tasks carrying any of names.
+func taggedTaskIDs(userID uint, names []string) *gorm.DB {
+	return db.Table("task_tags").
+		Select("task_tags.task_id").
+		Joins("JOIN tags ON tags.id = task_tags.tag_id").
+		Where("tags.user_id = ? AND tags.name IN ?", userID, names)
+}
+
+// parseTagFilter splits a tags filter such as "bug,q4,-wontfix" into the
+// names to require and the names to exclude.
+func parseTagFilter(list string) (include, exclude []string) {
+	seen := map[string]bool{}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		if strings.HasPrefix(name, "-") {
+			if name = strings.TrimPrefix(name, "-"); name != "" {
+				exclude = append(exclude, name)
+			}
+			continue
+		}
+		include = append(include, name)
+	}
+	return include, exclude
+}
+
+// touchTaggedTasks marks every task carrying tagID as updated, so clients
+// syncing by updated_at pick up a renamed or deleted tag.
+func touchTaggedTasks(tx *gorm.DB, tagID uint) error {
+	return tx.Model(&models.Task{}).
+		Where("id IN (?)", tx.Table("task_tags").Select("task_id").Where("tag_id = ?", tagID)).
+		Update("updated_at", time.Now()).Error
+}
+
+// tagNameTaken reports whether userID already has another tag called name.
+func tagNameTaken(userID uint, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := db.Model(&models.Tag{}).Where("user_id = ? AND name = ? AND id <> ?", userID, name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// loadTag returns the caller's tag named by the URL variable key, writing
+// an error response if it cannot.
+func loadTag(w http.ResponseWriter, r *http.Request, key string) (uint, models.Tag, bool) {
+	var tag models.Tag
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return 0, tag, false
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return 0, tag, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)[key])
+	if err != nil {
+		log.Printf("Invalid tag ID: %v", err)
+		http.Error(w, `{"error": "Invalid tag ID"}`, http.StatusBadRequest)
+		return 0, tag, false
+	}
+	if err := db.Where("id = ? AND user_id = ?", id, userID).First(&tag).Error; err != nil {
+		log.Printf("Tag not found for user_id %d: ID=%d, error=%v", userID, id, err)
+		http.Error(w, `{"error": "Tag not found"}`, http.StatusNotFound)
+		return 0, tag, false
+	}
+	return userID, tag, true
+}
+
+func GetTags(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	tags := []models.Tag{}
+	if err := db.Where("user_id = ?", userID).Order("name asc").Find(&tags).Error; err != nil {
+		log.Printf("Error listing tags for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to list tags"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": tags})
+}
+
+func CreateTag(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	input.Name = strings.TrimSpace(input.Name)
+	if !isValidTagName(input.Name) {
+		http.Error(w, `{"error": "Tag name must be 1-50 characters, without commas or a leading -"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Color == "" {
+		input.Color = models.DefaultTagColor
+	} else if !isValidTagColor(input.Color) {
+		http.Error(w, `{"error": "Color must be a hex color such as #1f77b4"}`, http.StatusBadRequest)
+		return
+	}
+
+	taken, err := tagNameTaken(userID, input.Name, 0)
+	if err != nil {
+		log.Printf("Error checking tag name for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to create tag"}`, http.StatusInternalServerError)
+		return
+	}
+	if taken {
+		http.Error(w, `{"error": "A tag with that name already exists"}`, http.StatusConflict)
+		return
+	}
+
+	tag := models.Tag{
+		UserID:    userID,
+		Name:      input.Name,
+		Color:     input.Color,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if err := db.Create(&tag).Error; err != nil {
+		log.Printf("Error creating tag for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to create tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Tag created for user_id %d: ID=%d, Name=%s", userID, tag.ID, tag.Name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(tag)
+}
+
+func UpdateTag(w http.ResponseWriter, r *http.Request) {
+	userID, tag, ok := loadTag(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Color *string `json:"color"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.Name != nil {
+		name := strings.TrimSpace(*input.Name)
+		if !isValidTagName(name) {
+			http.Error(w, `{"error": "Tag name must be 1-50 characters, without commas or a leading -"}`, http.StatusBadRequest)
+			return
+		}
+		taken, err := tagNameTaken(userID, name, tag.ID)
+		if err != nil {
+			log.Printf("Error checking tag name for user_id %d: %v", userID, err)
+			http.Error(w, `{"error": "Failed to update tag"}`, http.StatusInternalServerError)
+			return
+		}
+		if taken {
+			http.Error(w, `{"error": "A tag with that name already exists"}`, http.StatusConflict)
+			return
+		}
+		tag.Name = name
+	}
+	if input.Color != nil {
+		if !isValidTagColor(*input.Color) {
+			http.Error(w, `{"error": "Color must be a hex color such as #1f77b4"}`, http.StatusBadRequest)
+			return
+		}
+		tag.Color = *input.Color
+	}
+	tag.UpdatedAt = time.Now()
+
+	// Tasks refer to the tag by ID, so the rename reaches all of them with
+	// the tag row; they are touched in the same transaction
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&tag).Error; err != nil {
+			return err
+		}
+		return touchTaggedTasks(tx, tag.ID)
+	}); err != nil {
+		log.Printf("Error updating tag %d for user_id %d: %v", tag.ID, userID, err)
+		http.Error(w, `{"error": "Failed to update tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Tag updated for user_id %d: ID=%d, Name=%s", userID, tag.ID, tag.Name)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tag)
+}
+
+func DeleteTag(w http.ResponseWriter, r *http.Request) {
+	userID, tag, ok := loadTag(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := touchTaggedTasks(tx, tag.ID); err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM task_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	}); err != nil {
+		log.Printf("Error deleting tag %d for user_id %d: %v", tag.ID, userID, err)
+		http.Error(w, `{"error": "Failed to delete tag"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Tag deleted for user_id %d: ID=%d", userID, tag.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Tag deleted"})
+}
+
+// loadTaskAndTag returns the caller's task and tag named in the URL of the
+// attach and detach endpoints.
+func loadTaskAndTag(w http.ResponseWriter, r *http.Request) (models.Task, models.Tag, bool) {
+	var task models.Task
+	userID, tag, ok := loadTag(w, r, "tag_id")
+	if !ok {
+		return task, tag, false
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		log.Printf("Invalid task ID: %v", err)
+		http.Error(w, `{"error": "Invalid task ID"}`, http.StatusBadRequest)
+		return task, tag, false
+	}
+	if err := db.Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
+		log.Printf("Task not found for user_id %d: ID=%d, error=%v", userID, id, err)
+		http.Error(w, `{"error": "Task not found"}`, http.StatusNotFound)
+		return task, tag, false
+	}
+	return task, tag, true
+}
+
+// writeTaskWithTags responds with task and its current tags.
+func writeTaskWithTags(w http.ResponseWriter, task models.Task) {
+	if err := preloadTags(db).First(&task, task.ID).Error; err != nil {
+		log.Printf("Error loading tags for task %d: %v", task.ID, err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(task)
+}
+
+func AttachTag(w http.ResponseWriter, r *http.Request) {
+	task, tag, ok := loadTaskAndTag(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(&task).Omit("Tags.*").Association("Tags").Append(&tag); err != nil {
+		log.Printf("Error attaching tag %d to task %d: %v", tag.ID, task.ID, err)
+		http.Error(w, `{"error": "Failed to attach tag"}`, http.StatusInternalServerError)
+		return
+	}
+	db.Model(&task).Update("updated_at", time.Now())
+
+	log.Printf("Tag %d attached to task %d", tag.ID, task.ID)
+	writeTaskWithTags(w, task)
+}
+
+func DetachTag(w http.ResponseWriter, r *http.Request) {
+	task, tag, ok := loadTaskAndTag(w, r)
+	if !ok {
+		return
+	}
+
+	if err := db.Model(&task).Association("Tags").Delete(&tag); err != nil {
+		log.Printf("Error detaching tag %d from task %d: %v", tag.ID, task.ID, err)
+		http.Error(w, `{"error": "Failed to detach tag"}`, http.StatusInternalServerError)
+		return
+	}
+	db.Model(&task).Update("updated_at", time.Now())
+
+	log.Printf("Tag %d detached from task %d", tag.ID, task.ID)
+	writeTaskWithTags(w, task)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
@@ -9,7 +10,12 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
 	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/reminders"
+	"github.com/harip/GoTasker/workflows"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func CreateTask(w http.ResponseWriter, r *http.Request) {
@@ -19,7 +25,7 @@ func CreateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := auth.UserID(r.Context())
 	if !ok {
 		log.Println("Error: User ID not found in context")
 		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
@@ -30,7 +36,10 @@ func CreateTask(w http.ResponseWriter, r *http.Request) {
 		Title       string     `json:"title"`
 		Description string     `json:"description"`
 		Status      string     `json:"status"`
+		Priority    string     `json:"priority"`
 		DueDate     *time.Time `json:"due_date"`
+		ParentID    *int       `json:"parent_id"`
+		Recurrence  string     `json:"recurrence"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		log.Printf("Error decoding request body: %v", err)
@@ -43,30 +52,57 @@ func CreateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "Title is required"}`, http.StatusBadRequest)
 		return
 	}
-	if input.Status == "" {
-		input.Status = "Pending"
-	} else if !isValidStatus(input.Status) {
-		log.Printf("Invalid task data: Status=%s", input.Status)
-		http.Error(w, `{"error": "Status must be Pending, In Progress, or Completed"}`, http.StatusBadRequest)
+	workflow, ok := userWorkflow(w, userID)
+	if !ok {
+		return
+	}
+	status := workflows.Initial(workflow)
+	if input.Status != "" {
+		if status, ok = workflows.Status(workflow, input.Status); !ok {
+			invalidStatus(w, workflow, input.Status)
+			return
+		}
+	}
+	if input.Priority == "" {
+		input.Priority = models.PriorityNone
+	} else if !isValidPriority(input.Priority) {
+		log.Printf("Invalid task data: Priority=%s", input.Priority)
+		http.Error(w, `{"error": "Priority must be one of `+strings.Join(models.ValidPriorities, ", ")+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	if input.ParentID != nil && !validParent(w, userID, *input.ParentID) {
+		return
+	}
+	rule, ok := normalizeRecurrence(w, input.Recurrence, input.DueDate)
+	if !ok {
 		return
 	}
 
 	task := models.Task{
-		Title:       input.Title,
-		Description: input.Description,
-		Status:      input.Status,
-		DueDate:     input.DueDate,
-		UserID:      int(userID),
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ParentID:       input.ParentID,
+		Title:          input.Title,
+		Description:    input.Description,
+		Status:         status.Name,
+		StatusCategory: status.Category,
+		Priority:       input.Priority,
+		DueDate:        input.DueDate,
+		Recurrence:     rule,
+		UserID:         int(userID),
+		Tags:           []models.Tag{},
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+	}
+	if rule != "" {
+		task.RecurrenceStart = input.DueDate
 	}
 	if err := db.Create(&task).Error; err != nil {
-		log.Printf("Error creating task for user_id %d: %v", int(userID), err)
+		log.Printf("Error creating task for user_id %d: %v", userID, err)
 		http.Error(w, `{"error": "Failed to create task: `+err.Error()+`"}`, http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Task created successfully for user_id %d: ID=%d, Title=%s", int(userID), task.ID, task.Title)
+	log.Printf("Task created successfully for user_id %d: ID=%d, Title=%s", userID, task.ID, task.Title)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(task)
@@ -79,7 +115,7 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := auth.UserID(r.Context())
 	if !ok {
 		log.Println("Error: User ID not found in context")
 		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
@@ -98,6 +134,10 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 	offset := (page - 1) * limit
 
 	status := query.Get("status")
+	category := query.Get("status_category")
+	priorities := validPriorities(query.Get("priority"))
+	includeTags, excludeTags := parseTagFilter(query.Get("tags"))
+	tagMode := query.Get("tag_mode")
 	dueDateAfter := query.Get("due_date_after")
 	dueDateBefore := query.Get("due_date_before")
 	sortBy := query.Get("sort_by")
@@ -112,8 +152,30 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 	var tasks []models.Task
 	dbQuery := db.Model(&models.Task{}).Where("user_id = ?", int(userID))
 
-	if status != "" && isValidStatus(status) {
-		dbQuery = dbQuery.Where("status = ?", status)
+	if status != "" {
+		workflow, ok := userWorkflow(w, userID)
+		if !ok {
+			return
+		}
+		if _, ok := workflows.Status(workflow, status); ok {
+			dbQuery = dbQuery.Where("status = ?", status)
+		}
+	}
+	if isValidStatusCategory(category) {
+		dbQuery = dbQuery.Where("status_category = ?", category)
+	}
+	if len(priorities) > 0 {
+		dbQuery = dbQuery.Where("priority IN ?", priorities)
+	}
+	if len(includeTags) > 0 {
+		tagged := taggedTaskIDs(userID, includeTags)
+		if tagMode == "all" {
+			tagged = tagged.Group("task_tags.task_id").Having("COUNT(DISTINCT tags.id) = ?", len(includeTags))
+		}
+		dbQuery = dbQuery.Where("id IN (?)", tagged)
+	}
+	if len(excludeTags) > 0 {
+		dbQuery = dbQuery.Where("id NOT IN (?)", taggedTaskIDs(userID, excludeTags))
 	}
 	if dueDateAfter != "" {
 		if t, err := time.Parse(time.RFC3339, dueDateAfter); err == nil {
@@ -129,7 +191,14 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 	var total int64
 	dbQuery.Count(&total)
 
-	dbQuery.Order(sortBy + " " + sortOrder).Offset(offset).Limit(limit).Find(&tasks)
+	dbQuery = orderTasks(dbQuery, sortBy, sortOrder)
+	preloadTags(dbQuery).Offset(offset).Limit(limit).Find(&tasks)
+	if err := attachProgress(tasks); err != nil {
+		log.Printf("Error computing task progress for user_id %d: %v", userID, err)
+	}
+	if err := attachCommentCounts(tasks); err != nil {
+		log.Printf("Error counting comments for user_id %d: %v", userID, err)
+	}
 
 	response := map[string]interface{}{
 		"tasks": tasks,
@@ -138,7 +207,7 @@ func GetTasks(w http.ResponseWriter, r *http.Request) {
 		"total": total,
 	}
 
-	log.Printf("Retrieved %d tasks for user_id %d (page=%d, limit=%d)", len(tasks), int(userID), page, limit)
+	log.Printf("Retrieved %d tasks for user_id %d (page=%d, limit=%d)", len(tasks), userID, page, limit)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
@@ -150,7 +219,7 @@ func GetTaskByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := auth.UserID(r.Context())
 	if !ok {
 		log.Println("Error: User ID not found in context")
 		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
@@ -166,15 +235,23 @@ func GetTaskByID(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var task models.Task
-	if err := db.Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
-		log.Printf("Task not found for user_id %d: ID=%d, error=%v", int(userID), id, err)
+	if err := preloadTags(db).Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
+		log.Printf("Task not found for user_id %d: ID=%d, error=%v", userID, id, err)
 		http.Error(w, `{"error": "Task not found"}`, http.StatusNotFound)
 		return
 	}
 
-	log.Printf("Retrieved task for user_id %d: ID=%d, Title=%s", int(userID), task.ID, task.Title)
+	tasks := []models.Task{task}
+	if err := attachProgress(tasks); err != nil {
+		log.Printf("Error computing progress for task %d: %v", task.ID, err)
+	}
+	if err := attachCommentCounts(tasks); err != nil {
+		log.Printf("Error counting comments for task %d: %v", task.ID, err)
+	}
+
+	log.Printf("Retrieved task for user_id %d: ID=%d, Title=%s", userID, task.ID, task.Title)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(tasks[0])
 }
 
 func UpdateTask(w http.ResponseWriter, r *http.Request) {
@@ -184,7 +261,7 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, ok := auth.UserID(r.Context())
 	if !ok {
 		log.Println("Error: User ID not found in context")
 		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
@@ -200,8 +277,8 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var task models.Task
-	if err := db.Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
-		log.Printf("Task not found for user_id %d: ID=%d, error=%v", int(userID), id, err)
+	if err := preloadTags(db).Where("id = ? AND user_id = ?", id, int(userID)).First(&task).Error; err != nil {
+		log.Printf("Task not found for user_id %d: ID=%d, error=%v", userID, id, err)
 		http.Error(w, `{"error": "Task not found"}`, http.StatusNotFound)
 		return
 	}
@@ -210,7 +287,9 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 		Title       string     `json:"title"`
 		Description string     `json:"description"`
 		Status      string     `json:"status"`
+		Priority    string     `json:"priority"`
 		DueDate     *time.Time `json:"due_date"`
+		Recurrence  *string    `json:"recurrence"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		log.Printf("Error decoding request body: %v", err)
@@ -223,64 +302,322 @@ func UpdateTask(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, `{"error": "Title is required"}`, http.StatusBadRequest)
 		return
 	}
+	workflow, ok := userWorkflow(w, userID)
+	if !ok {
+		return
+	}
+	category := task.StatusCategory
 	if input.Status == "" {
 		input.Status = task.Status
-	} else if !isValidStatus(input.Status) {
-		log.Printf("Invalid task data: Status=%s", input.Status)
-		http.Error(w, `{"error": "Status must be Pending, In Progress, or Completed"}`, http.StatusBadRequest)
+	} else if input.Status != task.Status {
+		status, ok := workflows.Status(workflow, input.Status)
+		if !ok {
+			invalidStatus(w, workflow, input.Status)
+			return
+		}
+		if !workflows.Allows(workflow, task.Status, input.Status) {
+			log.Printf("Task %d cannot move from %s to %s", task.ID, task.Status, input.Status)
+			http.Error(w, `{"error": "A task cannot move from `+task.Status+` to `+input.Status+`"}`, http.StatusConflict)
+			return
+		}
+		category = status.Category
+	}
+	starting := category == models.CategoryDoing && task.StatusCategory != models.CategoryDoing
+	completing := category == models.CategoryDone && task.StatusCategory != models.CategoryDone
+	if input.Priority == "" {
+		input.Priority = task.Priority
+	} else if !isValidPriority(input.Priority) {
+		log.Printf("Invalid task data: Priority=%s", input.Priority)
+		http.Error(w, `{"error": "Priority must be one of `+strings.Join(models.ValidPriorities, ", ")+`"}`, http.StatusBadRequest)
+		return
+	}
+
+	// A missing recurrence keeps the current rule and an empty one clears
+	// it. A changed rule starts a new series at the new due date.
+	rule, recurrenceStart := task.Recurrence, task.RecurrenceStart
+	if input.Recurrence != nil {
+		normalized, ok := normalizeRecurrence(w, *input.Recurrence, input.DueDate)
+		if !ok {
+			return
+		}
+		if normalized != rule {
+			rule, recurrenceStart = normalized, input.DueDate
+		}
+		if rule == "" {
+			recurrenceStart = nil
+		}
+	}
+	if rule != "" && input.DueDate == nil {
+		http.Error(w, `{"error": "A recurring task needs a due date"}`, http.StatusBadRequest)
 		return
 	}
 
+	if starting {
+		blockers, err := openBlockers(task.ID)
+		if err != nil {
+			log.Printf("Error loading blockers of task %d: %v", task.ID, err)
+			http.Error(w, `{"error": "Failed to update task"}`, http.StatusInternalServerError)
+			return
+		}
+		if len(blockers) > 0 {
+			log.Printf("Task %d cannot start, blocked by open tasks %s", task.ID, taskIDList(blockers))
+			http.Error(w, `{"error": "Task is blocked by open tasks `+taskIDList(blockers)+`"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	// Completing a task with open subtasks is refused unless the caller
+	// asks for the subtasks to be completed along with it
+	var subtasks []models.Task
+	if completing {
+		mode := r.URL.Query().Get("subtasks")
+		if mode != "" && mode != subtasksBlock && mode != subtasksCascade {
+			http.Error(w, `{"error": "subtasks must be block or cascade"}`, http.StatusBadRequest)
+			return
+		}
+		openSubtasks, err := descendantIDs(db, task.ID, true)
+		if err == nil && len(openSubtasks) > 0 && mode == subtasksCascade {
+			// Tags are needed to carry them on to next occurrences
+			err = preloadTags(db).Where("id IN ?", openSubtasks).Order("id asc").Find(&subtasks).Error
+		}
+		if err != nil {
+			log.Printf("Error loading subtasks of task %d: %v", task.ID, err)
+			http.Error(w, `{"error": "Failed to update task"}`, http.StatusInternalServerError)
+			return
+		}
+		if len(openSubtasks) > 0 && mode != subtasksCascade {
+			http.Error(w, fmt.Sprintf(`{"error": "Task has %d open subtasks; complete them first or pass subtasks=cascade"}`, len(openSubtasks)), http.StatusConflict)
+			return
+		}
+		// The cascade moves each subtask as the caller could, so the
+		// workflow's transitions hold for them too
+		var stuck []string
+		for _, child := range subtasks {
+			if !workflows.Allows(workflow, child.Status, input.Status) {
+				stuck = append(stuck, fmt.Sprintf("%d (%s)", child.ID, child.Status))
+			}
+		}
+		if len(stuck) > 0 {
+			log.Printf("Task %d cannot cascade to %s, blocked subtasks %s", task.ID, input.Status, strings.Join(stuck, ", "))
+			http.Error(w, `{"error": "Subtasks `+strings.Join(stuck, ", ")+` cannot move to `+input.Status+`"}`, http.StatusConflict)
+			return
+		}
+	}
+
+	// Completing an instance of a recurring task moves the rule on to the
+	// next instance, unless the caller stops the series. Subtasks completed
+	// by a cascade are completed the same way.
+	recurring := rule != ""
+	for _, child := range subtasks {
+		recurring = recurring || child.Recurrence != ""
+	}
+	nextRule := ""
+	stopSeries := false
+	if recurring && completing {
+		mode := r.URL.Query().Get("recurrence")
+		if mode != "" && mode != recurrenceNext && mode != recurrenceStop {
+			http.Error(w, `{"error": "recurrence must be next or stop"}`, http.StatusBadRequest)
+			return
+		}
+		stopSeries = mode == recurrenceStop
+		if !stopSeries {
+			nextRule = rule
+		}
+		rule = ""
+	}
+
 	task.Title = input.Title
 	task.Description = input.Description
 	task.Status = input.Status
+	task.StatusCategory = category
+	task.Priority = input.Priority
+	dueDateChanged := !sameTime(task.DueDate, input.DueDate)
 	task.DueDate = input.DueDate
+	task.Recurrence = rule
+	task.RecurrenceStart = recurrenceStart
 	task.UpdatedAt = time.Now()
 
-	if err := db.Save(&task).Error; err != nil {
-		log.Printf("Error updating task for user_id %d: ID=%d, error=%v", int(userID), id, err)
+	var loc *time.Location
+	if recurring && completing && !stopSeries {
+		loc = userLocation(userID)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Save(&task).Error; err != nil {
+			return err
+		}
+		if dueDateChanged {
+			if err := reminders.Reschedule(tx, task.ID, task.DueDate); err != nil {
+				return err
+			}
+		}
+		for _, child := range subtasks {
+			childRule := child.Recurrence
+			if err := tx.Model(&models.Task{}).Where("id = ?", child.ID).Updates(map[string]interface{}{
+				"status": task.Status, "status_category": category, "recurrence": "", "updated_at": task.UpdatedAt,
+			}).Error; err != nil {
+				return err
+			}
+			if childRule == "" || stopSeries {
+				continue
+			}
+			next, err := createNextOccurrence(tx, child, childRule, workflows.Initial(workflow), loc)
+			if err != nil {
+				return err
+			}
+			if next != nil {
+				log.Printf("Created next occurrence of subtask %d for user_id %d: ID=%d", child.ID, userID, next.ID)
+			}
+		}
+		if nextRule == "" {
+			return nil
+		}
+		next, err := createNextOccurrence(tx, task, nextRule, workflows.Initial(workflow), loc)
+		if err != nil {
+			return err
+		}
+		task.NextOccurrence = next
+		return nil
+	}); err != nil {
+		log.Printf("Error updating task for user_id %d: ID=%d, error=%v", userID, id, err)
 		http.Error(w, `{"error": "Failed to update task: `+err.Error()+`"}`, http.StatusInternalServerError)
 		return
 	}
+	tasks := []models.Task{task}
+	if err := attachProgress(tasks); err != nil {
+		log.Printf("Error computing progress for task %d: %v", task.ID, err)
+	}
 
-	log.Printf("Task updated successfully for user_id %d: ID=%d, Title=%s", int(userID), task.ID, task.Title)
+	if task.NextOccurrence != nil {
+		log.Printf("Created next occurrence of task %d for user_id %d: ID=%d, due %s", task.ID, userID, task.NextOccurrence.ID, task.NextOccurrence.DueDate.Format(time.RFC3339))
+	}
+	log.Printf("Task updated successfully for user_id %d: ID=%d, Title=%s", userID, task.ID, task.Title)
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(task)
+	json.NewEncoder(w).Encode(tasks[0])
 }
 
+// DeleteTask deletes a task. Its subtasks are moved up to the task's own
+// parent, or deleted with it when subtasks=cascade.
 func DeleteTask(w http.ResponseWriter, r *http.Request) {
-	if !IsDBInitialized() {
-		log.Println("Error: Database not initialized")
-		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
-		return
-	}
-
-	userID, ok := r.Context().Value("user_id").(float64)
+	userID, task, ok := loadTask(w, r)
 	if !ok {
-		log.Println("Error: User ID not found in context")
-		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
 		return
 	}
 
-	vars := mux.Vars(r)
-	id, err := strconv.Atoi(vars["id"])
-	if err != nil {
-		log.Printf("Invalid task ID: %v", err)
-		http.Error(w, `{"error": "Invalid task ID"}`, http.StatusBadRequest)
+	mode := r.URL.Query().Get("subtasks")
+	if mode == "" {
+		mode = subtasksReparent
+	}
+	if mode != subtasksReparent && mode != subtasksCascade {
+		http.Error(w, `{"error": "subtasks must be reparent or cascade"}`, http.StatusBadRequest)
 		return
 	}
 
-	if err := db.Where("id = ? AND user_id = ?", id, int(userID)).Delete(&models.Task{}).Error; err != nil {
-		log.Printf("Task not found for user_id %d: ID=%d, error=%v", int(userID), id, err)
-		http.Error(w, `{"error": "Task not found"}`, http.StatusNotFound)
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		deleted := []int{task.ID}
+		if mode == subtasksCascade {
+			descendants, err := descendantIDs(tx, task.ID, false)
+			if err != nil {
+				return err
+			}
+			if len(descendants) > 0 {
+				if err := tx.Where("id IN ?", descendants).Delete(&models.Task{}).Error; err != nil {
+					return err
+				}
+			}
+			deleted = append(deleted, descendants...)
+		} else if err := tx.Model(&models.Task{}).Where("parent_id = ?", task.ID).
+			Updates(map[string]interface{}{"parent_id": task.ParentID, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		// Deleted tasks cannot be restored, so their attachments go with
+		// them, freeing the quota and letting the collector remove the blobs
+		if err := tx.Where("task_id IN ?", deleted).Delete(&models.Attachment{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&task).Error
+	}); err != nil {
+		log.Printf("Error deleting task for user_id %d: ID=%d, error=%v", userID, task.ID, err)
+		http.Error(w, `{"error": "Failed to delete task"}`, http.StatusInternalServerError)
 		return
 	}
 
-	log.Printf("Task deleted successfully for user_id %d: ID=%d", int(userID), id)
+	log.Printf("Task deleted successfully for user_id %d: ID=%d", userID, task.ID)
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Task successfully deleted"})
 }
 
-func isValidStatus(status string) bool {
-	return status == "Pending" || status == "In Progress" || status == "Completed"
+// sameTime reports whether two optional times are both unset or equal.
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func isValidPriority(priority string) bool {
+	for _, p := range models.ValidPriorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// validPriorities parses a comma-separated priority filter, dropping
+// unknown values the way an unknown status filter is ignored.
+func validPriorities(list string) []string {
+	var priorities []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.TrimSpace(p); isValidPriority(p) {
+			priorities = append(priorities, p)
+		}
+	}
+	return priorities
+}
+
+// sortableTaskColumns are the columns GetTasks sorts by directly.
+var sortableTaskColumns = map[string]bool{
+	"id":         true,
+	"title":      true,
+	"status":     true,
+	"due_date":   true,
+	"created_at": true,
+	"updated_at": true,
+}
+
+// priorityRank is an SQL expression ranking a task's priority, so sorting
+// follows urgency rather than the alphabet.
+func priorityRank() string {
+	var b strings.Builder
+	b.WriteString("CASE priority")
+	for rank, p := range models.ValidPriorities {
+		fmt.Fprintf(&b, " WHEN '%s' THEN %d", p, rank)
+	}
+	b.WriteString(" ELSE 0 END")
+	return b.String()
+}
+
+// orderTasks applies sort_by to a task query. Besides plain columns it
+// understands "priority", sorted by rank, and "smart": overdue tasks first,
+// then by descending priority, then by due date with undated tasks last.
+func orderTasks(query *gorm.DB, sortBy, sortOrder string) *gorm.DB {
+	// A stable tie-break on id keeps pages from overlapping
+	switch {
+	case sortBy == "priority":
+		return query.Order(priorityRank() + " " + sortOrder).Order("id asc")
+	case sortBy == "smart":
+		// One expression, since gorm drops plain columns ordered alongside it
+		return query.Order(clause.OrderBy{Expression: clause.Expr{
+			SQL: "CASE WHEN due_date < ? AND status_category <> ? THEN 0 ELSE 1 END, " +
+				priorityRank() + " desc, " +
+				"CASE WHEN due_date IS NULL THEN 1 ELSE 0 END, due_date asc, id asc",
+			Vars:               []interface{}{time.Now(), models.CategoryDone},
+			WithoutParentheses: true,
+		}})
+	case sortableTaskColumns[sortBy]:
+		return query.Order(sortBy + " " + sortOrder).Order("id asc")
+	default:
+		return query.Order("created_at " + sortOrder).Order("id asc")
+	}
 }
@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+)
+
+var errRefreshTokenReused = errors.New("refresh token already used")
+
+// tokenResponse is returned by Login, Register and RefreshToken. All values
+// are strings so older clients that decode into map[string]string still work.
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresAt    string `json:"expires_at"`
+}
+
+// userRoles lists the roles carried in user's access tokens
+func userRoles(user models.User) []string {
+	if user.Role == "" {
+		return []string{models.RoleMember}
+	}
+	return []string{user.Role}
+}
+
+func newAccessToken(user models.User, sessionID uint, expiresAt time.Time) (string, error) {
+	jti, err := secure.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	// iat has sub-second precision so a token minted just after a sign-out
+	// everywhere is not mistaken for one issued before it
+	return keyring.Sign(jwt.MapClaims{
+		"jti":      jti,
+		"sid":      float64(sessionID),
+		"user_id":  float64(user.ID),
+		"username": user.Username,
+		"roles":    userRoles(user),
+		"iat":      float64(time.Now().UnixNano()) / 1e9,
+		"exp":      expiresAt.Unix(),
+	})
+}
+
+// newImpersonationToken mints an access token for user on behalf of actor.
+// The act claim (RFC 8693) names the admin, so the token is never mistaken
+// for one the user obtained themselves. No session or refresh token goes
+// with it.
+func newImpersonationToken(user models.User, actor *auth.Principal, expiresAt time.Time) (string, error) {
+	jti, err := secure.RandomToken(16)
+	if err != nil {
+		return "", err
+	}
+	return keyring.Sign(jwt.MapClaims{
+		"jti":      jti,
+		"user_id":  float64(user.ID),
+		"username": user.Username,
+		"roles":    userRoles(user),
+		"act": map[string]interface{}{
+			"sub":      strconv.FormatUint(uint64(actor.UserID), 10),
+			"username": actor.Username,
+		},
+		"iat": float64(time.Now().UnixNano()) / 1e9,
+		"exp": expiresAt.Unix(),
+	})
+}
+
+// newRefreshToken stores a refresh token for userID in familyID and returns
+// the opaque value handed to the client. Only its hash is persisted.
+func newRefreshToken(tx *gorm.DB, userID uint, familyID string) (string, error) {
+	value, err := secure.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	record := models.RefreshToken{
+		UserID:    userID,
+		FamilyID:  familyID,
+		TokenHash: secure.HashToken(value),
+		ExpiresAt: time.Now().Add(config.AppConfig.RefreshTokenTTL),
+		CreatedAt: time.Now(),
+	}
+	if err := tx.Create(&record).Error; err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// issueTokens starts a new session and refresh token family for user, as
+// happens on every password login or registration.
+func issueTokens(r *http.Request, user models.User) (*tokenResponse, error) {
+	familyID, err := secure.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	var tokens *tokenResponse
+	err = db.Transaction(func(tx *gorm.DB) error {
+		session := newSession(r, user.ID, models.SessionKindBearer, config.AppConfig.RefreshTokenTTL)
+		session.FamilyID = familyID
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		tokens, err = issueTokensInFamily(tx, user, familyID, session.ID)
+		return err
+	})
+	return tokens, err
+}
+
+func issueTokensInFamily(tx *gorm.DB, user models.User, familyID string, sessionID uint) (*tokenResponse, error) {
+	expiresAt := time.Now().Add(config.AppConfig.AccessTokenTTL)
+	accessToken, err := newAccessToken(user, sessionID, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := newRefreshToken(tx, user.ID, familyID)
+	if err != nil {
+		return nil, err
+	}
+	return &tokenResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresAt:    expiresAt.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// revokeTokenFamily invalidates every refresh token descended from the same
+// login, used when a token is replayed after it was already rotated. The
+// login's session and its access tokens are revoked with it.
+func revokeTokenFamily(familyID string) error {
+	if err := db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		return err
+	}
+	var sessions []models.Session
+	if err := db.Where("family_id = ? AND revoked_at IS NULL", familyID).Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := revokeSession(session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revokeUserSessions signs a user out everywhere: every access token issued
+// so far is rejected and every refresh token family and cookie session is
+// revoked.
+func revokeUserSessions(userID uint) error {
+	if err := revocation.RevokeAllForUser(userID); err != nil {
+		return err
+	}
+	now := time.Now()
+	if err := db.Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return db.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", now).Error
+}
+
+func RefreshToken(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding refresh request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if input.RefreshToken == "" {
+		http.Error(w, `{"error": "Refresh token is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	var stored models.RefreshToken
+	if err := db.Where("token_hash = ?", secure.HashToken(input.RefreshToken)).First(&stored).Error; err != nil {
+		log.Printf("Refresh token not found: %v", err)
+		http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+		return
+	}
+	if stored.RevokedAt != nil {
+		log.Printf("Revoked refresh token presented for user_id %d (family %s)", stored.UserID, stored.FamilyID)
+		http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+		return
+	}
+	if stored.UsedAt != nil {
+		rejectReusedRefreshToken(w, stored)
+		return
+	}
+	if time.Now().After(stored.ExpiresAt) {
+		log.Printf("Expired refresh token presented for user_id %d", stored.UserID)
+		http.Error(w, `{"error": "Refresh token expired"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := db.First(&user, stored.UserID).Error; err != nil {
+		log.Printf("User for refresh token not found: user_id %d, error=%v", stored.UserID, err)
+		http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+		return
+	}
+	if user.DisabledAt != nil {
+		log.Printf("Refresh token presented for disabled user_id %d", user.ID)
+		http.Error(w, `{"error": "Account disabled"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var tokens *tokenResponse
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Only one concurrent request can flip used_at; the loser is a replay.
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", stored.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRefreshTokenReused
+		}
+		session, err := sessionForFamily(tx, r, stored)
+		if err != nil {
+			return err
+		}
+		tokens, err = issueTokensInFamily(tx, user, stored.FamilyID, session.ID)
+		return err
+	})
+	if errors.Is(err, errRefreshTokenReused) {
+		rejectReusedRefreshToken(w, stored)
+		return
+	}
+	if err != nil {
+		log.Printf("Error rotating refresh token for user_id %d: %v", user.ID, err)
+		http.Error(w, `{"error": "Failed to refresh token"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Refresh token rotated for user_id %d", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tokens)
+}
+
+func rejectReusedRefreshToken(w http.ResponseWriter, stored models.RefreshToken) {
+	log.Printf("Refresh token reuse detected for user_id %d, revoking family %s", stored.UserID, stored.FamilyID)
+	if err := revokeTokenFamily(stored.FamilyID); err != nil {
+		log.Printf("Error revoking token family %s: %v", stored.FamilyID, err)
+	}
+	http.Error(w, `{"error": "Invalid refresh token"}`, http.StatusUnauthorized)
+}
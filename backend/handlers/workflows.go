@@ -0,0 +1,226 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/workflows"
+	"gorm.io/gorm"
+)
+
+const (
+	maxWorkflowStatuses = 20
+	maxStatusNameLength = 50
+)
+
+var (
+	errStatusInUse   = errors.New("status still has tasks")
+	errUnknownStatus = errors.New("status is not part of the workflow")
+)
+
+func isValidStatusCategory(category string) bool {
+	for _, c := range models.ValidStatusCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// userWorkflow loads the workflow of userID, writing an error response if
+// it cannot.
+func userWorkflow(w http.ResponseWriter, userID uint) (*models.Workflow, bool) {
+	workflow, err := workflows.ForUser(db, userID)
+	if err != nil {
+		log.Printf("Error loading workflow for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return nil, false
+	}
+	return workflow, true
+}
+
+// invalidStatus writes the error response for a status missing from
+// workflow.
+func invalidStatus(w http.ResponseWriter, workflow *models.Workflow, status string) {
+	log.Printf("Invalid task data: Status=%s", status)
+	http.Error(w, `{"error": "Status must be one of `+strings.Join(workflows.Names(workflow), ", ")+`"}`, http.StatusBadRequest)
+}
+
+func GetWorkflow(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	workflow, ok := userWorkflow(w, userID)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workflow)
+}
+
+// UpdateWorkflow replaces the statuses of the user's workflow. Statuses
+// sent with their ID are kept, renamed or recategorized along with their
+// tasks; statuses left out are removed, which is refused while tasks are
+// still in them.
+func UpdateWorkflow(w http.ResponseWriter, r *http.Request) {
+	if !IsDBInitialized() {
+		log.Println("Error: Database not initialized")
+		http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+		return
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		log.Println("Error: User ID not found in context")
+		http.Error(w, `{"error": "Unauthorized"}`, http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Statuses []struct {
+			ID       uint   `json:"id"`
+			Name     string `json:"name"`
+			Category string `json:"category"`
+			// A missing list allows moving to every other status
+			Transitions *[]string `json:"transitions"`
+		} `json:"statuses"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		log.Printf("Error decoding request body: %v", err)
+		http.Error(w, `{"error": "Invalid request body"}`, http.StatusBadRequest)
+		return
+	}
+	if len(input.Statuses) == 0 || len(input.Statuses) > maxWorkflowStatuses {
+		http.Error(w, fmt.Sprintf(`{"error": "A workflow needs 1-%d statuses"}`, maxWorkflowStatuses), http.StatusBadRequest)
+		return
+	}
+
+	statuses := make([]models.WorkflowStatus, len(input.Statuses))
+	names := map[string]bool{}
+	seenNames := map[string]bool{}
+	seenIDs := map[uint]bool{}
+	for i, s := range input.Statuses {
+		name := strings.TrimSpace(s.Name)
+		// Names end up in error messages, so they must not need escaping
+		if name == "" || len(name) > maxStatusNameLength || strings.ContainsAny(name, `"\`) {
+			http.Error(w, `{"error": "Status names must be 1-50 characters, without quotes or backslashes"}`, http.StatusBadRequest)
+			return
+		}
+		// Names differing only in case would be too easy to confuse
+		if seenNames[strings.ToLower(name)] {
+			http.Error(w, `{"error": "Status names must be unique"}`, http.StatusBadRequest)
+			return
+		}
+		seenNames[strings.ToLower(name)] = true
+		names[name] = true
+		if !isValidStatusCategory(s.Category) {
+			http.Error(w, `{"error": "Status category must be one of `+strings.Join(models.ValidStatusCategories, ", ")+`"}`, http.StatusBadRequest)
+			return
+		}
+		if s.ID != 0 {
+			if seenIDs[s.ID] {
+				http.Error(w, `{"error": "Each status ID can only be given once"}`, http.StatusBadRequest)
+				return
+			}
+			seenIDs[s.ID] = true
+		}
+		statuses[i] = models.WorkflowStatus{ID: s.ID, Name: name, Category: s.Category}
+	}
+	for i, s := range input.Statuses {
+		from := &statuses[i]
+		from.Transitions = []string{}
+		if s.Transitions == nil {
+			for _, to := range statuses {
+				if to.Name != from.Name {
+					from.Transitions = append(from.Transitions, to.Name)
+				}
+			}
+			continue
+		}
+		listed := map[string]bool{}
+		for _, to := range *s.Transitions {
+			to = strings.TrimSpace(to)
+			if !names[to] || to == from.Name {
+				http.Error(w, `{"error": "Transitions of `+from.Name+` must name other statuses of the workflow"}`, http.StatusBadRequest)
+				return
+			}
+			if !listed[to] {
+				listed[to] = true
+				from.Transitions = append(from.Transitions, to)
+			}
+		}
+	}
+
+	var workflow *models.Workflow
+	var inUse []struct {
+		Status string
+		Count  int64
+	}
+	var unknownID uint
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if workflow, err = workflows.ForUpdate(tx, userID); err != nil {
+			return err
+		}
+		var removed []string
+		for _, status := range workflow.Statuses {
+			if !seenIDs[status.ID] {
+				removed = append(removed, status.Name)
+			}
+			delete(seenIDs, status.ID)
+		}
+		for id := range seenIDs {
+			unknownID = id
+			return errUnknownStatus
+		}
+		if len(removed) > 0 {
+			if err := tx.Model(&models.Task{}).Select("status, COUNT(*) AS count").
+				Where("user_id = ? AND status IN ?", userID, removed).
+				Group("status").Order("status asc").Scan(&inUse).Error; err != nil {
+				return err
+			}
+			if len(inUse) > 0 {
+				return errStatusInUse
+			}
+		}
+		return workflows.Replace(tx, workflow, statuses)
+	})
+	if errors.Is(err, errUnknownStatus) {
+		http.Error(w, fmt.Sprintf(`{"error": "Status %d is not part of the workflow"}`, unknownID), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errStatusInUse) {
+		var counts []string
+		for _, row := range inUse {
+			counts = append(counts, fmt.Sprintf("%s (%d)", row.Status, row.Count))
+		}
+		http.Error(w, `{"error": "Move the tasks out of `+strings.Join(counts, ", ")+` before removing the status"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating workflow for user_id %d: %v", userID, err)
+		http.Error(w, `{"error": "Failed to update workflow"}`, http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Workflow updated for user_id %d: %s", userID, strings.Join(workflows.Names(workflow), ", "))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(workflow)
+}
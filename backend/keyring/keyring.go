@@ -0,0 +1,420 @@
+// keyring/keyring.go
+package keyring
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/secure"
+	"gorm.io/gorm"
+)
+
+// Supported JWS algorithms.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrNoSigningKey = errors.New("keyring: no active signing key")
+	ErrUnknownKey   = errors.New("keyring: unknown signing key")
+)
+
+// LegacyTokenTTL is the lifetime tokens verified with LegacySecret were
+// issued with.
+const LegacyTokenTTL = 24 * time.Hour
+
+// maxPrepublish bounds how far ahead of use a new key appears in the JWKS,
+// giving other services time to refresh their cached copy.
+const maxPrepublish = time.Hour
+
+type Options struct {
+	Algorithm        string
+	RotationInterval time.Duration
+	MaxTokenTTL      time.Duration
+	// LegacySecret verifies HS256 tokens minted before keys carried a kid.
+	// Leave empty to reject such tokens.
+	LegacySecret string
+}
+
+type key struct {
+	id          string
+	algorithm   string
+	method      jwt.SigningMethod
+	signingKey  interface{}
+	verifyKey   interface{}
+	notBefore   time.Time
+	signUntil   time.Time
+	verifyUntil time.Time
+}
+
+var (
+	mu   sync.RWMutex
+	db   *gorm.DB
+	opts Options
+	keys map[string]*key
+)
+
+// Init loads the shared keys from the database and creates a signing key
+// for the configured algorithm if none is active.
+func Init(database *gorm.DB, options Options) error {
+	if signingMethod(options.Algorithm) == nil {
+		return fmt.Errorf("keyring: unsupported algorithm %q", options.Algorithm)
+	}
+	if options.RotationInterval <= 0 {
+		return fmt.Errorf("keyring: rotation interval must be positive")
+	}
+	mu.Lock()
+	db = database
+	opts = options
+	keys = make(map[string]*key)
+	mu.Unlock()
+	return Maintain()
+}
+
+// Maintain reloads keys written by other replicas, rotates the signing key
+// when it is about to retire and deletes keys nothing can still verify.
+func Maintain() error {
+	if err := reload(); err != nil {
+		return err
+	}
+	if err := rotate(); err != nil {
+		return err
+	}
+	return db.Where("verify_until < ?", time.Now()).Delete(&models.SigningKey{}).Error
+}
+
+// Start runs Maintain in the background at the given interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Maintain(); err != nil {
+				log.Printf("Error maintaining signing keys: %v", err)
+			}
+		}
+	}()
+}
+
+func reload() error {
+	var rows []models.SigningKey
+	if err := db.Where("verify_until > ?", time.Now()).Find(&rows).Error; err != nil {
+		return err
+	}
+	loaded := make(map[string]*key, len(rows))
+	for _, row := range rows {
+		k, err := decodeKey(row)
+		if err != nil {
+			log.Printf("Skipping unreadable signing key %s: %v", row.KID, err)
+			continue
+		}
+		loaded[k.id] = k
+	}
+	mu.Lock()
+	keys = loaded
+	mu.Unlock()
+	return nil
+}
+
+func rotate() error {
+	now := time.Now()
+	prepublish := opts.RotationInterval / 2
+	if prepublish > maxPrepublish {
+		prepublish = maxPrepublish
+	}
+
+	mu.RLock()
+	current := signingKeyAt(now)
+	mu.RUnlock()
+	if current == nil {
+		if err := addKey(now); err != nil {
+			return err
+		}
+		mu.RLock()
+		current = signingKeyAt(now)
+		mu.RUnlock()
+	}
+
+	mu.RLock()
+	upcoming := signingKeyAt(now.Add(prepublish))
+	mu.RUnlock()
+	if upcoming == nil {
+		return addKey(current.signUntil)
+	}
+	return nil
+}
+
+func addKey(notBefore time.Time) error {
+	row, err := generateKey(opts.Algorithm)
+	if err != nil {
+		return err
+	}
+	row.NotBefore = notBefore
+	row.SignUntil = notBefore.Add(opts.RotationInterval)
+	row.VerifyUntil = row.SignUntil.Add(opts.MaxTokenTTL)
+	row.CreatedAt = time.Now()
+	if err := db.Create(&row).Error; err != nil {
+		return err
+	}
+	k, err := decodeKey(row)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	keys[k.id] = k
+	mu.Unlock()
+	log.Printf("Created %s signing key %s, active from %s", k.algorithm, k.id, k.notBefore.Format(time.RFC3339))
+	return nil
+}
+
+// signingKeyAt returns the newest key of the configured algorithm that may
+// sign at t. Callers must hold mu.
+func signingKeyAt(t time.Time) *key {
+	var best *key
+	for _, k := range keys {
+		if k.algorithm != opts.Algorithm || t.Before(k.notBefore) || !t.Before(k.signUntil) {
+			continue
+		}
+		if best == nil || k.notBefore.After(best.notBefore) {
+			best = k
+		}
+	}
+	return best
+}
+
+// AcceptedTokenTTL returns the longest lifetime of any token Keyfunc still
+// accepts, which covers legacy tokens while LegacySecret is set. Anything
+// that must outlive every accepted token, like a revocation, has to be
+// kept at least this long.
+func AcceptedTokenTTL() time.Duration {
+	mu.RLock()
+	defer mu.RUnlock()
+	ttl := opts.MaxTokenTTL
+	if opts.LegacySecret != "" && LegacyTokenTTL > ttl {
+		ttl = LegacyTokenTTL
+	}
+	return ttl
+}
+
+// Sign signs claims with the active key and records its kid in the header.
+func Sign(claims jwt.Claims) (string, error) {
+	mu.RLock()
+	k := signingKeyAt(time.Now())
+	mu.RUnlock()
+	if k == nil {
+		return "", ErrNoSigningKey
+	}
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.signingKey)
+}
+
+// Keyfunc is a jwt.Keyfunc that selects the verification key by the kid
+// header and refuses tokens whose alg does not match that key.
+func Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		mu.RLock()
+		legacy := opts.LegacySecret
+		mu.RUnlock()
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok && legacy != "" {
+			return []byte(legacy), nil
+		}
+		return nil, ErrUnknownKey
+	}
+
+	mu.RLock()
+	k, ok := keys[kid]
+	mu.RUnlock()
+	if !ok || time.Now().After(k.verifyUntil) {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != k.algorithm {
+		return nil, fmt.Errorf("keyring: key %s does not use %s", kid, token.Method.Alg())
+	}
+	return k.verifyKey, nil
+}
+
+// JSONWebKey is the public half of a signing key as published in the JWKS.
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns every asymmetric key that is current, upcoming or still
+// verifying. HS256 secrets are never published.
+func JWKS() JSONWebKeySet {
+	mu.RLock()
+	list := make([]*key, 0, len(keys))
+	for _, k := range keys {
+		if k.algorithm != HS256 {
+			list = append(list, k)
+		}
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].notBefore.Before(list[j].notBefore) })
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range list {
+		jwk := JSONWebKey{Kid: k.id, Use: "sig", Alg: k.algorithm}
+		switch pub := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case *ecdsa.PublicKey:
+			point, err := pub.ECDH()
+			if err != nil {
+				continue
+			}
+			// Uncompressed point: 0x04 || X || Y
+			raw := point.Bytes()[1:]
+			jwk.Kty = "EC"
+			jwk.Crv = "P-256"
+			jwk.X = base64.RawURLEncoding.EncodeToString(raw[:len(raw)/2])
+			jwk.Y = base64.RawURLEncoding.EncodeToString(raw[len(raw)/2:])
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+func signingMethod(algorithm string) jwt.SigningMethod {
+	switch algorithm {
+	case HS256:
+		return jwt.SigningMethodHS256
+	case RS256:
+		return jwt.SigningMethodRS256
+	case ES256:
+		return jwt.SigningMethodES256
+	case EdDSA:
+		return SigningMethodEd25519
+	}
+	return nil
+}
+
+// generateKey creates key material for algorithm. Asymmetric keys are stored
+// as PKCS#8 PEM, HMAC secrets as base64.
+func generateKey(algorithm string) (models.SigningKey, error) {
+	kid, err := secure.RandomToken(12)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	row := models.SigningKey{KID: kid, Algorithm: algorithm}
+
+	var private crypto.PrivateKey
+	switch algorithm {
+	case HS256:
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return models.SigningKey{}, err
+		}
+		row.PrivateKey = base64.StdEncoding.EncodeToString(secret)
+		return row, nil
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case ES256:
+		private, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return models.SigningKey{}, fmt.Errorf("keyring: unsupported algorithm %q", algorithm)
+	}
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return models.SigningKey{}, err
+	}
+	row.PrivateKey = string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	return row, nil
+}
+
+func decodeKey(row models.SigningKey) (*key, error) {
+	k := &key{
+		id:          row.KID,
+		algorithm:   row.Algorithm,
+		method:      signingMethod(row.Algorithm),
+		notBefore:   row.NotBefore,
+		signUntil:   row.SignUntil,
+		verifyUntil: row.VerifyUntil,
+	}
+	if k.method == nil {
+		return nil, fmt.Errorf("unsupported algorithm %q", row.Algorithm)
+	}
+
+	if row.Algorithm == HS256 {
+		secret, err := base64.StdEncoding.DecodeString(row.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		k.signingKey, k.verifyKey = secret, secret
+		return k, nil
+	}
+
+	block, _ := pem.Decode([]byte(row.PrivateKey))
+	if block == nil {
+		return nil, errors.New("invalid PEM")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		if row.Algorithm == RS256 {
+			k.signingKey, k.verifyKey = p, &p.PublicKey
+		}
+	case *ecdsa.PrivateKey:
+		if row.Algorithm == ES256 {
+			k.signingKey, k.verifyKey = p, &p.PublicKey
+		}
+	case ed25519.PrivateKey:
+		if row.Algorithm == EdDSA {
+			k.signingKey, k.verifyKey = p, p.Public().(ed25519.PublicKey)
+		}
+	}
+	if k.signingKey == nil {
+		return nil, fmt.Errorf("key type %T does not match %s", private, row.Algorithm)
+	}
+	return k, nil
+}
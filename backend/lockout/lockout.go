@@ -0,0 +1,211 @@
+// lockout/lockout.go
+package lockout
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Policy decides how failed logins are throttled. Failures older than Window
+// are forgotten.
+type Policy struct {
+	// MaxFailures locks a username after this many failures in a row.
+	MaxFailures int
+	// MaxFailuresPerIP blocks a client address for LockoutDuration after
+	// this many failures across any usernames.
+	MaxFailuresPerIP int
+	// BackoffAfter failures, each further failure doubles the delay before
+	// the next attempt, starting at BackoffBase and capped at BackoffMax.
+	BackoffAfter    int
+	BackoffBase     time.Duration
+	BackoffMax      time.Duration
+	LockoutDuration time.Duration
+	Window          time.Duration
+}
+
+// Result describes the state of one key after a failure.
+type Result struct {
+	Failures   int
+	RetryAfter time.Duration
+	// Locked is true only on the failure that triggered a lockout.
+	Locked bool
+}
+
+var (
+	mu     sync.RWMutex
+	db     *gorm.DB
+	policy Policy
+)
+
+// Init sets the database and policy used by the tracker.
+func Init(database *gorm.DB, p Policy) {
+	mu.Lock()
+	db = database
+	policy = p
+	mu.Unlock()
+}
+
+func usernameKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller must wait before another attempt for
+// username from ip, and whether the wait is a lockout rather than backoff.
+// Attempts are allowed when the tracker is not initialized.
+func Check(username, ip string) (time.Duration, bool) {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return 0, false
+	}
+
+	keys := []string{usernameKey(username)}
+	if ip != "" {
+		keys = append(keys, ipKey(ip))
+	}
+	var rows []models.LoginThrottle
+	if err := database.Where("throttle_key IN ? AND blocked_until > ?", keys, time.Now()).Find(&rows).Error; err != nil {
+		log.Printf("Error checking login throttle: %v", err)
+		return 0, false
+	}
+
+	var wait time.Duration
+	locked := false
+	for _, row := range rows {
+		if d := time.Until(*row.BlockedUntil); d > wait {
+			wait = d
+		}
+		locked = locked || row.Locked
+	}
+	return wait, locked
+}
+
+// RecordFailure counts a failed attempt against both username and ip.
+func RecordFailure(username, ip string) (user, client Result) {
+	mu.RLock()
+	database, p := db, policy
+	mu.RUnlock()
+	if database == nil {
+		return Result{}, Result{}
+	}
+
+	user = fail(database, usernameKey(username), p.MaxFailures, p)
+	if ip != "" {
+		client = fail(database, ipKey(ip), p.MaxFailuresPerIP, p)
+	}
+	return user, client
+}
+
+func fail(database *gorm.DB, key string, maxFailures int, p Policy) Result {
+	now := time.Now()
+	var row models.LoginThrottle
+	err := database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.LoginThrottle{Key: key, LastFailureAt: now}).Error; err != nil {
+			return err
+		}
+		// Increment in SQL so concurrent failures are all counted
+		if err := tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).Updates(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN last_failure_at < ? THEN 1 ELSE failures + 1 END", now.Add(-p.Window)),
+			"last_failure_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("throttle_key = ?", key).First(&row).Error; err != nil {
+			return err
+		}
+
+		var blockedUntil *time.Time
+		locked := false
+		if maxFailures > 0 && row.Failures >= maxFailures {
+			until := now.Add(p.LockoutDuration)
+			blockedUntil, locked = &until, true
+		} else if delay := backoff(row.Failures, p); delay > 0 {
+			until := now.Add(delay)
+			blockedUntil = &until
+		}
+		updates := map[string]interface{}{"blocked_until": blockedUntil, "locked": locked}
+		if locked {
+			// Start counting afresh once the lockout ends
+			updates["failures"] = 0
+		}
+		row.BlockedUntil, row.Locked = blockedUntil, locked
+		return tx.Model(&models.LoginThrottle{}).Where("throttle_key = ?", key).Updates(updates).Error
+	})
+	if err != nil {
+		log.Printf("Error recording failed login for %s: %v", key, err)
+		return Result{}
+	}
+
+	result := Result{Failures: row.Failures, Locked: row.Locked}
+	if row.BlockedUntil != nil {
+		result.RetryAfter = row.BlockedUntil.Sub(now)
+	}
+	return result
+}
+
+func backoff(failures int, p Policy) time.Duration {
+	if p.BackoffBase <= 0 || failures <= p.BackoffAfter {
+		return 0
+	}
+	delay := p.BackoffBase
+	for i := p.BackoffAfter + 1; i < failures; i++ {
+		delay *= 2
+		if p.BackoffMax > 0 && delay >= p.BackoffMax {
+			return p.BackoffMax
+		}
+	}
+	return delay
+}
+
+// Reset forgets the failures recorded for username, after a successful login
+// or when the owner unlocks the account. Failures from the client IP are
+// kept so one valid account cannot be used to reset an attacker's address.
+func Reset(username string) {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return
+	}
+	if err := database.Where("throttle_key = ?", usernameKey(username)).Delete(&models.LoginThrottle{}).Error; err != nil {
+		log.Printf("Error resetting login throttle for %s: %v", username, err)
+	}
+}
+
+// Purge deletes throttles that are neither blocking nor within the window.
+func Purge() error {
+	mu.RLock()
+	database, p := db, policy
+	mu.RUnlock()
+	if database == nil {
+		return nil
+	}
+	now := time.Now()
+	return database.Where("last_failure_at < ? AND (blocked_until IS NULL OR blocked_until < ?)", now.Add(-p.Window), now).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// Start runs Purge in the background at the given interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := Purge(); err != nil {
+				log.Printf("Error purging login throttles: %v", err)
+			}
+		}
+	}()
+}
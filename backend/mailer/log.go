@@ -0,0 +1,41 @@
+// mailer/log.go
+package mailer
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+)
+
+// LogMailer writes messages to a file, or to the standard logger when Path
+// is empty. It is meant for development and for environments without SMTP.
+type LogMailer struct {
+	Path string
+	From string
+	mu   sync.Mutex
+}
+
+func NewLogMailer(path, from string) *LogMailer {
+	return &LogMailer{Path: path, From: from}
+}
+
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	data := format(m.From, msg)
+	if m.Path == "" {
+		log.Printf("Outgoing email:\n%s", data)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, "\r\n.\r\n"...)); err != nil {
+		return err
+	}
+	return nil
+}
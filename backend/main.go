@@ -4,13 +4,32 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
+	"time"
+	// Recurring tasks follow users' time zones, and the container image
+	// ships without a zoneinfo database
+	_ "time/tzdata"
 
-	gorillaHandlers "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/attachments"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/blobstore"
+	"github.com/harip/GoTasker/clientip"
 	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/dataexport"
 	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/lockout"
+	"github.com/harip/GoTasker/mailer"
 	"github.com/harip/GoTasker/middleware"
 	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/notify"
+	"github.com/harip/GoTasker/oidc"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/reminders"
+	"github.com/harip/GoTasker/retention"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/workflows"
 	"github.com/joho/godotenv"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -47,12 +66,73 @@ func migrateUserTable(db *gorm.DB) bool {
 	return true
 }
 
+// migratePasswordHashes hashes any password still stored in plaintext so
+// accounts that never log in again are protected too. Rows that are already
+// hashed are left for Login to upgrade, since that needs the plaintext.
+// Every row is checked with password.IsHashed: a plaintext password may
+// itself start with "$", so a prefix filter in SQL would miss it.
+func migratePasswordHashes(db *gorm.DB) bool {
+	var users []models.User
+	hashedCount := 0
+	result := db.Unscoped().Select("id", "password").
+		FindInBatches(&users, 100, func(tx *gorm.DB, batch int) error {
+			for _, user := range users {
+				if password.IsHashed(user.Password) {
+					continue
+				}
+				hashed, err := password.Hash(user.Password)
+				if err != nil {
+					return err
+				}
+				if err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).
+					UpdateColumn("password", hashed).Error; err != nil {
+					return err
+				}
+				hashedCount++
+			}
+			return nil
+		})
+	if result.Error != nil {
+		log.Printf("Password hash migration failed: %v", result.Error)
+		return false
+	}
+	if hashedCount > 0 {
+		log.Printf("Hashed %d plaintext passwords", hashedCount)
+	}
+	return true
+}
+
+// promoteAdmins grants the admin role to the configured usernames so a new
+// deployment has someone who can use the admin API.
+func promoteAdmins(db *gorm.DB, usernames string) bool {
+	names := strings.FieldsFunc(usernames, func(r rune) bool { return r == ',' || r == ' ' })
+	if len(names) == 0 {
+		return true
+	}
+	result := db.Model(&models.User{}).Where("username IN ? AND role <> ?", names, models.RoleAdmin).
+		Update("role", models.RoleAdmin)
+	if result.Error != nil {
+		log.Printf("Promoting admins failed: %v", result.Error)
+		return false
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Promoted %d users to admin", result.RowsAffected)
+	}
+	return true
+}
+
 func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("Warning: Error loading .env file, using default environment variables")
 	}
 	config.LoadConfig()
 
+	hashParams := password.DefaultParams()
+	hashParams.Algorithm = config.AppConfig.PasswordHashAlgorithm
+	if err := password.SetDefaultParams(hashParams); err != nil {
+		log.Fatalf("Invalid password hashing configuration: %v", err)
+	}
+
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
 		config.AppConfig.DBHost,
@@ -68,34 +148,215 @@ func main() {
 	}
 	log.Println("Connected to the database")
 
-	if err := db.AutoMigrate(&models.User{}, &models.Task{}); err != nil || !migrateUserTable(db) {
+	// Tasks from before workflows need a category once the column exists
+	hadStatusCategories := db.Migrator().HasColumn(&models.Task{}, "StatusCategory")
+	if err := db.AutoMigrate(&models.User{}, &models.Task{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{}, &models.SigningKey{}, &models.PersonalAccessToken{}, &models.UserToken{}, &models.RecoveryCode{}, &models.LoginThrottle{}, &models.AuditEvent{}, &models.UserIdentity{}, &models.DataExport{}, &models.Session{}, &models.Tag{}, &models.TaskDependency{}, &models.Reminder{}, &models.Notification{}, &models.Comment{}, &models.CommentRevision{}, &models.Attachment{}, &models.Blob{}, &models.Workflow{}, &models.WorkflowStatus{}, &models.WorkflowTransition{}); err != nil || !migrateUserTable(db) {
 		log.Fatalf("Auto-migration failed: %v", err)
 	}
 	log.Println("Database schema migrated")
 
+	if !hadStatusCategories {
+		if err := workflows.MigrateTasks(db); err != nil {
+			log.Fatalf("Task status migration failed: %v", err)
+		}
+		log.Println("Mapped existing tasks onto the default workflow")
+	}
+	if !migratePasswordHashes(db) {
+		log.Fatal("Password hash migration failed")
+	}
+	if !promoteAdmins(db, config.AppConfig.AdminUsernames) {
+		log.Fatal("Admin promotion failed")
+	}
+
 	h := &Handler{DB: db}
 	handlers.SetDB(h.DB)
 	if !handlers.IsDBInitialized() {
 		log.Fatal("Failed to initialize handlers DB")
 	}
 	log.Println("Handlers DB initialized")
+	middleware.SetDB(h.DB)
+
+	var mail mailer.Mailer
+	switch config.AppConfig.MailDriver {
+	case "smtp":
+		mail = mailer.NewSMTPMailer(
+			config.AppConfig.SMTPHost,
+			config.AppConfig.SMTPPort,
+			config.AppConfig.SMTPUsername,
+			config.AppConfig.SMTPPassword,
+			config.AppConfig.MailFrom,
+		)
+	case "log":
+		mail = mailer.NewLogMailer(config.AppConfig.MailLogPath, config.AppConfig.MailFrom)
+	default:
+		log.Fatalf("Unknown MAIL_DRIVER %q, expected smtp or log", config.AppConfig.MailDriver)
+	}
+	handlers.SetMailer(mail)
+
+	if err := keyring.Init(db, keyring.Options{
+		Algorithm:        config.AppConfig.JWTSigningAlgorithm,
+		RotationInterval: config.AppConfig.JWTKeyRotation,
+		MaxTokenTTL:      config.AppConfig.AccessTokenTTL,
+		LegacySecret:     config.AppConfig.JWTSecret,
+	}); err != nil {
+		log.Fatalf("Failed to initialize signing keys: %v", err)
+	}
+	keyring.Start(5 * time.Minute)
+
+	if err := revocation.Init(db, keyring.AcceptedTokenTTL()); err != nil {
+		log.Fatalf("Failed to load token revocations: %v", err)
+	}
+	revocation.Start(30*time.Second, time.Hour)
+
+	clientip.SetTrustProxy(config.AppConfig.TrustProxyHeaders)
+	audit.Init(db)
+	lockout.Init(db, lockout.Policy{
+		MaxFailures:      config.AppConfig.LoginMaxFailures,
+		MaxFailuresPerIP: config.AppConfig.LoginMaxFailuresPerIP,
+		BackoffAfter:     config.AppConfig.LoginBackoffAfter,
+		BackoffBase:      config.AppConfig.LoginBackoffBase,
+		BackoffMax:       config.AppConfig.LoginBackoffMax,
+		LockoutDuration:  config.AppConfig.LoginLockoutDuration,
+		Window:           config.AppConfig.LoginFailureWindow,
+	})
+	lockout.Start(time.Hour)
+
+	retention.Init(db, config.AppConfig.AccountPurgeGrace)
+	retention.Start(time.Hour)
+
+	if err := dataexport.Init(db, config.AppConfig.ExportDir, config.AppConfig.ExportTTL); err != nil {
+		log.Fatalf("Failed to initialize data exports: %v", err)
+	}
+	dataexport.Start(15 * time.Minute)
+
+	middleware.StartSessionActivity(30 * time.Second)
+
+	reminders.Init(db, map[string]notify.Notifier{
+		models.ReminderInbox:   notify.NewInboxNotifier(db),
+		models.ReminderEmail:   notify.NewEmailNotifier(mail),
+		models.ReminderWebhook: notify.NewWebhookNotifier(config.AppConfig.WebhookSecret, config.AppConfig.WebhookAllowPrivate),
+	})
+	reminders.Start(30 * time.Second)
+
+	var blobs blobstore.BlobStore
+	switch config.AppConfig.BlobDriver {
+	case "local":
+		if blobs, err = blobstore.NewLocalStore(config.AppConfig.BlobDir); err != nil {
+			log.Fatalf("Failed to initialize blob storage: %v", err)
+		}
+	case "s3":
+		blobs = blobstore.NewS3Store(
+			config.AppConfig.S3Endpoint,
+			config.AppConfig.S3Region,
+			config.AppConfig.S3Bucket,
+			config.AppConfig.S3AccessKey,
+			config.AppConfig.S3SecretKey,
+		)
+	default:
+		log.Fatalf("Unknown BLOB_DRIVER %q, expected local or s3", config.AppConfig.BlobDriver)
+	}
+	attachments.Init(db, blobs, attachments.Limits{
+		MaxFileSize: int64(config.AppConfig.AttachmentMaxSize),
+		UserQuota:   int64(config.AppConfig.AttachmentUserQuota),
+	})
+	attachments.Start(time.Hour, time.Hour)
+
+	if config.AppConfig.OIDCIssuerURL != "" {
+		handlers.SetOIDCProvider(oidc.NewProvider(oidc.Config{
+			IssuerURL:    config.AppConfig.OIDCIssuerURL,
+			ClientID:     config.AppConfig.OIDCClientID,
+			ClientSecret: config.AppConfig.OIDCClientSecret,
+			RedirectURL:  config.AppConfig.OIDCRedirectURL,
+			Scopes:       strings.Fields(config.AppConfig.OIDCScopes),
+		}))
+		log.Printf("OIDC single sign-on enabled for %s", config.AppConfig.OIDCIssuerURL)
+	}
 
 	r := mux.NewRouter()
 
+	r.HandleFunc("/.well-known/jwks.json", handlers.JWKS).Methods("GET")
 	r.HandleFunc("/register", handlers.Register).Methods("POST")
-	r.HandleFunc("/login", handlers.Login).Methods("POST")
-	r.Handle("/tasks", middleware.JWTMiddleware(http.HandlerFunc(handlers.CreateTask))).Methods("POST")
-	r.Handle("/tasks", middleware.JWTMiddleware(http.HandlerFunc(handlers.GetTasks))).Methods("GET")
-	r.Handle("/tasks/{id}", middleware.JWTMiddleware(http.HandlerFunc(handlers.GetTaskByID))).Methods("GET")
-	r.Handle("/tasks/{id}", middleware.JWTMiddleware(http.HandlerFunc(handlers.UpdateTask))).Methods("PUT")
-	r.Handle("/tasks/{id}", middleware.JWTMiddleware(http.HandlerFunc(handlers.DeleteTask))).Methods("DELETE")
-
-	cors := gorillaHandlers.CORS(
-		gorillaHandlers.AllowedOrigins([]string{"http://localhost:3000"}),
-		gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}),
-		gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
-	)
+	r.Handle("/login", middleware.RateLimit(http.HandlerFunc(handlers.Login))).Methods("POST")
+	r.Handle("/login/mfa", middleware.RateLimit(http.HandlerFunc(handlers.LoginMFA))).Methods("POST")
+	r.HandleFunc("/account/unlock", handlers.UnlockAccount).Methods("POST")
+	r.HandleFunc("/auth/oidc/login", handlers.OIDCLogin).Methods("GET")
+	r.HandleFunc("/auth/oidc/callback", handlers.OIDCCallback).Methods("GET")
+	r.HandleFunc("/token/refresh", handlers.RefreshToken).Methods("POST")
+	r.HandleFunc("/password/forgot", handlers.ForgotPassword).Methods("POST")
+	r.HandleFunc("/password/reset", handlers.ResetPassword).Methods("POST")
+	r.HandleFunc("/email/verify", handlers.VerifyEmail).Methods("POST")
+	r.Handle("/email/verify/resend", middleware.RequireOwnLogin(http.HandlerFunc(handlers.ResendVerificationEmail))).Methods("POST")
+	r.Handle("/session/csrf", middleware.RequireLogin(http.HandlerFunc(handlers.GetCSRFToken))).Methods("GET")
+	r.Handle("/logout", middleware.RequireLogin(http.HandlerFunc(handlers.Logout))).Methods("POST")
+	r.Handle("/logout-all", middleware.RequireOwnLogin(http.HandlerFunc(handlers.LogoutAll))).Methods("POST")
+	r.Handle("/me", middleware.RequireLogin(http.HandlerFunc(handlers.GetMe))).Methods("GET")
+	r.Handle("/me", middleware.RequireOwnLogin(http.HandlerFunc(handlers.UpdateMe))).Methods("PATCH")
+	r.Handle("/me", middleware.RequireOwnLogin(http.HandlerFunc(handlers.DeleteMe))).Methods("DELETE")
+	r.Handle("/me/exports", middleware.RequireOwnLogin(http.HandlerFunc(handlers.RequestDataExport))).Methods("POST")
+	r.Handle("/me/exports", middleware.RequireOwnLogin(http.HandlerFunc(handlers.GetDataExports))).Methods("GET")
+	r.Handle("/me/exports/{id}", middleware.RequireOwnLogin(http.HandlerFunc(handlers.GetDataExport))).Methods("GET")
+	r.HandleFunc("/exports/download", handlers.DownloadDataExport).Methods("GET")
+	r.Handle("/me/sessions", middleware.RequireLogin(http.HandlerFunc(handlers.GetSessions))).Methods("GET")
+	r.Handle("/me/sessions/{id}", middleware.RequireOwnLogin(http.HandlerFunc(handlers.RevokeSession))).Methods("DELETE")
+	r.Handle("/me/notifications", middleware.RequireLogin(http.HandlerFunc(handlers.GetNotifications))).Methods("GET")
+	r.Handle("/me/notifications/read", middleware.RequireLogin(http.HandlerFunc(handlers.MarkNotificationRead))).Methods("POST")
+	r.Handle("/me/notifications/{id}/read", middleware.RequireLogin(http.HandlerFunc(handlers.MarkNotificationRead))).Methods("POST")
+	r.Handle("/me/password", middleware.RequireOwnLogin(http.HandlerFunc(handlers.ChangePassword))).Methods("POST")
+	r.Handle("/mfa/totp/enroll", middleware.RequireOwnLogin(http.HandlerFunc(handlers.EnrollTOTP))).Methods("POST")
+	r.Handle("/mfa/totp/confirm", middleware.RequireOwnLogin(http.HandlerFunc(handlers.ConfirmTOTP))).Methods("POST")
+	r.Handle("/mfa/totp/disable", middleware.RequireOwnLogin(http.HandlerFunc(handlers.DisableTOTP))).Methods("POST")
+	r.Handle("/mfa/recovery-codes", middleware.RequireOwnLogin(http.HandlerFunc(handlers.RegenerateRecoveryCodes))).Methods("POST")
+	r.Handle("/tokens", middleware.RequireOwnLogin(http.HandlerFunc(handlers.CreateAccessToken))).Methods("POST")
+	r.Handle("/tokens", middleware.RequireOwnLogin(http.HandlerFunc(handlers.GetAccessTokens))).Methods("GET")
+	r.Handle("/tokens/{id}", middleware.RequireOwnLogin(http.HandlerFunc(handlers.RevokeAccessToken))).Methods("DELETE")
+
+	admin := middleware.RequireRole(models.RoleAdmin)
+	r.Handle("/admin/users", admin(http.HandlerFunc(handlers.AdminListUsers))).Methods("GET")
+	r.Handle("/admin/users/{id}", admin(http.HandlerFunc(handlers.AdminDeleteUser))).Methods("DELETE")
+	r.Handle("/admin/users/{id}/disable", admin(http.HandlerFunc(handlers.AdminDisableUser))).Methods("POST")
+	r.Handle("/admin/users/{id}/enable", admin(http.HandlerFunc(handlers.AdminEnableUser))).Methods("POST")
+	r.Handle("/admin/users/{id}/role", admin(http.HandlerFunc(handlers.AdminSetUserRole))).Methods("PUT")
+	r.Handle("/admin/users/{id}/password-reset", admin(http.HandlerFunc(handlers.AdminSendPasswordReset))).Methods("POST")
+	r.Handle("/admin/impersonate/{id}", admin(http.HandlerFunc(handlers.AdminImpersonate))).Methods("POST")
+
+	// Task routes also accept personal access tokens with the matching scope
+	tasksRead := middleware.RequireScope(models.ScopeTasksRead)
+	tasksWrite := middleware.RequireScope(models.ScopeTasksWrite)
+	r.Handle("/tasks", tasksWrite(http.HandlerFunc(handlers.CreateTask))).Methods("POST")
+	r.Handle("/tasks", tasksRead(http.HandlerFunc(handlers.GetTasks))).Methods("GET")
+	r.Handle("/tasks/{id}", tasksRead(http.HandlerFunc(handlers.GetTaskByID))).Methods("GET")
+	r.Handle("/tasks/{id}", tasksWrite(http.HandlerFunc(handlers.UpdateTask))).Methods("PUT")
+	r.Handle("/tasks/{id}", tasksWrite(http.HandlerFunc(handlers.DeleteTask))).Methods("DELETE")
+	r.Handle("/tasks/{id}/children", tasksRead(http.HandlerFunc(handlers.GetSubtasks))).Methods("GET")
+	r.Handle("/tasks/{id}/move", tasksWrite(http.HandlerFunc(handlers.MoveTask))).Methods("POST")
+	r.Handle("/tasks/{id}/blockers", tasksRead(http.HandlerFunc(handlers.GetBlockers))).Methods("GET")
+	r.Handle("/tasks/{id}/blockers", tasksWrite(http.HandlerFunc(handlers.AddBlocker))).Methods("POST")
+	r.Handle("/tasks/{id}/blockers/{blocker_id}", tasksWrite(http.HandlerFunc(handlers.RemoveBlocker))).Methods("DELETE")
+	r.Handle("/tasks/{id}/critical-path", tasksRead(http.HandlerFunc(handlers.GetCriticalPath))).Methods("GET")
+	r.Handle("/tasks/{id}/occurrences", tasksRead(http.HandlerFunc(handlers.GetOccurrences))).Methods("GET")
+	r.Handle("/tasks/{id}/comments", tasksRead(http.HandlerFunc(handlers.GetComments))).Methods("GET")
+	r.Handle("/tasks/{id}/comments", tasksWrite(http.HandlerFunc(handlers.CreateComment))).Methods("POST")
+	r.Handle("/tasks/{id}/comments/{comment_id}", tasksWrite(http.HandlerFunc(handlers.UpdateComment))).Methods("PUT")
+	r.Handle("/tasks/{id}/comments/{comment_id}", tasksWrite(http.HandlerFunc(handlers.DeleteComment))).Methods("DELETE")
+	r.Handle("/tasks/{id}/comments/{comment_id}/history", tasksRead(http.HandlerFunc(handlers.GetCommentHistory))).Methods("GET")
+	r.Handle("/tasks/{id}/attachments", tasksRead(http.HandlerFunc(handlers.GetAttachments))).Methods("GET")
+	r.Handle("/tasks/{id}/attachments", tasksWrite(http.HandlerFunc(handlers.UploadAttachment))).Methods("POST")
+	r.Handle("/tasks/{id}/attachments/{attachment_id}", tasksRead(http.HandlerFunc(handlers.DownloadAttachment))).Methods("GET")
+	r.Handle("/tasks/{id}/attachments/{attachment_id}", tasksWrite(http.HandlerFunc(handlers.DeleteAttachment))).Methods("DELETE")
+	r.Handle("/tasks/{id}/reminders", tasksRead(http.HandlerFunc(handlers.GetReminders))).Methods("GET")
+	r.Handle("/tasks/{id}/reminders", tasksWrite(http.HandlerFunc(handlers.CreateReminder))).Methods("POST")
+	r.Handle("/tasks/{id}/reminders/{reminder_id}", tasksWrite(http.HandlerFunc(handlers.DeleteReminder))).Methods("DELETE")
+	r.Handle("/tasks/{id}/tags/{tag_id}", tasksWrite(http.HandlerFunc(handlers.AttachTag))).Methods("POST")
+	r.Handle("/tasks/{id}/tags/{tag_id}", tasksWrite(http.HandlerFunc(handlers.DetachTag))).Methods("DELETE")
+	r.Handle("/workflow", tasksRead(http.HandlerFunc(handlers.GetWorkflow))).Methods("GET")
+	r.Handle("/workflow", tasksWrite(http.HandlerFunc(handlers.UpdateWorkflow))).Methods("PUT")
+	r.Handle("/tags", tasksRead(http.HandlerFunc(handlers.GetTags))).Methods("GET")
+	r.Handle("/tags", tasksWrite(http.HandlerFunc(handlers.CreateTag))).Methods("POST")
+	r.Handle("/tags/{id}", tasksWrite(http.HandlerFunc(handlers.UpdateTag))).Methods("PUT")
+	r.Handle("/tags/{id}", tasksWrite(http.HandlerFunc(handlers.DeleteTag))).Methods("DELETE")
+
+	cors := middleware.CORS(config.AppConfig.CORSAllowedOrigins)
 
 	fmt.Println("Server running on :8080")
-	log.Fatal(http.ListenAndServe(":8080", cors(r)))
+	log.Fatal(http.ListenAndServe(":8080", cors(middleware.CSRF(r))))
 }
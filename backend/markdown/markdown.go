@@ -0,0 +1,192 @@
+// markdown/markdown.go
+package markdown
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Render turns a Markdown subset into HTML that is safe to embed: all input
+// is escaped first and only the tags produced here are emitted. It supports
+// paragraphs, headings, block quotes, lists, fenced code, inline code,
+// bold, italic, strikethrough, links and @mentions. Links are kept only for
+// http, https and mailto URLs.
+func Render(src string) string {
+	var b strings.Builder
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			i++
+		case strings.HasPrefix(trimmed, "```"):
+			i++
+			var code []string
+			for i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```") {
+				code = append(code, lines[i])
+				i++
+			}
+			i++ // closing fence
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+		case heading.MatchString(trimmed):
+			m := heading.FindStringSubmatch(trimmed)
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", len(m[1]), inline(m[2]), len(m[1]))
+			i++
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quoted = append(quoted, strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")))
+			}
+			b.WriteString("<blockquote>" + paragraph(quoted) + "</blockquote>\n")
+		case bullet.MatchString(line) || numbered.MatchString(line):
+			marker, tag := bullet, "ul"
+			if numbered.MatchString(line) {
+				marker, tag = numbered, "ol"
+			}
+			b.WriteString("<" + tag + ">")
+			for ; i < len(lines) && marker.MatchString(lines[i]); i++ {
+				b.WriteString("<li>" + inline(marker.ReplaceAllString(lines[i], "")) + "</li>")
+			}
+			b.WriteString("</" + tag + ">\n")
+		default:
+			var para []string
+			for ; i < len(lines) && startsParagraph(lines[i]); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			b.WriteString(paragraph(para) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+var (
+	heading  = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	bullet   = regexp.MustCompile(`^\s*[-*+]\s+`)
+	numbered = regexp.MustCompile(`^\s*\d+[.)]\s+`)
+
+	link          = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	bold          = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	italic        = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	italicUnder   = regexp.MustCompile(`(^|\W)_(\S(?:[^_]*?\S)?)_(\W|$)`)
+	strikethrough = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	mention       = regexp.MustCompile(`(^|[^\w@./])@([A-Za-z0-9_](?:[A-Za-z0-9_.-]*[A-Za-z0-9_])?)`)
+	placeholder   = regexp.MustCompile("\x00(\\d+)\x00")
+)
+
+// startsParagraph reports whether line continues a paragraph rather than
+// starting another kind of block.
+func startsParagraph(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed != "" && !strings.HasPrefix(trimmed, "```") && !strings.HasPrefix(trimmed, ">") &&
+		!heading.MatchString(trimmed) && !bullet.MatchString(line) && !numbered.MatchString(line)
+}
+
+// paragraph renders lines as one paragraph, keeping their line breaks as
+// chat-style comments expect.
+func paragraph(lines []string) string {
+	rendered := make([]string, len(lines))
+	for i, line := range lines {
+		rendered[i] = inline(line)
+	}
+	return "<p>" + strings.Join(rendered, "<br>") + "</p>"
+}
+
+// inline renders the spans of one line. Code spans and links are swapped
+// for placeholders while the rest is formatted, so formatting never
+// reaches inside them.
+func inline(s string) string {
+	var held []string
+	hold := func(fragment string) string {
+		held = append(held, fragment)
+		return "\x00" + strconv.Itoa(len(held)-1) + "\x00"
+	}
+
+	var b strings.Builder
+	for i, part := range strings.Split(strings.ReplaceAll(s, "\x00", ""), "`") {
+		// Odd parts are between backticks; an unclosed backtick is literal
+		if i%2 == 1 && i < strings.Count(s, "`") {
+			b.WriteString(hold("<code>" + html.EscapeString(part) + "</code>"))
+			continue
+		}
+		if i%2 == 1 {
+			b.WriteString("`")
+		}
+		b.WriteString(html.EscapeString(part))
+	}
+	out := b.String()
+
+	out = link.ReplaceAllStringFunc(out, func(m string) string {
+		parts := link.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[2])
+		if !safeURL(href) {
+			return m
+		}
+		return hold(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer">` + emphasis(parts[1]) + `</a>`)
+	})
+	out = emphasis(out)
+	out = mention.ReplaceAllString(out, `$1<span class="mention">@$2</span>`)
+
+	for strings.Contains(out, "\x00") {
+		out = placeholder.ReplaceAllStringFunc(out, func(m string) string {
+			n, _ := strconv.Atoi(strings.Trim(m, "\x00"))
+			return held[n]
+		})
+	}
+	return out
+}
+
+func emphasis(s string) string {
+	s = bold.ReplaceAllString(s, "<strong>$1</strong>")
+	s = italic.ReplaceAllString(s, "<em>$1</em>")
+	s = italicUnder.ReplaceAllString(s, "$1<em>$2</em>$3")
+	return strikethrough.ReplaceAllString(s, "<del>$1</del>")
+}
+
+func safeURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return true
+	}
+	return false
+}
+
+// Mentions returns the distinct usernames mentioned as @username in src,
+// in order of first appearance. Mentions inside code are ignored.
+func Mentions(src string) []string {
+	var names []string
+	seen := map[string]bool{}
+	inFence := false
+	for _, line := range strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		parts := strings.Split(line, "`")
+		for i, part := range parts {
+			if i%2 == 1 && i < len(parts)-1 {
+				continue
+			}
+			for _, m := range mention.FindAllStringSubmatch(part, -1) {
+				if !seen[m[2]] {
+					seen[m[2]] = true
+					names = append(names, m[2])
+				}
+			}
+		}
+	}
+	return names
+}
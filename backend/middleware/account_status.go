@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/gorm"
+)
+
+// accountStatusTTL bounds how long a replica that did not handle the
+// disable request keeps accepting the account's tokens. The replica that
+// did handle it also revokes the tokens, which takes effect at once.
+const accountStatusTTL = 15 * time.Second
+
+var accountStatus = cache.New(accountStatusTTL, time.Minute)
+
+// accountActive reports whether userID exists and is not disabled.
+func accountActive(userID uint) bool {
+	key := strconv.FormatUint(uint64(userID), 10)
+	if active, ok := accountStatus.Get(key); ok {
+		return active.(bool)
+	}
+	if db == nil {
+		return true
+	}
+
+	var user models.User
+	err := db.Select("id", "disabled_at").First(&user, userID).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Error loading account status for user_id %d: %v", userID, err)
+		return false
+	}
+	active := err == nil && user.DisabledAt == nil
+	accountStatus.Set(key, active, cache.DefaultExpiration)
+	return active
+}
+
+// ForgetAccountStatus drops the cached status for userID so a change made
+// by an admin applies to the next request.
+func ForgetAccountStatus(userID uint) {
+	accountStatus.Delete(strconv.FormatUint(uint64(userID), 10))
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/harip/GoTasker/auth"
+)
+
+// loginAuthenticators accept the credentials a user holds after logging
+// in, as opposed to API keys that are limited to some routes.
+var loginAuthenticators = auth.Chain{JWTAuthenticator{}, SessionCookieAuthenticator{}}
+
+// Authenticate runs the authenticator chain and stores the resulting
+// principal in the request context. Requests without a credential, or with
+// a bad one, are rejected.
+func Authenticate(authenticator auth.Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, err := authenticator.Authenticate(r)
+			if errors.Is(err, auth.ErrNoCredentials) {
+				log.Println("Error: Authorization header is missing")
+				http.Error(w, `{"error": "Authorization header is required"}`, http.StatusUnauthorized)
+				return
+			}
+			var authErr *auth.Error
+			if errors.As(err, &authErr) {
+				http.Error(w, `{"error": "`+authErr.Message+`"}`, authErr.Status)
+				return
+			}
+			if err != nil {
+				log.Printf("Error authenticating request: %v", err)
+				http.Error(w, `{"error": "Internal server error"}`, http.StatusInternalServerError)
+				return
+			}
+			if principal.SessionID != 0 {
+				touchSession(principal.SessionID)
+			}
+			r = r.WithContext(auth.NewContext(r.Context(), principal))
+			if principal.Impersonated() {
+				auditImpersonation(next, w, r, principal)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireLogin accepts a logged-in user's credentials.
+func RequireLogin(next http.Handler) http.Handler {
+	return Authenticate(loginAuthenticators)(next)
+}
@@ -0,0 +1,20 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	gorillaHandlers "github.com/gorilla/handlers"
+)
+
+// CORS allows the listed origins to call the API from a browser, including
+// with cookies so cookie sessions work cross-origin.
+func CORS(origins string) func(http.Handler) http.Handler {
+	allowed := strings.FieldsFunc(origins, func(r rune) bool { return r == ',' || r == ' ' })
+	return gorillaHandlers.CORS(
+		gorillaHandlers.AllowedOrigins(allowed),
+		gorillaHandlers.AllowedMethods([]string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}),
+		gorillaHandlers.AllowedHeaders([]string{"Content-Type", "Authorization", CSRFHeaderName}),
+		gorillaHandlers.AllowCredentials(),
+	)
+}
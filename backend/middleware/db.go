@@ -0,0 +1,14 @@
+package middleware
+
+import (
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+// SetDB gives the middleware access to the database for lookups that cannot
+// be answered from the token alone, such as personal access tokens.
+func SetDB(database *gorm.DB) {
+	db = database
+	accountStatus.Flush()
+}
@@ -1,66 +1,137 @@
 package middleware
 
 import (
-	"context"
+	"errors"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
 )
 
-func JWTMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			log.Println("Error: Authorization header is missing")
-			http.Error(w, `{"error": "Authorization header is required"}`, http.StatusUnauthorized)
-			return
-		}
+// bearerToken returns the token from an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) (string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return "", auth.ErrNoCredentials
+	}
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		log.Println("Error: Invalid token format, missing Bearer prefix")
+		return "", auth.Unauthorized("Invalid token format")
+	}
+	return strings.TrimPrefix(authHeader, "Bearer "), nil
+}
 
-		if !strings.HasPrefix(authHeader, "Bearer ") {
-			log.Println("Error: Invalid token format, missing Bearer prefix")
-			http.Error(w, `{"error": "Invalid token format"}`, http.StatusUnauthorized)
-			return
-		}
+// JWTAuthenticator accepts access tokens issued at login.
+type JWTAuthenticator struct{}
 
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
+func (JWTAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	tokenStr, err := bearerToken(r)
+	if err != nil {
+		return nil, err
+	}
+	if strings.HasPrefix(tokenStr, models.PersonalAccessTokenPrefix) {
+		return nil, auth.ErrNoCredentials
+	}
 
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				log.Printf("Error: Unexpected signing method: %v", token.Header["alg"])
-				return nil, http.ErrAbortHandler
-			}
-			return []byte(config.AppConfig.JWTSecret), nil
-		})
+	token, err := jwt.Parse(tokenStr, keyring.Keyfunc)
+	if err != nil || !token.Valid {
+		log.Printf("Error: Invalid or expired token: %v", err)
+		return nil, auth.Unauthorized("Invalid or expired token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		log.Println("Error: Invalid token claims format")
+		return nil, auth.Unauthorized("Invalid token claims")
+	}
+
+	var userID float64
+	switch id := claims["user_id"].(type) {
+	case float64:
+		userID = id
+	case int:
+		userID = float64(id)
+	default:
+		log.Println("Error: user_id in token claims is not a number")
+		return nil, auth.Unauthorized("Invalid token claims")
+	}
 
-		if err != nil || !token.Valid {
-			log.Printf("Error: Invalid or expired token: %v", err)
-			http.Error(w, `{"error": "Invalid or expired token"}`, http.StatusUnauthorized)
-			return
+	// Only access tokens are accepted here; purpose-bound tokens such as
+	// the pending MFA token carry a different typ.
+	if typ, ok := claims["typ"].(string); ok && typ != "access" {
+		log.Printf("Error: Token of type %s presented as access token", typ)
+		return nil, auth.Unauthorized("Invalid or expired token")
+	}
+
+	jti, _ := claims["jti"].(string)
+	issuedAt, _ := claims["iat"].(float64)
+	expiresAt, _ := claims["exp"].(float64)
+	issued := time.Unix(0, int64(issuedAt*1e9))
+	// Tokens minted for a session share its sid, so signing the session
+	// out revokes all of them at once
+	sid, _ := claims["sid"].(float64)
+	if revocation.IsRevoked(jti, uint(userID), issued) ||
+		(sid > 0 && revocation.IsRevoked(revocation.SessionKey(uint(sid)), uint(userID), issued)) {
+		log.Printf("Error: Revoked token presented for user_id %d", int(userID))
+		return nil, auth.Unauthorized("Token has been revoked")
+	}
+
+	if !accountActive(uint(userID)) {
+		log.Printf("Error: Token presented for disabled or deleted user_id %d", int(userID))
+		return nil, auth.Unauthorized("Account disabled")
+	}
+
+	var actor *auth.Actor
+	if act, ok := claims["act"]; ok {
+		if actor, err = parseActor(act); err != nil {
+			log.Printf("Error: Invalid act claim for user_id %d: %v", int(userID), err)
+			return nil, auth.Unauthorized("Invalid token claims")
 		}
+		// The admin signing out everywhere, losing their role or being
+		// disabled ends their impersonation tokens too
+		if revocation.IsRevoked("", actor.UserID, issued) || !accountActive(actor.UserID) {
+			log.Printf("Error: Impersonation token of revoked or disabled admin %d presented", actor.UserID)
+			return nil, auth.Unauthorized("Token has been revoked")
+		}
+	}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			var userID float64
-			switch id := claims["user_id"].(type) {
-			case float64:
-				userID = id
-			case int:
-				userID = float64(id)
-			default:
-				log.Println("Error: user_id in token claims is not a number")
-				http.Error(w, `{"error": "Invalid token claims"}`, http.StatusUnauthorized)
-				return
+	principal := &auth.Principal{
+		UserID:    uint(userID),
+		TokenID:   jti,
+		SessionID: uint(sid),
+		ExpiresAt: time.Unix(int64(expiresAt), 0),
+		Method:    auth.MethodJWT,
+		Actor:     actor,
+	}
+	principal.Username, _ = claims["username"].(string)
+	if list, ok := claims["roles"].([]interface{}); ok {
+		for _, role := range list {
+			if s, ok := role.(string); ok {
+				principal.Roles = append(principal.Roles, s)
 			}
-			ctx := context.WithValue(r.Context(), "user_id", userID)
-			r = r.WithContext(ctx)
-		} else {
-			log.Println("Error: Invalid token claims format")
-			http.Error(w, `{"error": "Invalid token claims"}`, http.StatusUnauthorized)
-			return
 		}
+	}
+	return principal, nil
+}
 
-		next.ServeHTTP(w, r)
-	})
+// parseActor reads the act claim of an impersonation token. Its sub is the
+// acting admin's user ID.
+func parseActor(claim interface{}) (*auth.Actor, error) {
+	act, ok := claim.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("act claim is not an object")
+	}
+	sub, _ := act["sub"].(string)
+	id, err := strconv.ParseUint(sub, 10, 64)
+	if err != nil || id == 0 {
+		return nil, errors.New("act claim has no valid sub")
+	}
+	username, _ := act["username"].(string)
+	return &auth.Actor{UserID: uint(id), Username: username}, nil
 }
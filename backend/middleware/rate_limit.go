@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"sync"
 
+	"github.com/harip/GoTasker/clientip"
 	"golang.org/x/time/rate"
 )
 
@@ -36,7 +37,8 @@ func (rl *RateLimiter) getLimiter(ip string) *rate.Limiter {
 func RateLimit(next http.Handler) http.Handler {
 	rl := NewRateLimiter()
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		limiter := rl.getLimiter(r.RemoteAddr)
+		// RemoteAddr includes the source port, which changes per connection
+		limiter := rl.getLimiter(clientip.FromRequest(r))
 		if !limiter.Allow() {
 			http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 			return
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/harip/GoTasker/auth"
+)
+
+// RequireRole accepts a logged-in user holding one of roles.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return RequireLogin(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := auth.FromContext(r.Context())
+			for _, role := range roles {
+				if principal.HasRole(role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			log.Printf("Error: user_id %d lacks any of roles %v", principal.UserID, roles)
+			http.Error(w, `{"error": "Forbidden"}`, http.StatusForbidden)
+		}))
+	}
+}
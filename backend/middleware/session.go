@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+	"github.com/harip/GoTasker/secure"
+)
+
+// Cookie and header names used by cookie sessions.
+const (
+	SessionCookieName = "gotasker_session"
+	CSRFCookieName    = "gotasker_csrf"
+	CSRFHeaderName    = "X-CSRF-Token"
+)
+
+// SessionTokenIDPrefix starts the Principal.TokenID of a cookie session,
+// followed by the session's ID.
+const SessionTokenIDPrefix = "session-"
+
+// SessionCookieAuthenticator accepts the HttpOnly session cookie set by a
+// cookie-mode login.
+type SessionCookieAuthenticator struct{}
+
+func (SessionCookieAuthenticator) Authenticate(r *http.Request) (*auth.Principal, error) {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, auth.ErrNoCredentials
+	}
+	if db == nil {
+		log.Println("Error: Middleware database not initialized")
+		return nil, auth.Unauthorized("Invalid or expired session")
+	}
+
+	var session models.Session
+	if err := db.Preload("User").Where("token_hash = ?", secure.HashToken(cookie.Value)).First(&session).Error; err != nil {
+		log.Printf("Error: Session not found: %v", err)
+		return nil, auth.Unauthorized("Invalid or expired session")
+	}
+	tokenID := SessionTokenIDPrefix + strconv.FormatUint(uint64(session.ID), 10)
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) ||
+		revocation.IsRevoked(tokenID, session.UserID, session.CreatedAt) {
+		log.Printf("Error: Revoked or expired session %d presented for user_id %d", session.ID, session.UserID)
+		return nil, auth.Unauthorized("Invalid or expired session")
+	}
+	if !accountActive(session.UserID) {
+		log.Printf("Error: Session presented for disabled or deleted user_id %d", session.UserID)
+		return nil, auth.Unauthorized("Account disabled")
+	}
+
+	// Roles are read fresh from the user row, so a role change applies to
+	// cookie sessions straight away
+	role := session.User.Role
+	if role == "" {
+		role = models.RoleMember
+	}
+	return &auth.Principal{
+		UserID:    session.UserID,
+		Username:  session.User.Username,
+		Roles:     []string{role},
+		TokenID:   tokenID,
+		SessionID: session.ID,
+		ExpiresAt: session.ExpiresAt,
+		Method:    auth.MethodSession,
+	}, nil
+}
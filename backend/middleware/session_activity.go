@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+)
+
+// Session activity is collected in memory and written in one statement per
+// flush, so authenticating a request never waits on a write.
+var (
+	activityMu   sync.Mutex
+	seenSessions = map[uint]struct{}{}
+)
+
+// touchSession records that sessionID was just used.
+func touchSession(sessionID uint) {
+	activityMu.Lock()
+	seenSessions[sessionID] = struct{}{}
+	activityMu.Unlock()
+}
+
+// FlushSessionActivity stores the last-seen time of every session used
+// since the previous flush.
+func FlushSessionActivity() error {
+	activityMu.Lock()
+	if len(seenSessions) == 0 || db == nil {
+		activityMu.Unlock()
+		return nil
+	}
+	ids := make([]uint, 0, len(seenSessions))
+	for id := range seenSessions {
+		ids = append(ids, id)
+	}
+	seenSessions = map[uint]struct{}{}
+	activityMu.Unlock()
+
+	return db.Model(&models.Session{}).Where("id IN ?", ids).Update("last_seen_at", time.Now()).Error
+}
+
+// StartSessionActivity flushes session activity every interval.
+func StartSessionActivity(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := FlushSessionActivity(); err != nil {
+				log.Printf("Error flushing session activity: %v", err)
+			}
+		}
+	}()
+}
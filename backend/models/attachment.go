@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+)
+
+// Attachment is a file uploaded to a task. Its content lives in the blob
+// with the same SHA256, which identical uploads share.
+type Attachment struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	TaskID      int       `gorm:"not null;index" json:"task_id"`
+	UserID      uint      `gorm:"not null;index" json:"-"`
+	Filename    string    `gorm:"type:varchar(255);not null" json:"filename"`
+	ContentType string    `gorm:"type:varchar(127);not null" json:"content_type"`
+	Size        int64     `gorm:"not null" json:"size"`
+	SHA256      string    `gorm:"column:sha256;type:varchar(64);not null;index" json:"sha256"`
+	CreatedAt   time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
+
+// Blob records where the content with a given SHA-256 is stored. Blobs no
+// attachment refers to any more are removed by the attachments collector.
+// LastUsedAt is bumped whenever an upload reuses the blob, so the
+// collector leaves blobs alone while an upload may still be about to
+// refer to them.
+type Blob struct {
+	SHA256     string    `gorm:"column:sha256;primaryKey;type:varchar(64)" json:"sha256"`
+	StorageKey string    `gorm:"type:varchar(128);not null" json:"-"`
+	Size       int64     `gorm:"not null" json:"size"`
+	CreatedAt  time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	LastUsedAt time.Time `gorm:"not null;index" json:"last_used_at"`
+}
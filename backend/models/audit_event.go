@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// AuditEvent records a security-relevant action. UserID is nil when the
+// action could not be tied to an account, such as a login for an unknown
+// username.
+type AuditEvent struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    *uint     `gorm:"index" json:"user_id"`
+	Event     string    `gorm:"type:varchar(64);not null;index" json:"event"`
+	IP        string    `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent string    `gorm:"type:varchar(255)" json:"user_agent"`
+	Detail    string    `gorm:"type:text" json:"detail"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Comment is a Markdown note on a task. Body holds the source; BodyHTML is
+// the sanitized rendering, produced when the comment is served.
+type Comment struct {
+	ID        uint           `gorm:"primaryKey" json:"id"`
+	TaskID    int            `gorm:"not null;index" json:"task_id"`
+	UserID    uint           `gorm:"not null;index" json:"user_id"`
+	Author    User           `gorm:"foreignKey:UserID" json:"-"`
+	Body      string         `gorm:"type:text;not null" json:"body"`
+	EditedAt  *time.Time     `json:"edited_at"`
+	CreatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	BodyHTML string `gorm:"-" json:"body_html"`
+}
+
+// CommentRevision keeps a comment's body as it was before an edit.
+type CommentRevision struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	CommentID uint      `gorm:"not null;index" json:"comment_id"`
+	Body      string    `gorm:"type:text;not null" json:"body"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+
+	BodyHTML string `gorm:"-" json:"body_html"`
+}
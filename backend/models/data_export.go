@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// States a data export moves through.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
+
+// DataExport is a ZIP archive of everything stored about a user, built in
+// the background and kept on disk until ExpiresAt.
+type DataExport struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	UserID      uint       `gorm:"not null;index" json:"user_id"`
+	User        User       `gorm:"foreignKey:UserID" json:"-"`
+	Status      string     `gorm:"type:varchar(16);not null;index" json:"status"`
+	FilePath    string     `gorm:"type:varchar(512)" json:"-"`
+	Size        int64      `gorm:"not null;default:0" json:"size"`
+	Error       string     `gorm:"type:text" json:"-"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	CreatedAt   time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
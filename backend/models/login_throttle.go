@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+)
+
+// LoginThrottle tracks recent failed logins for one username or client IP.
+// BlockedUntil holds either an exponential backoff delay or, when Locked is
+// set, a full lockout that the account owner can lift by email.
+type LoginThrottle struct {
+	Key           string     `gorm:"column:throttle_key;primaryKey;type:varchar(320)" json:"key"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `gorm:"not null" json:"last_failure_at"`
+	BlockedUntil  *time.Time `gorm:"index" json:"blocked_until"`
+	Locked        bool       `gorm:"not null;default:false" json:"locked"`
+}
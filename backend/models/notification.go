@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+)
+
+// Notification is an entry in a user's in-app inbox.
+type Notification struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"-"`
+	Kind      string     `gorm:"type:varchar(32);not null" json:"kind"`
+	Title     string     `gorm:"type:varchar(255);not null" json:"title"`
+	Body      string     `gorm:"type:text" json:"body"`
+	TaskID    *int       `gorm:"index" json:"task_id"`
+	ReadAt    *time.Time `json:"read_at"`
+	CreatedAt time.Time  `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+}
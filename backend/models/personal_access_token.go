@@ -0,0 +1,47 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Scopes a personal access token can be granted.
+const (
+	ScopeTasksRead  = "tasks:read"
+	ScopeTasksWrite = "tasks:write"
+)
+
+// PersonalAccessTokenPrefix marks opaque API tokens so they can be told
+// apart from JWTs in the Authorization header.
+const PersonalAccessTokenPrefix = "gtp_"
+
+var ValidScopes = []string{ScopeTasksRead, ScopeTasksWrite}
+
+type PersonalAccessToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	Name       string     `gorm:"type:varchar(100);not null" json:"name"`
+	TokenHash  string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	Prefix     string     `gorm:"type:varchar(16);not null" json:"prefix"`
+	Scopes     string     `gorm:"type:varchar(255);not null" json:"-"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
+
+// ScopeList returns the granted scopes, which are stored space-separated.
+func (t PersonalAccessToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+// HasScope reports whether the token was granted scope.
+func (t PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
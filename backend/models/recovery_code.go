@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// RecoveryCode is a one-time fallback for a lost TOTP device.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+	CodeHash  string     `gorm:"type:varchar(64);not null;index" json:"-"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
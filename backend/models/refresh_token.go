@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// RefreshToken is one link in a rotation chain. Every refresh marks the
+// presented token used and issues a successor with the same FamilyID, so a
+// second use of any token in the family means it was copied.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+	FamilyID  string     `gorm:"type:varchar(64);not null;index" json:"family_id"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
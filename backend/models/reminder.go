@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+)
+
+// Channels a reminder can be delivered through.
+const (
+	ReminderInbox   = "inbox"
+	ReminderEmail   = "email"
+	ReminderWebhook = "webhook"
+)
+
+var ValidReminderChannels = []string{ReminderInbox, ReminderEmail, ReminderWebhook}
+
+// States a reminder moves through. A skipped reminder was superseded by a
+// later one for the same task, or its task was completed or deleted first.
+const (
+	ReminderPending = "pending"
+	ReminderSent    = "sent"
+	ReminderFailed  = "failed"
+	ReminderSkipped = "skipped"
+)
+
+// Reminder notifies a user about a task at RemindAt, or OffsetMinutes
+// before the task's due date. FireAt is when it is due to go out and is
+// kept in step with the due date for offset reminders.
+type Reminder struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	UserID        uint       `gorm:"not null;index" json:"-"`
+	TaskID        int        `gorm:"not null;index" json:"task_id"`
+	Channel       string     `gorm:"type:varchar(16);not null;default:inbox" json:"channel"`
+	RemindAt      *time.Time `json:"remind_at"`
+	OffsetMinutes *int       `json:"offset_minutes"`
+	FireAt        *time.Time `gorm:"index:idx_reminders_due" json:"fire_at"`
+	Status        string     `gorm:"type:varchar(16);not null;default:pending;index:idx_reminders_due" json:"status"`
+	ClaimedUntil  *time.Time `json:"-"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	LastError     string     `gorm:"type:text" json:"-"`
+	SentAt        *time.Time `json:"sent_at"`
+	CreatedAt     time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+)
+
+// RevokedToken blocks a single access token by its jti until it would have
+// expired anyway.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(64)" json:"jti"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+}
+
+// TokenCutoff rejects every access token a user was issued before NotBefore,
+// which is how "sign out everywhere" works without listing each token.
+type TokenCutoff struct {
+	UserID    uint      `gorm:"primaryKey" json:"user_id"`
+	NotBefore time.Time `gorm:"not null" json:"not_before"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp;index" json:"updated_at"`
+}
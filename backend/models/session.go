@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+)
+
+// Ways a session authenticates its requests.
+const (
+	SessionKindBearer = "bearer"
+	SessionKindCookie = "cookie"
+)
+
+// Session records one login so the user can see where they are signed in
+// and sign a device out. A bearer session follows a refresh token family;
+// a cookie session is looked up by the hash of its HttpOnly cookie.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	User       User       `gorm:"foreignKey:UserID" json:"-"`
+	Kind       string     `gorm:"type:varchar(16);not null;default:cookie" json:"kind"`
+	FamilyID   string     `gorm:"type:varchar(64);index" json:"-"`
+	TokenHash  *string    `gorm:"type:varchar(64);uniqueIndex" json:"-"`
+	IP         string     `gorm:"type:varchar(64)" json:"ip"`
+	UserAgent  string     `gorm:"type:varchar(255)" json:"user_agent"`
+	LastSeenAt *time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
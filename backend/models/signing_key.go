@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// SigningKey is a JWT signing key shared by every replica. A key signs new
+// tokens between NotBefore and SignUntil and keeps verifying them until
+// VerifyUntil, by which time every token it signed has expired.
+type SigningKey struct {
+	KID         string    `gorm:"primaryKey;type:varchar(64)" json:"kid"`
+	Algorithm   string    `gorm:"type:varchar(16);not null" json:"alg"`
+	PrivateKey  string    `gorm:"type:text;not null" json:"-"`
+	NotBefore   time.Time `gorm:"not null" json:"not_before"`
+	SignUntil   time.Time `gorm:"not null" json:"sign_until"`
+	VerifyUntil time.Time `gorm:"not null;index" json:"verify_until"`
+	CreatedAt   time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// DefaultTagColor is used for tags created without a color.
+const DefaultTagColor = "#808080"
+
+// Tag is a label a user attaches to their tasks. Names are unique per user.
+type Tag struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;uniqueIndex:idx_tags_user_name" json:"-"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+	Name      string    `gorm:"type:varchar(50);not null;uniqueIndex:idx_tags_user_name" json:"name"`
+	Color     string    `gorm:"type:varchar(7);not null" json:"color"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp" json:"updated_at"`
+}
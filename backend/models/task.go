@@ -6,15 +6,50 @@ import (
 	"gorm.io/gorm"
 )
 
+// Task priorities, from least to most pressing.
+const (
+	PriorityNone   = "none"
+	PriorityLow    = "low"
+	PriorityMedium = "medium"
+	PriorityHigh   = "high"
+	PriorityUrgent = "urgent"
+)
+
+// ValidPriorities lists the priorities in rank order, so a priority's index
+// is its rank.
+var ValidPriorities = []string{PriorityNone, PriorityLow, PriorityMedium, PriorityHigh, PriorityUrgent}
+
+// Task is one of a user's to-do items. Status names a status of the user's
+// workflow (see package workflows) and StatusCategory is that status's
+// category, kept alongside so queries can tell open tasks from completed
+// ones. A recurring task carries an RRULE (see package recurrence) in
+// Recurrence and the first due date of its series in RecurrenceStart. Only
+// the open instance of a series carries the rule; completing it passes the
+// rule on to the next instance.
 type Task struct {
-	ID          int            `gorm:"primaryKey" json:"id"`
-	UserID      int            `gorm:"not null" json:"user_id"`
-	User        User           `gorm:"foreignKey:UserID" json:"-"`
-	Title       string         `gorm:"type:varchar(255);not null" json:"title"`
-	Description string         `gorm:"type:text" json:"description"`
-	Status      string         `gorm:"type:varchar(50);not null" json:"status"`
-	DueDate     *time.Time     `gorm:"type:timestamp" json:"due_date"`
-	CreatedAt   time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
-	UpdatedAt   time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID              int            `gorm:"primaryKey" json:"id"`
+	UserID          int            `gorm:"not null" json:"user_id"`
+	User            User           `gorm:"foreignKey:UserID" json:"-"`
+	ParentID        *int           `gorm:"index" json:"parent_id"`
+	Title           string         `gorm:"type:varchar(255);not null" json:"title"`
+	Description     string         `gorm:"type:text" json:"description"`
+	Status          string         `gorm:"type:varchar(50);not null" json:"status"`
+	StatusCategory  string         `gorm:"type:varchar(16);not null;default:todo;index" json:"status_category"`
+	Priority        string         `gorm:"type:varchar(16);not null;default:none;index" json:"priority"`
+	DueDate         *time.Time     `gorm:"type:timestamp" json:"due_date"`
+	Tags            []Tag          `gorm:"many2many:task_tags;constraint:OnDelete:CASCADE" json:"tags"`
+	Recurrence      string         `gorm:"type:varchar(255)" json:"recurrence"`
+	RecurrenceStart *time.Time     `gorm:"type:timestamp" json:"recurrence_start"`
+	CreatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Progress is the percentage of tasks below this one that are
+	// completed, or nil if it has none. It is computed, not stored.
+	Progress *int `gorm:"-" json:"progress"`
+	// CommentCount is the number of comments on the task. It is computed,
+	// not stored.
+	CommentCount int `gorm:"-" json:"comment_count"`
+	// NextOccurrence is the instance created when this one was completed.
+	NextOccurrence *Task `gorm:"-" json:"next_occurrence,omitempty"`
 }
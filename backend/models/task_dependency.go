@@ -0,0 +1,15 @@
+package models
+
+import (
+	"time"
+)
+
+// TaskDependency records that TaskID cannot start until BlockerID is
+// completed. Both tasks belong to UserID.
+type TaskDependency struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"-"`
+	TaskID    int       `gorm:"not null;uniqueIndex:idx_task_dependencies_edge" json:"task_id"`
+	BlockerID int       `gorm:"not null;uniqueIndex:idx_task_dependencies_edge;index" json:"blocker_id"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
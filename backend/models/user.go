@@ -6,12 +6,39 @@ import (
 	"gorm.io/gorm"
 )
 
+// Roles a user can hold. Admins can manage other users through /admin.
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+)
+
+var ValidRoles = []string{RoleAdmin, RoleMember}
+
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"type:varchar(50);unique;not null" json:"username"`
-	Email     string         `gorm:"type:varchar(255);unique;not null" json:"email"`
-	Password  string         `gorm:"type:varchar(255);not null" json:"-"`
-	CreatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
-	UpdatedAt time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID              uint           `gorm:"primaryKey" json:"id"`
+	Username        string         `gorm:"type:varchar(50);unique;not null" json:"username"`
+	Email           string         `gorm:"type:varchar(255);unique;not null" json:"email"`
+	Password        string         `gorm:"type:varchar(255);not null" json:"-"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at"`
+	TOTPSecret      string         `gorm:"type:varchar(64)" json:"-"`
+	TOTPEnabledAt   *time.Time     `json:"totp_enabled_at"`
+	TOTPLastStep    int64          `gorm:"not null;default:0" json:"-"`
+	Role            string         `gorm:"type:varchar(16);not null;default:member;index" json:"role"`
+	Timezone        string         `gorm:"type:varchar(64);not null;default:UTC" json:"timezone"`
+	WebhookURL      string         `gorm:"type:varchar(512)" json:"webhook_url"`
+	DisabledAt      *time.Time     `json:"disabled_at"`
+	CreatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"not null;default:current_timestamp" json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// Location returns the user's time zone, falling back to UTC if it is
+// unset or unknown.
+func (u User) Location() *time.Location {
+	if u.Timezone != "" {
+		if loc, err := time.LoadLocation(u.Timezone); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
 }
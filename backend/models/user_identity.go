@@ -0,0 +1,18 @@
+package models
+
+import (
+	"time"
+)
+
+// UserIdentity links a user to an account at an external identity provider,
+// keyed by the provider's issuer and stable subject identifier.
+type UserIdentity struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null;index" json:"user_id"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+	Issuer      string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_issuer_subject" json:"issuer"`
+	Subject     string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_issuer_subject" json:"subject"`
+	Email       string    `gorm:"type:varchar(255)" json:"email"`
+	LastLoginAt time.Time `gorm:"not null" json:"last_login_at"`
+	CreatedAt   time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
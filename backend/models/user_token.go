@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+)
+
+// Purposes for single-use tokens sent to a user's inbox.
+const (
+	TokenPurposePasswordReset     = "password_reset"
+	TokenPurposeEmailVerification = "email_verification"
+	TokenPurposeAccountUnlock     = "account_unlock"
+)
+
+// UserToken is a single-use, expiring secret mailed to a user. Only its hash
+// is stored, so a database leak does not expose usable links.
+type UserToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	User      User       `gorm:"foreignKey:UserID" json:"-"`
+	Purpose   string     `gorm:"type:varchar(32);not null;index" json:"purpose"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+)
+
+// Status categories. Every workflow status belongs to one, and the rest of
+// the app reasons about categories rather than status names: a task counts
+// as started in a doing status and as completed in a done status.
+const (
+	CategoryTodo  = "todo"
+	CategoryDoing = "doing"
+	CategoryDone  = "done"
+)
+
+// ValidStatusCategories lists the status categories in the order a task
+// usually moves through them.
+var ValidStatusCategories = []string{CategoryTodo, CategoryDoing, CategoryDone}
+
+// Workflow is a user's ordered set of task statuses. A task's Status names
+// one of them; the first is where new tasks start.
+type Workflow struct {
+	ID        uint             `gorm:"primaryKey" json:"id"`
+	UserID    uint             `gorm:"not null;uniqueIndex" json:"-"`
+	Statuses  []WorkflowStatus `gorm:"constraint:OnDelete:CASCADE" json:"statuses"`
+	CreatedAt time.Time        `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time        `gorm:"not null;default:current_timestamp" json:"updated_at"`
+}
+
+// WorkflowStatus is one status of a workflow. Names are unique within it.
+type WorkflowStatus struct {
+	ID         uint   `gorm:"primaryKey" json:"id"`
+	WorkflowID uint   `gorm:"not null;uniqueIndex:idx_workflow_statuses_name" json:"-"`
+	Name       string `gorm:"type:varchar(50);not null;uniqueIndex:idx_workflow_statuses_name" json:"name"`
+	Category   string `gorm:"type:varchar(16);not null" json:"category"`
+	Position   int    `gorm:"not null" json:"position"`
+
+	// Transitions names the statuses a task can move to from this one. It
+	// is loaded from workflow_transitions, not stored here.
+	Transitions []string `gorm:"-" json:"transitions"`
+}
+
+// WorkflowTransition allows tasks in status FromID to move to status ToID.
+type WorkflowTransition struct {
+	WorkflowID uint `gorm:"not null;index" json:"-"`
+	FromID     uint `gorm:"primaryKey;autoIncrement:false" json:"from_id"`
+	ToID       uint `gorm:"primaryKey;autoIncrement:false" json:"to_id"`
+}
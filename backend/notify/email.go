@@ -0,0 +1,29 @@
+// notify/email.go
+package notify
+
+import (
+	"context"
+	"errors"
+
+	"github.com/harip/GoTasker/mailer"
+)
+
+// EmailNotifier mails messages to the user's address.
+type EmailNotifier struct {
+	Mailer mailer.Mailer
+}
+
+func NewEmailNotifier(m mailer.Mailer) *EmailNotifier {
+	return &EmailNotifier{Mailer: m}
+}
+
+func (n *EmailNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.User.Email == "" {
+		return errors.New("user has no email address")
+	}
+	return n.Mailer.Send(ctx, mailer.Message{
+		To:      []string{msg.User.Email},
+		Subject: msg.Title,
+		Body:    msg.Body,
+	})
+}
@@ -0,0 +1,29 @@
+// notify/inbox.go
+package notify
+
+import (
+	"context"
+
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+// InboxNotifier stores messages in the user's in-app inbox.
+type InboxNotifier struct {
+	DB *gorm.DB
+}
+
+func NewInboxNotifier(db *gorm.DB) *InboxNotifier {
+	return &InboxNotifier{DB: db}
+}
+
+func (n *InboxNotifier) Notify(ctx context.Context, msg Message) error {
+	return n.DB.WithContext(ctx).Create(&models.Notification{
+		UserID:    msg.User.ID,
+		Kind:      msg.Kind,
+		Title:     msg.Title,
+		Body:      msg.Body,
+		TaskID:    msg.TaskID,
+		CreatedAt: msg.SentAt,
+	}).Error
+}
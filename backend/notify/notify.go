@@ -0,0 +1,45 @@
+// notify/notify.go
+package notify
+
+import (
+	"context"
+	"time"
+	"unicode/utf8"
+
+	"github.com/harip/GoTasker/models"
+)
+
+// Kinds of message sent to users.
+const (
+	KindReminder = "reminder"
+	KindMention  = "mention"
+)
+
+// MaxTitleLength is the longest title a message can have, in characters,
+// since the inbox stores titles in a varchar(255).
+const MaxTitleLength = 255
+
+// Truncate shortens s to at most n characters, ending it with an ellipsis
+// if anything was cut.
+func Truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// Message is a notification for one user, such as a task reminder.
+type Message struct {
+	User   models.User
+	Kind   string
+	Title  string
+	Body   string
+	TaskID *int
+	SentAt time.Time
+}
+
+// Notifier delivers messages over one channel. Implementations must be
+// safe for concurrent use.
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
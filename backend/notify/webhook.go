@@ -0,0 +1,138 @@
+// notify/webhook.go
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a webhook URL resolves to a loopback,
+// private or link-local address and such addresses are not allowed.
+var ErrPrivateAddress = errors.New("webhook address is not public")
+
+// WebhookNotifier POSTs messages as JSON to the URL the user configured.
+// When Secret is set each request carries an X-GoTasker-Signature header,
+// "sha256=" followed by the hex HMAC-SHA256 of the X-GoTasker-Timestamp
+// header, a dot and the body, so receivers can check where it came from.
+type WebhookNotifier struct {
+	Secret string
+	Client *http.Client
+}
+
+// NewWebhookNotifier returns a notifier with a short timeout. Unless
+// allowPrivate is set it refuses to connect to internal addresses, since
+// the URLs are chosen by users.
+func NewWebhookNotifier(secret string, allowPrivate bool) *WebhookNotifier {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refusePrivate
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &WebhookNotifier{
+		Secret: secret,
+		Client: &http.Client{
+			Transport: transport,
+			Timeout:   10 * time.Second,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// refusePrivate runs once the address is resolved, so a public name that
+// points at an internal address is caught too.
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// ValidWebhookURL reports whether s can be used as a webhook URL.
+func ValidWebhookURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.User == nil
+}
+
+type webhookPayload struct {
+	Kind   string    `json:"kind"`
+	Title  string    `json:"title"`
+	Body   string    `json:"body"`
+	TaskID *int      `json:"task_id,omitempty"`
+	UserID uint      `json:"user_id"`
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, msg Message) error {
+	if msg.User.WebhookURL == "" {
+		return errors.New("user has no webhook URL")
+	}
+	if !ValidWebhookURL(msg.User.WebhookURL) {
+		return errors.New("invalid webhook URL")
+	}
+	body, err := json.Marshal(webhookPayload{
+		Kind:   msg.Kind,
+		Title:  msg.Title,
+		Body:   msg.Body,
+		TaskID: msg.TaskID,
+		UserID: msg.User.ID,
+		SentAt: msg.SentAt,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.User.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoTasker-Webhook/1.0")
+	if n.Secret != "" {
+		timestamp := strconv.FormatInt(msg.SentAt.Unix(), 10)
+		req.Header.Set("X-GoTasker-Timestamp", timestamp)
+		req.Header.Set("X-GoTasker-Signature", "sha256="+Sign(n.Secret, timestamp, body))
+	}
+
+	resp, err := n.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Sign returns the hex HMAC-SHA256 of timestamp, a dot and body.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
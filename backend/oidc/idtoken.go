@@ -0,0 +1,165 @@
+// oidc/idtoken.go
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/subtle"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clockSkew tolerates small differences between our clock and the provider's.
+const clockSkew = time.Minute
+
+// IDToken holds the verified claims GoTasker uses.
+type IDToken struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+	IssuedAt          time.Time
+	Expiry            time.Time
+}
+
+// VerifyIDToken checks the signature, issuer, audience, lifetime and nonce
+// of an ID token as required by OpenID Connect Core section 3.1.3.7.
+func (p *Provider) VerifyIDToken(ctx context.Context, raw, nonce string) (*IDToken, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	keys := p.keys
+	p.mu.Unlock()
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		// Only asymmetric algorithms; HS256 would make the client secret a
+		// signing key and "none" would skip the signature entirely.
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("unsupported signing algorithm %s", token.Method.Alg())
+		}
+		if !algAllowed(token.Method.Alg(), m.IDTokenSigningAlgValues) {
+			return nil, fmt.Errorf("signing algorithm %s is not advertised by the provider", token.Method.Alg())
+		}
+		kid, _ := token.Header["kid"].(string)
+		k, err := keys.lookup(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if k.alg != "" && k.alg != token.Method.Alg() {
+			return nil, fmt.Errorf("key %s does not use %s", kid, token.Method.Alg())
+		}
+		switch k.key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+				return nil, fmt.Errorf("key %s is not an RSA key", kid)
+			}
+		case *ecdsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodECDSA); !ok {
+				return nil, fmt.Errorf("key %s is not an EC key", kid)
+			}
+		}
+		return k.key, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, fmt.Errorf("%w: unreadable claims", ErrInvalidIDToken)
+	}
+
+	id := &IDToken{}
+	id.Issuer, _ = claims["iss"].(string)
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	id.PreferredUsername, _ = claims["preferred_username"].(string)
+	// Some providers send email_verified as a string
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		id.EmailVerified = v
+	case string:
+		id.EmailVerified = v == "true"
+	}
+
+	if id.Issuer != m.Issuer {
+		return nil, fmt.Errorf("%w: issuer %q", ErrInvalidIDToken, id.Issuer)
+	}
+	if id.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrInvalidIDToken)
+	}
+	audiences := audienceList(claims["aud"])
+	if !contains(audiences, p.cfg.ClientID) {
+		return nil, fmt.Errorf("%w: audience %v", ErrInvalidIDToken, audiences)
+	}
+	if azp, ok := claims["azp"].(string); (len(audiences) > 1 || ok) && azp != p.cfg.ClientID {
+		return nil, fmt.Errorf("%w: authorized party %q", ErrInvalidIDToken, azp)
+	}
+
+	now := time.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing exp", ErrInvalidIDToken)
+	}
+	id.Expiry = time.Unix(int64(exp), 0)
+	if now.After(id.Expiry.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidIDToken)
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing iat", ErrInvalidIDToken)
+	}
+	id.IssuedAt = time.Unix(int64(iat), 0)
+	if id.IssuedAt.After(now.Add(clockSkew)) {
+		return nil, fmt.Errorf("%w: issued in the future", ErrInvalidIDToken)
+	}
+
+	tokenNonce, _ := claims["nonce"].(string)
+	if nonce == "" || subtle.ConstantTimeCompare([]byte(tokenNonce), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	return id, nil
+}
+
+func algAllowed(alg string, advertised []string) bool {
+	// RS256 is mandatory for every provider, so an empty list allows it
+	if len(advertised) == 0 {
+		return alg == "RS256"
+	}
+	return contains(advertised, alg)
+}
+
+func audienceList(aud interface{}) []string {
+	switch v := aud.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, a := range v {
+			if s, ok := a.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+// oidc/jwks.go
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval stops a flood of tokens with unknown kids from turning
+// into a flood of JWKS requests.
+const minRefreshInterval = time.Minute
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+// keySet caches the provider's signing keys and refetches them when a token
+// names a kid it has not seen, which is how providers roll keys.
+type keySet struct {
+	provider *Provider
+	uri      string
+
+	mu          sync.Mutex
+	keys        map[string]publicKey
+	lastRefresh time.Time
+}
+
+func newKeySet(p *Provider, uri string) *keySet {
+	return &keySet{provider: p, uri: uri}
+}
+
+func (s *keySet) lookup(ctx context.Context, kid string) (publicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.find(kid); ok {
+		return k, nil
+	}
+	if time.Since(s.lastRefresh) < minRefreshInterval {
+		return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if err := s.refresh(ctx); err != nil {
+		return publicKey{}, err
+	}
+	if k, ok := s.find(kid); ok {
+		return k, nil
+	}
+	return publicKey{}, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// find returns the key for kid, or the only key when the token has no kid.
+// Callers must hold mu.
+func (s *keySet) find(kid string) (publicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	s.lastRefresh = time.Now()
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := s.provider.getJSON(ctx, s.uri, &set); err != nil {
+		return fmt.Errorf("fetching JWKS: %v", err)
+	}
+	keys := make(map[string]publicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := parseJWK(jwk)
+		if err != nil {
+			log.Printf("Skipping OIDC signing key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = k
+	}
+	s.keys = keys
+	return nil
+}
+
+func parseJWK(jwk jsonWebKey) (publicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return publicKey{}, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return publicKey{}, errors.New("RSA exponent too large")
+		}
+		return publicKey{alg: jwk.Alg, key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return publicKey{}, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return publicKey{}, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return publicKey{}, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return publicKey{}, errors.New("point is not on the curve")
+		}
+		return publicKey{alg: jwk.Alg, key: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+	}
+	return publicKey{}, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
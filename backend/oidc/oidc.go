@@ -0,0 +1,215 @@
+// oidc/oidc.go
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/secure"
+)
+
+var (
+	ErrDiscovery      = errors.New("oidc: discovery failed")
+	ErrExchange       = errors.New("oidc: code exchange failed")
+	ErrInvalidIDToken = errors.New("oidc: invalid id token")
+)
+
+// maxResponseSize bounds what is read from the identity provider.
+const maxResponseSize = 1 << 20
+
+// Config describes this application as an OIDC client.
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// HTTPClient is used for discovery, JWKS and token requests. Defaults
+	// to a client with a 10 second timeout.
+	HTTPClient *http.Client
+}
+
+// Metadata is the subset of the discovery document the relying party uses.
+type Metadata struct {
+	Issuer                        string   `json:"issuer"`
+	AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+	TokenEndpoint                 string   `json:"token_endpoint"`
+	JWKSURI                       string   `json:"jwks_uri"`
+	IDTokenSigningAlgValues       []string `json:"id_token_signing_alg_values_supported"`
+	CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+}
+
+// Provider talks to one OpenID provider. Discovery happens on first use so
+// the server can start while the provider is unreachable.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+
+	mu       sync.Mutex
+	metadata *Metadata
+	keys     *keySet
+}
+
+func NewProvider(cfg Config) *Provider {
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{cfg: cfg, client: client}
+}
+
+// Metadata returns the provider's discovery document, fetching it once.
+func (p *Provider) Metadata(ctx context.Context) (*Metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	wellKnown := strings.TrimRight(p.cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var m Metadata
+	if err := p.getJSON(ctx, wellKnown, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDiscovery, err)
+	}
+	// The issuer in the document must be exactly the one configured
+	// (OpenID Connect Discovery section 4.3)
+	if m.Issuer != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrDiscovery, m.Issuer, p.cfg.IssuerURL)
+	}
+	if m.AuthorizationEndpoint == "" || m.TokenEndpoint == "" || m.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: document is missing required endpoints", ErrDiscovery)
+	}
+	p.metadata = &m
+	p.keys = newKeySet(p, m.JWKSURI)
+	return p.metadata, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", target, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(v)
+}
+
+// PKCE holds an RFC 7636 code verifier and its S256 challenge.
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+func NewPKCE() (PKCE, error) {
+	verifier, err := secure.RandomToken(32)
+	if err != nil {
+		return PKCE{}, err
+	}
+	return PKCE{Verifier: verifier, Challenge: challengeFor(verifier)}, nil
+}
+
+func challengeFor(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the provider URL the browser is sent to.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce string, pkce PKCE) (string, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkce.Challenge)
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(m.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return m.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// TokenResponse is the provider's answer to a code exchange.
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Exchange redeems an authorization code together with its PKCE verifier.
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (*TokenResponse, error) {
+	m, err := p.Metadata(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", m.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		// client_secret_basic, the default authentication method
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	defer resp.Body.Close()
+
+	var tokens TokenResponse
+	body := io.LimitReader(resp.Body, maxResponseSize)
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		json.NewDecoder(body).Decode(&failure)
+		return nil, fmt.Errorf("%w: status %d %s %s", ErrExchange, resp.StatusCode, failure.Error, failure.Description)
+	}
+	if err := json.NewDecoder(body).Decode(&tokens); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrExchange, err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: response has no id_token", ErrExchange)
+	}
+	return &tokens, nil
+}
@@ -0,0 +1,186 @@
+// password/password.go
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Algorithm names accepted by Params.Algorithm.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+var ErrInvalidHash = errors.New("password: invalid encoded hash")
+
+// Params controls how new hashes are produced. Verification always uses the
+// parameters encoded in the stored hash, so these can be raised at any time.
+type Params struct {
+	Algorithm   string
+	Memory      uint32 // argon2id memory in KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+	BcryptCost  int
+}
+
+var defaultParams = Params{
+	Algorithm:   Argon2id,
+	Memory:      64 * 1024,
+	Iterations:  3,
+	Parallelism: 2,
+	SaltLength:  16,
+	KeyLength:   32,
+	BcryptCost:  12,
+}
+
+// SetDefaultParams replaces the parameters used by Hash and NeedsRehash.
+func SetDefaultParams(p Params) error {
+	switch p.Algorithm {
+	case Argon2id:
+		if p.Memory == 0 || p.Iterations == 0 || p.Parallelism == 0 || p.SaltLength == 0 || p.KeyLength == 0 {
+			return fmt.Errorf("password: incomplete argon2id parameters")
+		}
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("password: bcrypt cost %d out of range", p.BcryptCost)
+		}
+	default:
+		return fmt.Errorf("password: unsupported algorithm %q", p.Algorithm)
+	}
+	defaultParams = p
+	return nil
+}
+
+// DefaultParams returns the parameters currently used for new hashes.
+func DefaultParams() Params {
+	return defaultParams
+}
+
+// Hash encodes plain with the default parameters.
+func Hash(plain string) (string, error) {
+	return HashWithParams(plain, defaultParams)
+}
+
+// HashWithParams encodes plain in PHC string format for argon2id
+// ($argon2id$v=19$m=...,t=...,p=...$salt$key) or the standard $2a$ format
+// for bcrypt.
+func HashWithParams(plain string, p Params) (string, error) {
+	switch p.Algorithm {
+	case Argon2id:
+		salt := make([]byte, p.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		key := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, p.Memory, p.Iterations, p.Parallelism,
+			base64.RawStdEncoding.EncodeToString(salt),
+			base64.RawStdEncoding.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(plain), p.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("password: unsupported algorithm %q", p.Algorithm)
+	}
+}
+
+// Verify reports whether plain matches encoded. Values that are not
+// recognised hashes are treated as legacy plaintext and compared in
+// constant time so existing rows keep working until they are upgraded.
+func Verify(plain, encoded string) (bool, error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		p, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		other := argon2.IDKey([]byte(plain), salt, p.Iterations, p.Memory, p.Parallelism, p.KeyLength)
+		return subtle.ConstantTimeCompare(key, other) == 1, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(plain))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return err == nil, err
+	default:
+		return subtle.ConstantTimeCompare([]byte(plain), []byte(encoded)) == 1, nil
+	}
+}
+
+// IsHashed reports whether encoded is in one of the supported hash formats.
+func IsHashed(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$") || isBcrypt(encoded)
+}
+
+// NeedsRehash reports whether encoded is plaintext, uses a different
+// algorithm than the default, or was produced with weaker parameters.
+func NeedsRehash(encoded string) bool {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		if defaultParams.Algorithm != Argon2id {
+			return true
+		}
+		p, _, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return true
+		}
+		return p.Memory < defaultParams.Memory ||
+			p.Iterations < defaultParams.Iterations ||
+			p.Parallelism < defaultParams.Parallelism ||
+			uint32(len(key)) < defaultParams.KeyLength
+	case isBcrypt(encoded):
+		if defaultParams.Algorithm != Bcrypt {
+			return true
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		return err != nil || cost < defaultParams.BcryptCost
+	default:
+		return true
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func decodeArgon2id(encoded string) (Params, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	p := Params{Algorithm: Argon2id}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return Params{}, nil, nil, ErrInvalidHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+	return p, salt, key, nil
+}
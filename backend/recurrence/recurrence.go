@@ -0,0 +1,375 @@
+// recurrence/recurrence.go
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies of the RFC 5545 subset understood here.
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds how many days, weeks, months or years are scanned for
+// the next occurrence, so a rule that can never match again (such as the
+// 31st of every second month from February) ends instead of looping.
+const maxPeriods = 10000
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Day is a BYDAY entry: a weekday, optionally the Nth (or Nth from last,
+// if negative) one in the month, as in 1MO or -1FR.
+type Day struct {
+	Weekday time.Weekday
+	N       int
+}
+
+func (d Day) String() string {
+	for code, wd := range weekdays {
+		if wd == d.Weekday {
+			if d.N != 0 {
+				return strconv.Itoa(d.N) + code
+			}
+			return code
+		}
+	}
+	return ""
+}
+
+// Rule is a parsed recurrence rule. It supports FREQ (DAILY, WEEKLY,
+// MONTHLY, YEARLY), INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL. Weeks
+// start on Monday, and a YEARLY rule recurs in the month of its start.
+type Rule struct {
+	Freq       string
+	Interval   int
+	ByDay      []Day
+	ByMonthDay []int
+	Count      int
+	Until      *time.Time
+}
+
+// Parse reads a rule such as "FREQ=WEEKLY;INTERVAL=2;BYDAY=MO,WE". An
+// "RRULE:" prefix is accepted.
+func Parse(s string) (*Rule, error) {
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+	if s == "" {
+		return nil, errors.New("recurrence: empty rule")
+	}
+	rule := &Rule{Interval: 1}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(s, ";") {
+		name, value, ok := strings.Cut(part, "=")
+		name = strings.ToUpper(strings.TrimSpace(name))
+		value = strings.ToUpper(strings.TrimSpace(value))
+		if !ok || value == "" {
+			return nil, fmt.Errorf("recurrence: malformed part %q", part)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("recurrence: %s given twice", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case "FREQ":
+			if value != Daily && value != Weekly && value != Monthly && value != Yearly {
+				return nil, fmt.Errorf("recurrence: unsupported FREQ %s", value)
+			}
+			rule.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("recurrence: invalid INTERVAL %s", value)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("recurrence: invalid COUNT %s", value)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return nil, err
+			}
+			rule.Until = &until
+		case "BYDAY":
+			for _, item := range strings.Split(value, ",") {
+				day, err := parseDay(item)
+				if err != nil {
+					return nil, err
+				}
+				rule.ByDay = append(rule.ByDay, day)
+			}
+		case "BYMONTHDAY":
+			for _, item := range strings.Split(value, ",") {
+				n, err := strconv.Atoi(item)
+				if err != nil || n == 0 || n < -31 || n > 31 {
+					return nil, fmt.Errorf("recurrence: invalid BYMONTHDAY %s", item)
+				}
+				rule.ByMonthDay = append(rule.ByMonthDay, n)
+			}
+		default:
+			return nil, fmt.Errorf("recurrence: unsupported part %s", name)
+		}
+	}
+
+	if rule.Freq == "" {
+		return nil, errors.New("recurrence: FREQ is required")
+	}
+	if rule.Count > 0 && rule.Until != nil {
+		return nil, errors.New("recurrence: COUNT and UNTIL cannot both be given")
+	}
+	for _, day := range rule.ByDay {
+		if day.N != 0 && rule.Freq != Monthly && rule.Freq != Yearly {
+			return nil, errors.New("recurrence: numbered BYDAY needs FREQ=MONTHLY or YEARLY")
+		}
+	}
+	if len(rule.ByMonthDay) > 0 && rule.Freq == Weekly {
+		return nil, errors.New("recurrence: BYMONTHDAY cannot be used with FREQ=WEEKLY")
+	}
+	return rule, nil
+}
+
+func parseDay(s string) (Day, error) {
+	if len(s) < 2 {
+		return Day{}, fmt.Errorf("recurrence: invalid BYDAY %s", s)
+	}
+	wd, ok := weekdays[s[len(s)-2:]]
+	if !ok {
+		return Day{}, fmt.Errorf("recurrence: invalid BYDAY %s", s)
+	}
+	day := Day{Weekday: wd}
+	if prefix := s[:len(s)-2]; prefix != "" {
+		n, err := strconv.Atoi(prefix)
+		if err != nil || n == 0 || n < -5 || n > 5 {
+			return Day{}, fmt.Errorf("recurrence: invalid BYDAY %s", s)
+		}
+		day.N = n
+	}
+	return day, nil
+}
+
+// parseUntil accepts the UTC date-time and date forms of RFC 5545. A bare
+// date includes the whole day.
+func parseUntil(s string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", s); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse("20060102", s); err == nil {
+		return t.Add(24*time.Hour - time.Second), nil
+	}
+	return time.Time{}, fmt.Errorf("recurrence: invalid UNTIL %s", s)
+}
+
+// String formats the rule in RFC 5545 syntax, without the RRULE: prefix.
+func (r *Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, len(r.ByDay))
+		for i, d := range r.ByDay {
+			days[i] = d.String()
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, len(r.ByMonthDay))
+		for i, d := range r.ByMonthDay {
+			days[i] = strconv.Itoa(d)
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Next returns the first occurrence of a series starting at start that
+// falls after after, or false if the series has ended by then. Dates are
+// worked out on the wall clock in loc, so a task due at 09:00 stays at
+// 09:00 across daylight saving changes.
+func (r *Rule) Next(start, after time.Time, loc *time.Location) (time.Time, bool) {
+	next := r.Between(start, after, loc, 1)
+	if len(next) == 0 {
+		return time.Time{}, false
+	}
+	return next[0], true
+}
+
+// Between returns up to n occurrences of a series starting at start that
+// fall after after, in order.
+func (r *Rule) Between(start, after time.Time, loc *time.Location, n int) []time.Time {
+	var found []time.Time
+	r.each(start.In(loc), func(t time.Time) bool {
+		if t.After(after) {
+			found = append(found, t)
+		}
+		return len(found) < n
+	})
+	return found
+}
+
+// each calls fn with every occurrence in order, starting with start
+// itself, until fn returns false or the series ends.
+func (r *Rule) each(start time.Time, fn func(time.Time) bool) {
+	count := 0
+	emit := func(t time.Time) bool {
+		if r.Until != nil && t.After(*r.Until) {
+			return false
+		}
+		count++
+		if r.Count > 0 && count > r.Count {
+			return false
+		}
+		return fn(t)
+	}
+	if !emit(start) {
+		return
+	}
+
+	hour, min, sec := start.Clock()
+	loc := start.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, loc)
+	}
+
+	for period := 0; period < maxPeriods; period++ {
+		var candidates []time.Time
+		switch r.Freq {
+		case Daily:
+			day := at(start.Year(), start.Month(), start.Day()+period*r.Interval)
+			if r.matchesDay(day) {
+				candidates = append(candidates, day)
+			}
+		case Weekly:
+			// Weeks start on Monday
+			offset := (int(start.Weekday()) + 6) % 7
+			monday := at(start.Year(), start.Month(), start.Day()-offset+period*7*r.Interval)
+			for i := 0; i < 7; i++ {
+				day := at(monday.Year(), monday.Month(), monday.Day()+i)
+				if r.inWeek(day, start) {
+					candidates = append(candidates, day)
+				}
+			}
+		case Monthly:
+			first := at(start.Year(), start.Month()+time.Month(period*r.Interval), 1)
+			candidates = r.inMonth(first, start, at)
+		case Yearly:
+			first := at(start.Year()+period*r.Interval, start.Month(), 1)
+			candidates = r.inMonth(first, start, at)
+		}
+
+		for _, t := range candidates {
+			if !t.After(start) {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+// matchesDay applies BYDAY and BYMONTHDAY as filters, for DAILY rules.
+func (r *Rule) matchesDay(t time.Time) bool {
+	if len(r.ByDay) > 0 && !r.hasWeekday(t.Weekday()) {
+		return false
+	}
+	if len(r.ByMonthDay) > 0 && !r.hasMonthDay(t) {
+		return false
+	}
+	return true
+}
+
+// inWeek reports whether a day of the week is in a WEEKLY rule, which
+// defaults to the start's weekday.
+func (r *Rule) inWeek(t, start time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return t.Weekday() == start.Weekday()
+	}
+	return r.hasWeekday(t.Weekday())
+}
+
+// inMonth lists the days of the month beginning at first that a MONTHLY
+// or YEARLY rule falls on. Without BYDAY or BYMONTHDAY that is the start's
+// day of the month, skipped in months too short to have it.
+func (r *Rule) inMonth(first, start time.Time, at func(int, time.Month, int) time.Time) []time.Time {
+	year, month := first.Year(), first.Month()
+	length := daysIn(year, month)
+
+	var days []time.Time
+	for d := 1; d <= length; d++ {
+		day := at(year, month, d)
+		switch {
+		case len(r.ByDay) == 0 && len(r.ByMonthDay) == 0:
+			if d != start.Day() {
+				continue
+			}
+		case len(r.ByDay) > 0 && !r.hasMonthWeekday(day, length):
+			continue
+		case len(r.ByMonthDay) > 0 && !r.hasMonthDay(day):
+			continue
+		}
+		days = append(days, day)
+	}
+	return days
+}
+
+func (r *Rule) hasWeekday(wd time.Weekday) bool {
+	for _, d := range r.ByDay {
+		if d.Weekday == wd {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMonthWeekday matches BYDAY within a month, where 2TU is the second
+// Tuesday and -1FR the last Friday.
+func (r *Rule) hasMonthWeekday(t time.Time, length int) bool {
+	nth := (t.Day()-1)/7 + 1
+	nthFromEnd := -((length-t.Day())/7 + 1)
+	for _, d := range r.ByDay {
+		if d.Weekday == t.Weekday() && (d.N == 0 || d.N == nth || d.N == nthFromEnd) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMonthDay matches BYMONTHDAY, where -1 is the last day of the month.
+func (r *Rule) hasMonthDay(t time.Time) bool {
+	length := daysIn(t.Year(), t.Month())
+	for _, d := range r.ByMonthDay {
+		if d == t.Day() || (d < 0 && length+d+1 == t.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
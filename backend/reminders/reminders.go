@@ -0,0 +1,285 @@
+// reminders/reminders.go
+package reminders
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/notify"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// batchSize bounds how many reminders one claim takes.
+	batchSize = 50
+	// claimLease is how long a claimed reminder is reserved for the replica
+	// that claimed it. A failed delivery is retried once it runs out.
+	claimLease = 5 * time.Minute
+	// maxAttempts is how many deliveries are tried before giving up.
+	maxAttempts = 5
+	// deliveryTimeout bounds a single delivery.
+	deliveryTimeout = 30 * time.Second
+)
+
+var (
+	mu        sync.RWMutex
+	db        *gorm.DB
+	notifiers map[string]notify.Notifier
+)
+
+// Init sets the database and the notifier used for each channel.
+func Init(database *gorm.DB, channels map[string]notify.Notifier) {
+	mu.Lock()
+	db = database
+	notifiers = channels
+	mu.Unlock()
+}
+
+// FireAt returns when reminder is due to go out for a task due at due, or
+// nil for an offset reminder on a task without a due date.
+func FireAt(reminder models.Reminder, due *time.Time) *time.Time {
+	if reminder.RemindAt != nil {
+		at := *reminder.RemindAt
+		return &at
+	}
+	if reminder.OffsetMinutes == nil || due == nil {
+		return nil
+	}
+	at := due.Add(-time.Duration(*reminder.OffsetMinutes) * time.Minute)
+	return &at
+}
+
+// Reschedule moves the pending offset reminders of a task to follow its
+// new due date.
+func Reschedule(tx *gorm.DB, taskID int, due *time.Time) error {
+	var pending []models.Reminder
+	if err := tx.Where("task_id = ? AND status = ? AND offset_minutes IS NOT NULL", taskID, models.ReminderPending).
+		Find(&pending).Error; err != nil {
+		return err
+	}
+	for _, reminder := range pending {
+		if err := tx.Model(&models.Reminder{}).Where("id = ?", reminder.ID).
+			Update("fire_at", FireAt(reminder, due)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyOffsets gives the task to the offset reminders of the task from, so
+// the next instance of a recurring task is reminded about like the last.
+func CopyOffsets(tx *gorm.DB, from, to models.Task) error {
+	var offsets []models.Reminder
+	if err := tx.Where("task_id = ? AND offset_minutes IS NOT NULL", from.ID).Find(&offsets).Error; err != nil {
+		return err
+	}
+	for _, reminder := range offsets {
+		copied := models.Reminder{
+			UserID:        reminder.UserID,
+			TaskID:        to.ID,
+			Channel:       reminder.Channel,
+			OffsetMinutes: reminder.OffsetMinutes,
+			Status:        models.ReminderPending,
+			CreatedAt:     time.Now(),
+		}
+		copied.FireAt = FireAt(copied, to.DueDate)
+		if err := tx.Create(&copied).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run delivers every reminder that is due and returns how many were sent.
+func Run(ctx context.Context) (int, error) {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return 0, nil
+	}
+
+	sent := 0
+	for {
+		claimed, err := claim(database, time.Now())
+		if err != nil {
+			return sent, err
+		}
+		for _, reminder := range claimed {
+			if deliver(ctx, database, reminder) {
+				sent++
+			}
+		}
+		if len(claimed) < batchSize || ctx.Err() != nil {
+			return sent, ctx.Err()
+		}
+	}
+}
+
+type series struct {
+	taskID  int
+	channel string
+}
+
+// claim reserves a batch of due reminders for this replica. On postgres the
+// rows are locked with SKIP LOCKED, so replicas running at the same time
+// claim different reminders instead of waiting on or repeating each other.
+//
+// Reminders missed while nothing was running would otherwise all go out at
+// once. Of the due reminders for the same task and channel only the latest
+// is claimed; the others are skipped.
+func claim(database *gorm.DB, now time.Time) ([]models.Reminder, error) {
+	var claimed []models.Reminder
+	err := database.Transaction(func(tx *gorm.DB) error {
+		due := func() *gorm.DB {
+			query := tx.Where("status = ? AND fire_at <= ? AND (claimed_until IS NULL OR claimed_until < ?)",
+				models.ReminderPending, now, now)
+			if tx.Dialector.Name() == "postgres" {
+				query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+			}
+			return query
+		}
+
+		var batch []models.Reminder
+		if err := due().Order("fire_at").Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		taskIDs := make([]int, len(batch))
+		for i, reminder := range batch {
+			taskIDs[i] = reminder.TaskID
+		}
+		var all []models.Reminder
+		if err := due().Where("task_id IN ?", taskIDs).Order("fire_at").Find(&all).Error; err != nil {
+			return err
+		}
+
+		latest := map[series]models.Reminder{}
+		for _, reminder := range all {
+			latest[series{reminder.TaskID, reminder.Channel}] = reminder
+		}
+		var claimedIDs, skippedIDs []uint
+		for _, reminder := range all {
+			if latest[series{reminder.TaskID, reminder.Channel}].ID != reminder.ID {
+				skippedIDs = append(skippedIDs, reminder.ID)
+				continue
+			}
+			reminder.Attempts++
+			claimed = append(claimed, reminder)
+			claimedIDs = append(claimedIDs, reminder.ID)
+		}
+
+		if len(skippedIDs) > 0 {
+			if err := tx.Model(&models.Reminder{}).Where("id IN ?", skippedIDs).
+				Update("status", models.ReminderSkipped).Error; err != nil {
+				return err
+			}
+			log.Printf("Skipped %d missed reminders superseded by later ones", len(skippedIDs))
+		}
+		return tx.Model(&models.Reminder{}).Where("id IN ?", claimedIDs).Updates(map[string]interface{}{
+			"claimed_until": now.Add(claimLease),
+			"attempts":      gorm.Expr("attempts + 1"),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+// deliver sends a claimed reminder and records the outcome. It reports
+// whether the reminder was sent.
+func deliver(ctx context.Context, database *gorm.DB, reminder models.Reminder) bool {
+	mu.RLock()
+	notifier := notifiers[reminder.Channel]
+	mu.RUnlock()
+
+	msg, ok, err := message(database, reminder)
+	if err == nil && !ok {
+		finish(database, reminder, models.ReminderSkipped, "")
+		return false
+	}
+	if err == nil && notifier == nil {
+		err = fmt.Errorf("no notifier for channel %s", reminder.Channel)
+	}
+	if err == nil {
+		sendCtx, cancel := context.WithTimeout(ctx, deliveryTimeout)
+		err = notifier.Notify(sendCtx, msg)
+		cancel()
+	}
+
+	if err != nil {
+		log.Printf("Error delivering reminder %d for task %d (attempt %d): %v", reminder.ID, reminder.TaskID, reminder.Attempts, err)
+		if reminder.Attempts >= maxAttempts {
+			finish(database, reminder, models.ReminderFailed, err.Error())
+		} else {
+			database.Model(&models.Reminder{}).Where("id = ?", reminder.ID).Update("last_error", err.Error())
+		}
+		return false
+	}
+	finish(database, reminder, models.ReminderSent, "")
+	log.Printf("Sent reminder %d for task %d over %s", reminder.ID, reminder.TaskID, reminder.Channel)
+	return true
+}
+
+// message builds the notification for reminder. It reports false when
+// the task was completed or deleted, or the user is gone, since then there
+// is nothing left to remind about.
+func message(database *gorm.DB, reminder models.Reminder) (notify.Message, bool, error) {
+	var task models.Task
+	var user models.User
+	err := database.Where("id = ?", reminder.TaskID).First(&task).Error
+	if err == nil {
+		err = database.First(&user, reminder.UserID).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && task.StatusCategory == models.CategoryDone) {
+		return notify.Message{}, false, nil
+	}
+	if err != nil {
+		return notify.Message{}, false, err
+	}
+
+	body := fmt.Sprintf("This is your reminder for %q.", task.Title)
+	if task.DueDate != nil {
+		body = fmt.Sprintf("%q is due %s.", task.Title, task.DueDate.In(user.Location()).Format("Mon Jan 2, 2006 15:04 MST"))
+	}
+	return notify.Message{
+		User:   user,
+		Kind:   notify.KindReminder,
+		Title:  notify.Truncate("Reminder: "+task.Title, notify.MaxTitleLength),
+		Body:   body,
+		TaskID: &task.ID,
+		SentAt: time.Now(),
+	}, true, nil
+}
+
+func finish(database *gorm.DB, reminder models.Reminder, status, lastError string) {
+	updates := map[string]interface{}{"status": status, "claimed_until": nil, "last_error": lastError}
+	if status == models.ReminderSent {
+		updates["sent_at"] = time.Now()
+	}
+	if err := database.Model(&models.Reminder{}).Where("id = ?", reminder.ID).Updates(updates).Error; err != nil {
+		log.Printf("Error recording reminder %d as %s: %v", reminder.ID, status, err)
+	}
+}
+
+// Start runs Run in the background at the given interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := Run(context.Background()); err != nil {
+				log.Printf("Error sending reminders: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,134 @@
+// retention/retention.go
+package retention
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/dataexport"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+// purgeBatchSize bounds how many accounts one Purge call removes.
+const purgeBatchSize = 100
+
+// userOwned lists every table with a user_id column whose rows are removed
+// together with the account. Audit events are kept as a security record.
+var userOwned = []interface{}{
+	&models.Task{},
+	&models.Tag{},
+	&models.Workflow{},
+	&models.TaskDependency{},
+	&models.Reminder{},
+	&models.Notification{},
+	&models.Comment{},
+	&models.Attachment{},
+	&models.RefreshToken{},
+	&models.PersonalAccessToken{},
+	&models.UserToken{},
+	&models.RecoveryCode{},
+	&models.UserIdentity{},
+	&models.RevokedToken{},
+	&models.TokenCutoff{},
+	&models.Session{},
+}
+
+var (
+	mu    sync.RWMutex
+	db    *gorm.DB
+	grace time.Duration
+)
+
+// Init sets the database and how long a soft-deleted account is kept
+// before it is erased.
+func Init(database *gorm.DB, gracePeriod time.Duration) {
+	mu.Lock()
+	db = database
+	grace = gracePeriod
+	mu.Unlock()
+}
+
+// PurgeAt returns when an account deleted at deletedAt will be erased.
+func PurgeAt(deletedAt time.Time) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return deletedAt.Add(grace)
+}
+
+// PurgeDeletedAccounts permanently removes accounts soft-deleted more than
+// the grace period ago, along with everything they own, and returns how
+// many were removed.
+func PurgeDeletedAccounts() (int, error) {
+	mu.RLock()
+	database, cutoff := db, time.Now().Add(-grace)
+	mu.RUnlock()
+	if database == nil {
+		return 0, nil
+	}
+
+	var ids []uint
+	if err := database.Unscoped().Model(&models.User{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Limit(purgeBatchSize).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if err := database.Transaction(func(tx *gorm.DB) error {
+			if err := dataexport.Discard(tx, id); err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM task_tags WHERE tag_id IN (SELECT id FROM tags WHERE user_id = ?)", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM workflow_transitions WHERE workflow_id IN (SELECT id FROM workflows WHERE user_id = ?)", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM workflow_statuses WHERE workflow_id IN (SELECT id FROM workflows WHERE user_id = ?)", id).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("DELETE FROM comment_revisions WHERE comment_id IN (SELECT id FROM comments WHERE user_id = ?)", id).Error; err != nil {
+				return err
+			}
+			for _, model := range userOwned {
+				if err := tx.Unscoped().Where("user_id = ?", id).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Unscoped().Delete(&models.User{}, id).Error
+		}); err != nil {
+			return i, err
+		}
+		log.Printf("Purged deleted account user_id %d", id)
+	}
+	return len(ids), nil
+}
+
+// PurgeExpiredSessions removes cookie sessions that can no longer be used.
+func PurgeExpiredSessions() error {
+	mu.RLock()
+	database := db
+	mu.RUnlock()
+	if database == nil {
+		return nil
+	}
+	return database.Where("expires_at < ?", time.Now()).Delete(&models.Session{}).Error
+}
+
+// Start runs PurgeDeletedAccounts and PurgeExpiredSessions in the
+// background at the given interval.
+func Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if _, err := PurgeDeletedAccounts(); err != nil {
+				log.Printf("Error purging deleted accounts: %v", err)
+			}
+			if err := PurgeExpiredSessions(); err != nil {
+				log.Printf("Error purging expired sessions: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,55 @@
+// revocation/bloom.go
+package revocation
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// bloomFilter answers "definitely not revoked" without touching the
+// database. False positives fall through to the LRU and then the DB.
+type bloomFilter struct {
+	bits []uint64
+	m    uint64
+	k    uint64
+}
+
+func newBloomFilter(expected int, falsePositiveRate float64) *bloomFilter {
+	if expected < 1 {
+		expected = 1
+	}
+	m := uint64(math.Ceil(-float64(expected) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(expected) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, k: k}
+}
+
+func (b *bloomFilter) hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+	h.Write([]byte{0})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+func (b *bloomFilter) Add(key string) {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloomFilter) Test(key string) bool {
+	h1, h2 := b.hashes(key)
+	for i := uint64(0); i < b.k; i++ {
+		bit := (h1 + i*h2) % b.m
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
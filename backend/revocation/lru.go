@@ -0,0 +1,43 @@
+// revocation/lru.go
+package revocation
+
+import "container/list"
+
+// lruCache remembers recent DB answers for token IDs that hit the bloom
+// filter, so a false positive costs at most one query per token.
+type lruCache struct {
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+type lruEntry struct {
+	key     string
+	revoked bool
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (c *lruCache) Get(key string) (bool, bool) {
+	if el, ok := c.items[key]; ok {
+		c.order.MoveToFront(el)
+		return el.Value.(*lruEntry).revoked, true
+	}
+	return false, false
+}
+
+func (c *lruCache) Set(key string, revoked bool) {
+	if el, ok := c.items[key]; ok {
+		el.Value.(*lruEntry).revoked = revoked
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key: key, revoked: revoked})
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
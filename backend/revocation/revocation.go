@@ -0,0 +1,239 @@
+// revocation/revocation.go
+package revocation
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	minFilterSize     = 100000
+	falsePositiveRate = 0.001
+	lruCapacity       = 10000
+	// syncOverlap re-reads a little history on each sync so rows committed
+	// by another replica with a slightly skewed clock are not missed.
+	syncOverlap = 5 * time.Second
+)
+
+var ErrNotInitialized = errors.New("revocation: store not initialized")
+
+var (
+	mu       sync.Mutex
+	db       *gorm.DB
+	filter   *bloomFilter
+	recent   *lruCache
+	cutoffs  map[uint]time.Time
+	maxTTL   time.Duration
+	lastSync time.Time
+)
+
+// Init loads outstanding revocations from the database. maxTokenTTL is the
+// longest lifetime of any access token still accepted, legacy ones
+// included, and bounds how long per-user cutoffs need to be kept.
+func Init(database *gorm.DB, maxTokenTTL time.Duration) error {
+	mu.Lock()
+	defer mu.Unlock()
+	db = database
+	maxTTL = maxTokenTTL
+	return reloadLocked()
+}
+
+// IsInitialized reports whether Init has been called.
+func IsInitialized() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return db != nil
+}
+
+func reloadLocked() error {
+	now := time.Now()
+
+	var jtis []string
+	if err := db.Model(&models.RevokedToken{}).Where("expires_at > ?", now).Pluck("jti", &jtis).Error; err != nil {
+		return err
+	}
+	var rows []models.TokenCutoff
+	if err := db.Find(&rows).Error; err != nil {
+		return err
+	}
+
+	size := 2 * len(jtis)
+	if size < minFilterSize {
+		size = minFilterSize
+	}
+	filter = newBloomFilter(size, falsePositiveRate)
+	for _, jti := range jtis {
+		filter.Add(jti)
+	}
+	recent = newLRUCache(lruCapacity)
+	cutoffs = make(map[uint]time.Time, len(rows))
+	for _, row := range rows {
+		cutoffs[row.UserID] = row.NotBefore
+	}
+	lastSync = now
+	return nil
+}
+
+// Revoke blocks the access token identified by jti until expiresAt.
+func Revoke(jti string, userID uint, expiresAt time.Time) error {
+	if jti == "" || !expiresAt.After(time.Now()) {
+		return nil
+	}
+	if !IsInitialized() {
+		return ErrNotInitialized
+	}
+	record := models.RevokedToken{
+		JTI:       jti,
+		UserID:    userID,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	filter.Add(jti)
+	recent.Set(jti, true)
+	mu.Unlock()
+	return nil
+}
+
+// SessionKey is the identifier Revoke takes to block every access token
+// minted for one session, whatever their jti.
+func SessionKey(sessionID uint) string {
+	return "session:" + strconv.FormatUint(uint64(sessionID), 10)
+}
+
+// RevokeAllForUser rejects every access token issued to userID up to now.
+func RevokeAllForUser(userID uint) error {
+	if !IsInitialized() {
+		return ErrNotInitialized
+	}
+	now := time.Now()
+	cutoff := models.TokenCutoff{UserID: userID, NotBefore: now, UpdatedAt: now}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"not_before", "updated_at"}),
+	}).Create(&cutoff).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	cutoffs[userID] = now
+	mu.Unlock()
+	return nil
+}
+
+// IsRevoked reports whether a token with the given jti, owner and issue time
+// has been revoked. Most calls are answered from memory; the database is
+// only consulted when the bloom filter reports a possible match.
+func IsRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	mu.Lock()
+	if db == nil {
+		mu.Unlock()
+		return false
+	}
+	if cutoff, ok := cutoffs[userID]; ok && issuedAt.Before(cutoff) {
+		mu.Unlock()
+		return true
+	}
+	if jti == "" || !filter.Test(jti) {
+		mu.Unlock()
+		return false
+	}
+	if revoked, ok := recent.Get(jti); ok {
+		mu.Unlock()
+		return revoked
+	}
+	database := db
+	mu.Unlock()
+
+	var count int64
+	if err := database.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error; err != nil {
+		log.Printf("Error checking token revocation for jti %s: %v", jti, err)
+		return true
+	}
+
+	mu.Lock()
+	recent.Set(jti, count > 0)
+	mu.Unlock()
+	return count > 0
+}
+
+// Sync pulls revocations written by other replicas since the last sync.
+func Sync() error {
+	mu.Lock()
+	database := db
+	since := lastSync.Add(-syncOverlap)
+	mu.Unlock()
+
+	now := time.Now()
+	var tokens []models.RevokedToken
+	if err := database.Where("created_at >= ?", since).Find(&tokens).Error; err != nil {
+		return err
+	}
+	var rows []models.TokenCutoff
+	if err := database.Where("updated_at >= ?", since).Find(&rows).Error; err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, token := range tokens {
+		filter.Add(token.JTI)
+		recent.Set(token.JTI, true)
+	}
+	for _, row := range rows {
+		if row.NotBefore.After(cutoffs[row.UserID]) {
+			cutoffs[row.UserID] = row.NotBefore
+		}
+	}
+	lastSync = now
+	return nil
+}
+
+// Purge deletes revocations for tokens that have expired on their own and
+// rebuilds the in-memory filter so it does not fill up over time.
+func Purge() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	if err := db.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	if err := db.Where("not_before < ?", now.Add(-maxTTL)).Delete(&models.TokenCutoff{}).Error; err != nil {
+		return err
+	}
+	return reloadLocked()
+}
+
+// Start runs Sync and Purge in the background at the given intervals.
+func Start(syncInterval, purgeInterval time.Duration) {
+	go func() {
+		syncTicker := time.NewTicker(syncInterval)
+		purgeTicker := time.NewTicker(purgeInterval)
+		defer syncTicker.Stop()
+		defer purgeTicker.Stop()
+		for {
+			select {
+			case <-syncTicker.C:
+				if err := Sync(); err != nil {
+					log.Printf("Error syncing token revocations: %v", err)
+				}
+			case <-purgeTicker.C:
+				if err := Purge(); err != nil {
+					log.Printf("Error purging token revocations: %v", err)
+				}
+			}
+		}
+	}()
+}
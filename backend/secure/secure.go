@@ -0,0 +1,26 @@
+// secure/secure.go
+package secure
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// RandomToken returns n random bytes encoded as unpadded URL-safe base64,
+// suitable for opaque bearer values such as refresh tokens.
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of token. Opaque tokens carry enough
+// entropy that a fast hash is sufficient for storing them at rest.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	db := setupAuthTestDB()
+	db.AutoMigrate(&models.Task{})
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.PersonalAccessToken{})
+
+	login := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "robot-owner",
+		"password": "password123",
+		"email":    "robot@example.com",
+	}))
+
+	router := mux.NewRouter()
+	router.Handle("/tokens", middleware.RequireLogin(http.HandlerFunc(handlers.CreateAccessToken))).Methods("POST")
+	router.Handle("/tokens", middleware.RequireLogin(http.HandlerFunc(handlers.GetAccessTokens))).Methods("GET")
+	router.Handle("/tokens/{id}", middleware.RequireLogin(http.HandlerFunc(handlers.RevokeAccessToken))).Methods("DELETE")
+	router.Handle("/tasks", middleware.RequireScope(models.ScopeTasksWrite)(http.HandlerFunc(handlers.CreateTask))).Methods("POST")
+	router.Handle("/tasks", middleware.RequireScope(models.ScopeTasksRead)(http.HandlerFunc(handlers.GetTasks))).Methods("GET")
+
+	rr := authedRequest(t, router, "POST", "/tokens", login["token"], map[string]interface{}{
+		"name":   "ci",
+		"scopes": []string{"tasks:delete"},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for an unknown scope, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = authedRequest(t, router, "POST", "/tokens", login["token"], map[string]interface{}{
+		"name":   "ci",
+		"scopes": []string{models.ScopeTasksRead},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var created struct {
+		ID    uint   `json:"id"`
+		Token string `json:"token"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &created)
+
+	var stored models.PersonalAccessToken
+	db.First(&stored, created.ID)
+	if stored.TokenHash == created.Token || stored.TokenHash == "" {
+		t.Error("Expected the token to be stored hashed")
+	}
+
+	if rr := authedRequest(t, router, "GET", "/tasks", created.Token, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected read-scoped token to list tasks, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := authedRequest(t, router, "POST", "/tasks", created.Token, map[string]string{"title": "x"}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected read-scoped token to be refused writes, got %v", rr.Code)
+	}
+	if rr := authedRequest(t, router, "GET", "/tokens", created.Token, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected personal access tokens to be refused on account routes, got %v", rr.Code)
+	}
+	if rr := authedRequest(t, router, "POST", "/tasks", login["token"], map[string]string{"title": "x"}); rr.Code != http.StatusCreated {
+		t.Errorf("Expected login token to keep full access, got %v", rr.Code)
+	}
+
+	db.First(&stored, created.ID)
+	if stored.LastUsedAt == nil {
+		t.Error("Expected last_used_at to be recorded")
+	}
+
+	if rr := authedRequest(t, router, "DELETE", "/tokens/"+strconv.Itoa(int(created.ID)), login["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on revoke, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := authedRequest(t, router, "GET", "/tasks", created.Token, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be refused, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/mailer"
+	"github.com/harip/GoTasker/models"
+)
+
+// recordingMailer keeps sent messages in memory
+type recordingMailer struct {
+	mu       sync.Mutex
+	messages []mailer.Message
+}
+
+func (m *recordingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.messages = append(m.messages, msg)
+	return nil
+}
+
+var linkTokenPattern = regexp.MustCompile(`token=([A-Za-z0-9_\-%]+)`)
+
+// lastToken returns the token from the most recent email's link
+func (m *recordingMailer) lastToken(t *testing.T) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.messages) == 0 {
+		t.Fatal("Expected an email to have been sent")
+	}
+	match := linkTokenPattern.FindStringSubmatch(m.messages[len(m.messages)-1].Body)
+	if match == nil {
+		t.Fatalf("No token link in email body %q", m.messages[len(m.messages)-1].Body)
+	}
+	return match[1]
+}
+
+func TestEmailVerification(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.UserToken{})
+	outbox := &recordingMailer{}
+	handlers.SetMailer(outbox)
+	defer handlers.SetMailer(nil)
+
+	postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "verifyme",
+		"password": "password123",
+		"email":    "verifyme@example.com",
+	})
+	token := outbox.lastToken(t)
+
+	if rr := postJSON(t, handlers.VerifyEmail, "/email/verify", map[string]string{"token": token}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var user models.User
+	db.Where("username = ?", "verifyme").First(&user)
+	if user.EmailVerifiedAt == nil {
+		t.Error("Expected email_verified_at to be set")
+	}
+	if rr := postJSON(t, handlers.VerifyEmail, "/email/verify", map[string]string{"token": token}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a used token to be rejected, got %v", rr.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.UserToken{}, &models.RefreshToken{})
+	outbox := &recordingMailer{}
+	handlers.SetMailer(outbox)
+	defer handlers.SetMailer(nil)
+
+	creds := map[string]string{
+		"username": "forgetful",
+		"password": "old-password",
+		"email":    "forgetful@example.com",
+	}
+	session := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))
+
+	rr := postJSON(t, handlers.ForgotPassword, "/password/forgot", map[string]string{"email": "nobody@example.com"})
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("Expected unknown emails to get the same %v response, got %v", http.StatusAccepted, rr.Code)
+	}
+	sent := len(outbox.messages)
+
+	rr = postJSON(t, handlers.ForgotPassword, "/password/forgot", map[string]string{"email": creds["email"]})
+	if rr.Code != http.StatusAccepted || len(outbox.messages) != sent+1 {
+		t.Fatalf("Expected a reset email, got status %v and %d new emails", rr.Code, len(outbox.messages)-sent)
+	}
+	token := outbox.lastToken(t)
+
+	rr = postJSON(t, handlers.ResetPassword, "/password/reset", map[string]string{"token": token, "password": "new-password"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = postJSON(t, handlers.ResetPassword, "/password/reset", map[string]string{"token": token, "password": "another"})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected the reset token to be single-use, got %v", rr.Code)
+	}
+
+	if rr := postJSON(t, handlers.Login, "/login", creds); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected old password to stop working, got %v", rr.Code)
+	}
+	creds["password"] = "new-password"
+	if rr := postJSON(t, handlers.Login, "/login", creds); rr.Code != http.StatusOK {
+		t.Errorf("Expected new password to work, got %v", rr.Code)
+	}
+	rr = postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": session["refresh_token"]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected existing sessions to be revoked by the reset, got %v", rr.Code)
+	}
+
+	var stored models.UserToken
+	db.Where("purpose = ?", models.TokenPurposePasswordReset).First(&stored)
+	if stored.TokenHash == token {
+		t.Error("Expected reset tokens to be stored hashed")
+	}
+}
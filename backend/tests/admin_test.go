@@ -0,0 +1,94 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+func adminRouter() *mux.Router {
+	r := mux.NewRouter()
+	admin := middleware.RequireRole(models.RoleAdmin)
+	r.Handle("/admin/users", admin(http.HandlerFunc(handlers.AdminListUsers))).Methods("GET")
+	r.Handle("/admin/users/{id}", admin(http.HandlerFunc(handlers.AdminDeleteUser))).Methods("DELETE")
+	r.Handle("/admin/users/{id}/disable", admin(http.HandlerFunc(handlers.AdminDisableUser))).Methods("POST")
+	r.Handle("/admin/users/{id}/enable", admin(http.HandlerFunc(handlers.AdminEnableUser))).Methods("POST")
+	r.Handle("/admin/users/{id}/role", admin(http.HandlerFunc(handlers.AdminSetUserRole))).Methods("PUT")
+	return r
+}
+
+func TestAdminUserManagement(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+	router := adminRouter()
+
+	adminCreds := map[string]string{"username": "root", "password": "password123", "email": "root@example.com"}
+	memberCreds := map[string]string{"username": "member", "password": "password123", "email": "member@example.com"}
+	postJSON(t, handlers.Register, "/register", adminCreds)
+	memberTokens := decodeTokens(t, postJSON(t, handlers.Register, "/register", memberCreds))
+	db.Model(&models.User{}).Where("username = ?", "root").Update("role", models.RoleAdmin)
+	adminToken := decodeTokens(t, postJSON(t, handlers.Login, "/login", adminCreds))["token"]
+
+	var admin, member models.User
+	db.Where("username = ?", "root").First(&admin)
+	db.Where("username = ?", "member").First(&member)
+
+	if rr := authedRequest(t, router, "GET", "/admin/users", memberTokens["token"], nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v for a member, got %v", http.StatusForbidden, rr.Code)
+	}
+	rr := authedRequest(t, router, "GET", "/admin/users?role=member", adminToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v listing users, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var list struct {
+		Users []models.User `json:"users"`
+		Total int           `json:"total"`
+	}
+	json.NewDecoder(rr.Body).Decode(&list)
+	if list.Total != 1 || list.Users[0].Username != "member" {
+		t.Errorf("Expected only the member in the listing, got %+v", list)
+	}
+
+	// Disabling cuts off tokens that were already issued
+	if rr := authedRequest(t, router, "POST", fmt.Sprintf("/admin/users/%d/disable", member.ID), adminToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v disabling user, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := authedRequest(t, middleware.RequireLogin(okHandler), "GET", "/tasks", memberTokens["token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a disabled user's token to be rejected, got %v", rr.Code)
+	}
+	if rr := postJSON(t, handlers.Login, "/login", memberCreds); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v logging in while disabled, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := authedRequest(t, router, "POST", fmt.Sprintf("/admin/users/%d/enable", member.ID), adminToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v enabling user, got %v", http.StatusOK, rr.Code)
+	}
+
+	// Admins cannot lock themselves out
+	if rr := authedRequest(t, router, "POST", fmt.Sprintf("/admin/users/%d/disable", admin.ID), adminToken, nil); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v disabling self, got %v", http.StatusConflict, rr.Code)
+	}
+
+	if rr := authedRequest(t, router, "PUT", fmt.Sprintf("/admin/users/%d/role", member.ID), adminToken, map[string]string{"role": "owner"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for an unknown role, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if rr := authedRequest(t, router, "PUT", fmt.Sprintf("/admin/users/%d/role", member.ID), adminToken, map[string]string{"role": models.RoleAdmin}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v promoting user, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	promotedToken := decodeTokens(t, postJSON(t, handlers.Login, "/login", memberCreds))["token"]
+	if rr := authedRequest(t, router, "GET", "/admin/users", promotedToken, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected a promoted user to reach the admin API, got %v", rr.Code)
+	}
+
+	if rr := authedRequest(t, router, "DELETE", fmt.Sprintf("/admin/users/%d", member.ID), adminToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v deleting user, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := postJSON(t, handlers.Login, "/login", memberCreds); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted user to be unable to log in, got %v", rr.Code)
+	}
+}
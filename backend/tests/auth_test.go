@@ -7,25 +7,43 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/harip/GoTasker/config"
 	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/middleware"
 	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/password"
+	"github.com/harip/GoTasker/revocation"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func setupAuthTestDB() *gorm.DB {
+	config.LoadConfig()
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
 		log.Fatalf("Failed to connect to test database: %v", err)
 	}
-	if err := db.AutoMigrate(&models.User{}); err != nil {
+	if err := db.AutoMigrate(&models.User{}, &models.Task{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{}, &models.SigningKey{}, &models.PersonalAccessToken{}, &models.UserToken{}, &models.RecoveryCode{}, &models.LoginThrottle{}, &models.AuditEvent{}, &models.UserIdentity{}, &models.DataExport{}, &models.Session{}, &models.Tag{}, &models.TaskDependency{}, &models.Reminder{}, &models.Notification{}, &models.Comment{}, &models.CommentRevision{}, &models.Attachment{}, &models.Blob{}, &models.Workflow{}, &models.WorkflowStatus{}, &models.WorkflowTransition{}); err != nil {
 		log.Fatalf("Failed to auto-migrate test database: %v", err)
 	}
 	handlers.InitDB(db)
 	if !handlers.IsDBInitialized() {
 		log.Fatal("Failed to initialize test database")
 	}
+	middleware.SetDB(db)
+	if err := keyring.Init(db, keyring.Options{
+		Algorithm:        keyring.HS256,
+		RotationInterval: time.Hour,
+		MaxTokenTTL:      config.AppConfig.AccessTokenTTL,
+	}); err != nil {
+		log.Fatalf("Failed to initialize keyring: %v", err)
+	}
+	if err := revocation.Init(db, config.AppConfig.AccessTokenTTL); err != nil {
+		log.Fatalf("Failed to initialize revocation store: %v", err)
+	}
 	log.Println("Test database initialized successfully")
 	return db
 }
@@ -100,4 +118,42 @@ func TestLogin(t *testing.T) {
 		t.Error("Expected a token, got none")
 	}
 	log.Println("Valid credentials test passed, token received")
+
+	// The plaintext row should have been upgraded on successful login
+	var stored models.User
+	if err := db.First(&stored, user.ID).Error; err != nil {
+		t.Fatalf("Failed to reload user: %v", err)
+	}
+	if !password.IsHashed(stored.Password) || password.NeedsRehash(stored.Password) {
+		t.Errorf("Expected password to be upgraded to the default hash, got %q", stored.Password)
+	}
+	if ok, _ := password.Verify("password123", stored.Password); !ok {
+		t.Error("Expected upgraded hash to verify the original password")
+	}
+}
+
+func TestRegisterHashesPassword(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{})
+
+	body, _ := json.Marshal(map[string]string{
+		"username": "newuser",
+		"password": "s3cret-pass",
+		"email":    "newuser@example.com",
+	})
+	req, _ := http.NewRequest("POST", "/register", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.Register).ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var stored models.User
+	if err := db.Where("username = ?", "newuser").First(&stored).Error; err != nil {
+		t.Fatalf("Failed to load user: %v", err)
+	}
+	if stored.Password == "s3cret-pass" || !password.IsHashed(stored.Password) {
+		t.Errorf("Expected hashed password, got %q", stored.Password)
+	}
 }
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harip/GoTasker/auth"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+// capturePrincipal records the principal the middleware stored
+func capturePrincipal(got **auth.Principal) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*got, _ = auth.FromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestAuthenticatorChain(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.PersonalAccessToken{})
+
+	login := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "principal",
+		"password": "password123",
+		"email":    "principal@example.com",
+	}))
+	var user models.User
+	db.Where("username = ?", "principal").First(&user)
+
+	var principal *auth.Principal
+	if rr := authedRequest(t, middleware.RequireLogin(capturePrincipal(&principal)), "GET", "/", login["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	if principal.UserID != user.ID || principal.Username != "principal" || principal.Method != auth.MethodJWT ||
+		principal.TokenID == "" || !principal.HasRole(models.RoleMember) || principal.Scopes != nil {
+		t.Errorf("Unexpected principal for a login token: %+v", principal)
+	}
+
+	rr := authedRequest(t, middleware.RequireLogin(http.HandlerFunc(handlers.CreateAccessToken)), "POST", "/tokens", login["token"], map[string]interface{}{
+		"name":   "ci",
+		"scopes": []string{models.ScopeTasksRead},
+	})
+	var created struct {
+		Token string `json:"token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&created)
+
+	principal = nil
+	if rr := authedRequest(t, middleware.RequireScope(models.ScopeTasksRead)(capturePrincipal(&principal)), "GET", "/", created.Token, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v for an API key, got %v", http.StatusOK, rr.Code)
+	}
+	if principal.UserID != user.ID || principal.Username != "principal" || principal.Method != auth.MethodAPIKey ||
+		len(principal.Roles) != 0 || !principal.HasScope(models.ScopeTasksRead) || principal.HasScope(models.ScopeTasksWrite) {
+		t.Errorf("Unexpected principal for an API key: %+v", principal)
+	}
+
+	// Requests without a usable credential never reach the handler
+	for name, header := range map[string]string{
+		"missing":   "",
+		"basic":     "Basic dXNlcjpwYXNz",
+		"malformed": "Bearer not-a-jwt",
+	} {
+		req := httptest.NewRequest("GET", "/", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		rr := httptest.NewRecorder()
+		middleware.RequireScope(models.ScopeTasksRead)(okHandler).ServeHTTP(rr, req)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %v, got %v", name, http.StatusUnauthorized, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/markdown"
+	"github.com/harip/GoTasker/models"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"**bold** and *italic* and ~~gone~~", "<p><strong>bold</strong> and <em>italic</em> and <del>gone</del></p>"},
+		{"line one\nline two\n\nnext", "<p>line one<br>line two</p>\n<p>next</p>"},
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"[site](https://example.com/?a=1&b=\"2\")", `<p><a href="https://example.com/?a=1&amp;b=&#34;2&#34;" rel="nofollow noopener noreferrer">site</a></p>`},
+		{"[x](javascript:alert(1))", "<p>[x](javascript:alert(1))</p>"},
+		{"`<b>*raw*</b>`", "<p><code>&lt;b&gt;*raw*&lt;/b&gt;</code></p>"},
+		{"- one\n- two", "<ul><li>one</li><li>two</li></ul>"},
+		{"## Plan\n> ping @bob", `<h2>Plan</h2>` + "\n" + `<blockquote><p>ping <span class="mention">@bob</span></p></blockquote>`},
+		{"```\n<img src=x onerror=alert(1)>\n```", "<pre><code>&lt;img src=x onerror=alert(1)&gt;</code></pre>"},
+	}
+	for _, tt := range tests {
+		if got := markdown.Render(tt.src); got != tt.want {
+			t.Errorf("Render(%q):\nexpected %s\n     got %s", tt.src, tt.want, got)
+		}
+	}
+
+	got := markdown.Mentions("@bob, ask @amy.lee. `@code` mail x@example.com @bob\n```\n@fenced\n```")
+	if fmt.Sprint(got) != "[bob amy.lee]" {
+		t.Errorf("Expected mentions [bob amy.lee], got %v", got)
+	}
+}
+
+func commentsRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tasks", handlers.GetTasks).Methods("GET")
+	r.HandleFunc("/tasks/{id}/comments", handlers.GetComments).Methods("GET")
+	r.HandleFunc("/tasks/{id}/comments", handlers.CreateComment).Methods("POST")
+	r.HandleFunc("/tasks/{id}/comments/{comment_id}", handlers.UpdateComment).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/comments/{comment_id}", handlers.DeleteComment).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/comments/{comment_id}/history", handlers.GetCommentHistory).Methods("GET")
+	return r
+}
+
+func TestTaskComments(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.User{}, &models.Notification{}, &models.CommentRevision{})
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags", &models.Reminder{},
+		&models.Comment{}, &models.CommentRevision{}, &models.Notification{}, &models.User{})
+	router := commentsRouter()
+
+	disabledAt := time.Now()
+	for i, name := range []string{"alice", "bob", "carol", "dave"} {
+		user := models.User{ID: uint(i + 1), Username: name, Email: name + "@example.com"}
+		if name == "carol" {
+			user.DisabledAt = &disabledAt
+		}
+		db.Create(&user)
+	}
+	task := models.Task{Title: "Launch", Status: "Pending", UserID: 1}
+	db.Create(&task)
+	quiet := models.Task{Title: "Quiet", Status: "Pending", UserID: 1}
+	db.Create(&quiet)
+	path := fmt.Sprintf("/tasks/%d/comments", task.ID)
+
+	notificationsFor := func(userID uint) []models.Notification {
+		var list []models.Notification
+		db.Where("user_id = ?", userID).Order("id").Find(&list)
+		return list
+	}
+
+	// Mentions of yourself, disabled accounts and unknown names are ignored
+	rr := userRequest(router, 1, "POST", path, map[string]string{"body": "Thoughts, @bob? cc @carol @alice @nobody <script>x</script>"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var comment models.Comment
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	if strings.Contains(comment.BodyHTML, "<script>") || !strings.Contains(comment.BodyHTML, `<span class="mention">@bob</span>`) {
+		t.Errorf("Unexpected body_html %s", comment.BodyHTML)
+	}
+	got := notificationsFor(2)
+	if len(got) != 1 || got[0].Kind != "mention" || got[0].TaskID == nil || *got[0].TaskID != task.ID {
+		t.Fatalf("Expected bob to get one mention notification, got %+v", got)
+	}
+	// bob cannot open the task, so nothing from it is quoted
+	if got[0].Title != "alice mentioned you in a comment" || got[0].Body != "" || strings.Contains(got[0].Title, task.Title) {
+		t.Errorf("Expected a notification without task or comment content, got %+v", got[0])
+	}
+	if len(notificationsFor(1)) != 0 || len(notificationsFor(3)) != 0 {
+		t.Errorf("Expected no notifications for the author or a disabled account")
+	}
+
+	for _, body := range []string{"", "   ", strings.Repeat("x", 10001)} {
+		if rr := userRequest(router, 1, "POST", path, map[string]string{"body": body}); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %v for a body of %d characters, got %v", http.StatusBadRequest, len(body), rr.Code)
+		}
+	}
+	if rr := userRequest(router, 2, "POST", path, map[string]string{"body": "hi"}); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v commenting on another user's task, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	// Editing keeps the old body and only notifies newly mentioned users,
+	// however often it is saved
+	commentPath := fmt.Sprintf("%s/%d", path, comment.ID)
+	rr = userRequest(router, 1, "PUT", commentPath, map[string]string{"body": "Thoughts, @bob and @dave?"})
+	json.Unmarshal(rr.Body.Bytes(), &comment)
+	if rr.Code != http.StatusOK || comment.EditedAt == nil {
+		t.Fatalf("Expected the comment to be edited, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := userRequest(router, 1, "PUT", commentPath, map[string]string{"body": "Thoughts, @bob and @dave? Friday works"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v saving the edit again, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if len(notificationsFor(2)) != 1 || len(notificationsFor(4)) != 1 {
+		t.Errorf("Expected only dave to be notified of the edit, once")
+	}
+	rr = userRequest(router, 1, "GET", commentPath+"/history", nil)
+	var history struct {
+		Revisions []models.CommentRevision `json:"revisions"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &history)
+	if len(history.Revisions) != 2 || !strings.HasPrefix(history.Revisions[0].Body, "Thoughts, @bob? cc") {
+		t.Errorf("Expected the original body in the history, got %s", rr.Body.String())
+	}
+
+	userRequest(router, 1, "POST", path, map[string]string{"body": "Second"})
+	rr = userRequest(router, 1, "GET", "/tasks?sort_by=id&sort_order=asc", nil)
+	var list struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list.Tasks) != 2 || list.Tasks[0].CommentCount != 2 || list.Tasks[1].CommentCount != 0 {
+		t.Errorf("Expected comment counts 2 and 0, got %s", rr.Body.String())
+	}
+
+	if rr := userRequest(router, 1, "DELETE", commentPath, nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	rr = userRequest(router, 1, "GET", path, nil)
+	var thread struct {
+		Comments []models.Comment `json:"comments"`
+		Total    int              `json:"total"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &thread)
+	if thread.Total != 1 || len(thread.Comments) != 1 || thread.Comments[0].BodyHTML != "<p>Second</p>" {
+		t.Errorf("Expected one remaining comment, got %s", rr.Body.String())
+	}
+}
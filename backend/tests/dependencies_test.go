@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+)
+
+func dependenciesRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tasks/{id}", handlers.UpdateTask).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/blockers", handlers.GetBlockers).Methods("GET")
+	r.HandleFunc("/tasks/{id}/blockers", handlers.AddBlocker).Methods("POST")
+	r.HandleFunc("/tasks/{id}/blockers/{blocker_id}", handlers.RemoveBlocker).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/critical-path", handlers.GetCriticalPath).Methods("GET")
+	return r
+}
+
+func TestTaskDependencies(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags")
+	router := dependenciesRouter()
+
+	day := func(n int) *time.Time {
+		d := time.Now().Add(time.Duration(n) * 24 * time.Hour)
+		return &d
+	}
+	newTask := func(title string, due *time.Time) models.Task {
+		task := models.Task{Title: title, Status: "Pending", DueDate: due, UserID: 1}
+		db.Create(&task)
+		return task
+	}
+	block := func(task, blocker models.Task) int {
+		return userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/blockers", task.ID), map[string]int{"blocker_id": blocker.ID}).Code
+	}
+
+	design := newTask("Design", day(1))
+	api := newTask("API", day(5))
+	ui := newTask("UI", day(3))
+	copywriting := newTask("Copy", day(2))
+	launch := newTask("Launch", day(4))
+
+	for _, edge := range [][2]models.Task{{api, design}, {ui, design}, {launch, api}, {launch, ui}, {ui, copywriting}} {
+		if code := block(edge[0], edge[1]); code != http.StatusCreated {
+			t.Fatalf("Expected status %v adding %s blocked by %s, got %v", http.StatusCreated, edge[0].Title, edge[1].Title, code)
+		}
+	}
+	if code := block(launch, api); code != http.StatusConflict {
+		t.Errorf("Expected status %v for a duplicate blocker, got %v", http.StatusConflict, code)
+	}
+	if code := block(design, launch); code != http.StatusConflict {
+		t.Errorf("Expected status %v for a blocker that closes a cycle, got %v", http.StatusConflict, code)
+	}
+	if code := block(design, design); code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for a task blocking itself, got %v", http.StatusBadRequest, code)
+	}
+
+	// A blocked task cannot start until its blockers are completed
+	start := map[string]string{"title": "API", "status": "In Progress"}
+	if rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", api.ID), start); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v starting a blocked task, got %v", http.StatusConflict, rr.Code)
+	}
+
+	// Launch waits on Design -> API, Design -> UI and Copy -> UI. Of these
+	// equally long chains, those starting with the earlier-due Design win.
+	// API is due after Launch, which makes it late.
+	rr := userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d/critical-path", launch.ID), nil)
+	var critical struct {
+		Length int `json:"length"`
+		Path   []struct {
+			ID   int  `json:"id"`
+			Late bool `json:"late"`
+		} `json:"path"`
+	}
+	json.NewDecoder(rr.Body).Decode(&critical)
+	if critical.Length != 3 || critical.Path[0].ID != design.ID || critical.Path[2].ID != launch.ID {
+		t.Fatalf("Expected a three-task path from Design to Launch, got %+v", critical)
+	}
+	if critical.Path[1].ID == api.ID && !critical.Path[1].Late {
+		t.Errorf("Expected API to be late for Launch, got %+v", critical.Path)
+	}
+
+	userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", design.ID), map[string]string{"title": "Design", "status": "Completed"})
+	if rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", api.ID), start); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v starting a task whose blockers are done, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	json.NewDecoder(userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d/critical-path", launch.ID), nil).Body).Decode(&critical)
+	if critical.Length != 3 || critical.Path[0].ID != copywriting.ID || critical.Path[1].ID != ui.ID {
+		t.Errorf("Expected completed blockers to drop off the path, got %+v", critical)
+	}
+
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("/tasks/%d/blockers/%d", ui.ID, copywriting.ID), nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v removing a blocker, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("/tasks/%d/blockers/%d", ui.ID, copywriting.ID), nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v removing a missing blocker, got %v", http.StatusNotFound, rr.Code)
+	}
+}
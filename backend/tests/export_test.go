@@ -0,0 +1,149 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/dataexport"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+func TestDataExport(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.DataExport{})
+	if err := dataexport.Init(db, t.TempDir(), time.Hour); err != nil {
+		t.Fatalf("Failed to initialize exports: %v", err)
+	}
+	outbox := &recordingMailer{}
+	handlers.SetMailer(outbox)
+	defer handlers.SetMailer(nil)
+
+	router := mux.NewRouter()
+	router.Handle("/me/exports", middleware.RequireLogin(http.HandlerFunc(handlers.RequestDataExport))).Methods("POST")
+	router.Handle("/me/exports/{id}", middleware.RequireLogin(http.HandlerFunc(handlers.GetDataExport))).Methods("GET")
+
+	token := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "exporter",
+		"password": "password123",
+		"email":    "exporter@example.com",
+	}))["token"]
+	otherToken := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "other",
+		"password": "password123",
+		"email":    "other@example.com",
+	}))["token"]
+	var user, other models.User
+	db.Where("username = ?", "exporter").First(&user)
+	db.Where("username = ?", "other").First(&other)
+	db.Create(&models.Task{UserID: int(user.ID), Title: "Visible", Status: "Pending"})
+	deleted := models.Task{UserID: int(user.ID), Title: "Deleted", Status: "Completed", StatusCategory: models.CategoryDone}
+	db.Create(&deleted)
+	db.Delete(&deleted)
+	db.Create(&models.Task{UserID: int(other.ID), Title: "Not mine", Status: "Pending"})
+
+	rr := authedRequest(t, router, "POST", "/me/exports", token, nil)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusAccepted, rr.Code, rr.Body.String())
+	}
+	var export models.DataExport
+	json.NewDecoder(rr.Body).Decode(&export)
+
+	if rr := authedRequest(t, router, "GET", fmt.Sprintf("/me/exports/%d", export.ID), otherToken, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v for another user's export, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	var status struct {
+		Status      string `json:"status"`
+		DownloadURL string `json:"download_url"`
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for status.Status != models.ExportReady {
+		if time.Now().After(deadline) {
+			t.Fatalf("Export did not finish, last status %q", status.Status)
+		}
+		time.Sleep(20 * time.Millisecond)
+		rr := authedRequest(t, router, "GET", fmt.Sprintf("/me/exports/%d", export.ID), token, nil)
+		json.NewDecoder(rr.Body).Decode(&status)
+	}
+	if status.DownloadURL == "" {
+		t.Fatal("Expected a download link for a ready export")
+	}
+
+	link, _ := url.Parse(status.DownloadURL)
+	rr = httptest.NewRecorder()
+	handlers.DownloadDataExport(rr, httptest.NewRequest("GET", link.RequestURI(), nil))
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("Expected a ZIP download, got %v: %s", rr.Code, rr.Body.String())
+	}
+	body := rr.Body.Bytes()
+
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("Download is not a ZIP: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range archive.File {
+		rc, _ := f.Open()
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+	}
+	var tasks []struct {
+		Title     string     `json:"title"`
+		DeletedAt *time.Time `json:"deleted_at"`
+	}
+	json.Unmarshal([]byte(files["tasks.json"]), &tasks)
+	if len(tasks) != 2 || tasks[1].Title != "Deleted" || tasks[1].DeletedAt == nil {
+		t.Errorf("Expected both of the user's tasks including the deleted one, got %+v", tasks)
+	}
+	if !strings.Contains(files["profile.json"], "exporter@example.com") || strings.Contains(files["profile.json"], "password") {
+		t.Errorf("Unexpected profile.json %s", files["profile.json"])
+	}
+	if !strings.Contains(files["index.html"], "Visible") || strings.Contains(files["index.html"], "Not mine") {
+		t.Error("Expected the HTML summary to list only the user's tasks")
+	}
+
+	// Downloads can be resumed
+	req := httptest.NewRequest("GET", link.RequestURI(), nil)
+	req.Header.Set("Range", "bytes=0-9")
+	rr = httptest.NewRecorder()
+	handlers.DownloadDataExport(rr, req)
+	if rr.Code != http.StatusPartialContent || rr.Body.Len() != 10 {
+		t.Errorf("Expected a 10 byte partial response, got %v with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	// The email is sent after the export is marked ready
+	for emailed := false; !emailed; time.Sleep(20 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the download link to be emailed")
+		}
+		outbox.mu.Lock()
+		for _, msg := range outbox.messages {
+			emailed = emailed || strings.Contains(msg.Body, "/exports/download?token=")
+		}
+		outbox.mu.Unlock()
+	}
+
+	// The link stops working once the archive expires
+	db.Model(&models.DataExport{}).Where("id = ?", export.ID).Update("expires_at", time.Now().Add(-time.Minute))
+	if err := dataexport.Sweep(); err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	rr = httptest.NewRecorder()
+	handlers.DownloadDataExport(rr, httptest.NewRequest("GET", link.RequestURI(), nil))
+	if rr.Code != http.StatusGone {
+		t.Errorf("Expected status %v after expiry, got %v", http.StatusGone, rr.Code)
+	}
+}
@@ -0,0 +1,109 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+func TestAdminImpersonation(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.RefreshToken{}, &models.AuditEvent{}, &models.TokenCutoff{})
+	audit.Init(db)
+	defer audit.Init(nil)
+
+	r := mux.NewRouter()
+	r.Handle("/admin/impersonate/{id}", middleware.RequireRole(models.RoleAdmin)(http.HandlerFunc(handlers.AdminImpersonate))).Methods("POST")
+	r.Handle("/tasks", middleware.RequireScope(models.ScopeTasksRead)(http.HandlerFunc(handlers.GetTasks))).Methods("GET")
+	r.Handle("/me/password", middleware.RequireOwnLogin(http.HandlerFunc(handlers.ChangePassword))).Methods("POST")
+	r.Handle("/tokens", middleware.RequireOwnLogin(http.HandlerFunc(handlers.CreateAccessToken))).Methods("POST")
+	r.Handle("/logout-all", middleware.RequireOwnLogin(http.HandlerFunc(handlers.LogoutAll))).Methods("POST")
+
+	adminCreds := map[string]string{"username": "support", "password": "password123", "email": "support@example.com"}
+	postJSON(t, handlers.Register, "/register", adminCreds)
+	db.Model(&models.User{}).Where("username = ?", "support").Update("role", models.RoleAdmin)
+	adminToken := decodeTokens(t, postJSON(t, handlers.Login, "/login", adminCreds))["token"]
+	memberToken := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "customer", "password": "password123", "email": "customer@example.com",
+	}))["token"]
+
+	var admin, member models.User
+	db.Where("username = ?", "support").First(&admin)
+	db.Where("username = ?", "customer").First(&member)
+	db.Create(&models.Task{Title: "Customer task", Status: "Pending", UserID: int(member.ID)})
+
+	if rr := authedRequest(t, r, "POST", fmt.Sprintf("/admin/impersonate/%d", admin.ID), memberToken, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v for a member, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := authedRequest(t, r, "POST", fmt.Sprintf("/admin/impersonate/%d", admin.ID), adminToken, nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v impersonating self, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := authedRequest(t, r, "POST", fmt.Sprintf("/admin/impersonate/%d", member.ID), adminToken, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v impersonating, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var impersonation map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&impersonation)
+	token, _ := impersonation["token"].(string)
+	if _, ok := impersonation["refresh_token"]; ok {
+		t.Error("Expected no refresh token for an impersonation token")
+	}
+
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+		t.Fatalf("Failed to parse impersonation token: %v", err)
+	}
+	act, _ := claims["act"].(map[string]interface{})
+	if act["sub"] != fmt.Sprint(admin.ID) || claims["user_id"] != float64(member.ID) {
+		t.Errorf("Expected the token to act as the member on behalf of the admin, got %v", claims)
+	}
+
+	// The admin sees the user's own data
+	rr = authedRequest(t, r, "GET", "/tasks", token, nil)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Customer task") {
+		t.Errorf("Expected the member's tasks while impersonating, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	// but cannot change how the account is accessed
+	if rr := authedRequest(t, r, "POST", "/me/password", token, map[string]string{"current_password": "password123", "new_password": "hijacked123"}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v changing the password while impersonating, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := authedRequest(t, r, "POST", "/tokens", token, map[string]interface{}{"name": "backdoor", "scopes": []string{models.ScopeTasksRead}}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v creating a token while impersonating, got %v", http.StatusForbidden, rr.Code)
+	}
+
+	var events []models.AuditEvent
+	db.Where("event = ? AND user_id = ?", audit.ImpersonatedAction, member.ID).Order("id asc").Find(&events)
+	if len(events) != 3 {
+		t.Fatalf("Expected every impersonated request to be audited, got %+v", events)
+	}
+	if want := fmt.Sprintf("by=%d GET /tasks status=200", admin.ID); events[0].Detail != want {
+		t.Errorf("Expected audit detail %q, got %q", want, events[0].Detail)
+	}
+	if !strings.HasSuffix(events[1].Detail, "status=403") {
+		t.Errorf("Expected the refused request to be audited with its status, got %q", events[1].Detail)
+	}
+	var started int64
+	db.Model(&models.AuditEvent{}).Where("event = ? AND user_id = ?", audit.AdminImpersonated, member.ID).Count(&started)
+	if started != 1 {
+		t.Errorf("Expected the start of the impersonation to be audited, got %d events", started)
+	}
+
+	// Signing the admin out everywhere ends the impersonation too
+	if rr := authedRequest(t, r, "POST", "/logout-all", adminToken, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on logout-all, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := authedRequest(t, r, "GET", "/tasks", token, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the impersonation token to be revoked with the admin's sessions, got %v", rr.Code)
+	}
+}
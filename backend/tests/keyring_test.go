@@ -0,0 +1,139 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupKeyringTestDB(t *testing.T, algorithm string, rotation time.Duration) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.SigningKey{}); err != nil {
+		t.Fatalf("Failed to auto-migrate test database: %v", err)
+	}
+	if err := keyring.Init(db, keyring.Options{
+		Algorithm:        algorithm,
+		RotationInterval: rotation,
+		MaxTokenTTL:      15 * time.Minute,
+	}); err != nil {
+		t.Fatalf("Failed to initialize keyring: %v", err)
+	}
+	return db
+}
+
+func TestKeyringSignAndVerify(t *testing.T) {
+	for _, algorithm := range []string{keyring.HS256, keyring.RS256, keyring.ES256, keyring.EdDSA} {
+		setupKeyringTestDB(t, algorithm, 24*time.Hour)
+
+		signed, err := keyring.Sign(jwt.MapClaims{"user_id": float64(7), "exp": time.Now().Add(time.Minute).Unix()})
+		if err != nil {
+			t.Fatalf("%s: failed to sign: %v", algorithm, err)
+		}
+		token, err := jwt.Parse(signed, keyring.Keyfunc)
+		if err != nil || !token.Valid {
+			t.Fatalf("%s: expected token to verify, got %v", algorithm, err)
+		}
+		if token.Header["alg"] != algorithm || token.Header["kid"] == "" {
+			t.Errorf("%s: unexpected header %v", algorithm, token.Header)
+		}
+
+		rr := httptest.NewRecorder()
+		handlers.JWKS(rr, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+		var set keyring.JSONWebKeySet
+		if err := json.Unmarshal(rr.Body.Bytes(), &set); err != nil {
+			t.Fatalf("%s: failed to decode JWKS: %v", algorithm, err)
+		}
+		if algorithm == keyring.HS256 {
+			if len(set.Keys) != 0 {
+				t.Errorf("Expected HS256 secrets to stay out of the JWKS, got %v", set.Keys)
+			}
+			continue
+		}
+		if len(set.Keys) != 1 || set.Keys[0].Kid != token.Header["kid"] || set.Keys[0].Alg != algorithm {
+			t.Errorf("%s: expected JWKS to publish the signing key, got %v", algorithm, set.Keys)
+		}
+	}
+}
+
+func TestKeyringRejectsAlgorithmConfusion(t *testing.T) {
+	setupKeyringTestDB(t, keyring.RS256, 24*time.Hour)
+	kid := keyring.JWKS().Keys[0].Kid
+
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": float64(1)})
+	forged.Header["kid"] = kid
+	signed, err := forged.SignedString([]byte(kid))
+	if err != nil {
+		t.Fatalf("Failed to sign forged token: %v", err)
+	}
+	if _, err := jwt.Parse(signed, keyring.Keyfunc); err == nil {
+		t.Error("Expected an HS256 token claiming an RS256 kid to be rejected")
+	}
+
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": float64(1)})
+	signed, _ = unsigned.SignedString([]byte("mysecretkey123"))
+	if _, err := jwt.Parse(signed, keyring.Keyfunc); err == nil {
+		t.Error("Expected a token without kid to be rejected when no legacy secret is configured")
+	}
+}
+
+func TestKeyringRotation(t *testing.T) {
+	db := setupKeyringTestDB(t, keyring.EdDSA, time.Second)
+	first, err := keyring.Sign(jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	countKeys := func() int64 {
+		var count int64
+		db.Model(&models.SigningKey{}).Count(&count)
+		return count
+	}
+	if n := countKeys(); n != 1 {
+		t.Fatalf("Expected one key after init, found %d", n)
+	}
+
+	// Within half an interval of retirement the successor is published early
+	time.Sleep(600 * time.Millisecond)
+	if err := keyring.Maintain(); err != nil {
+		t.Fatalf("Failed to maintain keyring: %v", err)
+	}
+	if n := countKeys(); n != 2 {
+		t.Errorf("Expected the next key to be pre-published, found %d keys", n)
+	}
+	if len(keyring.JWKS().Keys) != 2 {
+		t.Errorf("Expected both keys in the JWKS, got %v", keyring.JWKS().Keys)
+	}
+
+	time.Sleep(500 * time.Millisecond)
+	if err := keyring.Maintain(); err != nil {
+		t.Fatalf("Failed to maintain keyring: %v", err)
+	}
+	second, err := keyring.Sign(jwt.MapClaims{})
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+
+	firstToken, err := jwt.Parse(first, keyring.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected token from the retired key to still verify: %v", err)
+	}
+	secondToken, err := jwt.Parse(second, keyring.Keyfunc)
+	if err != nil {
+		t.Fatalf("Expected token from the new key to verify: %v", err)
+	}
+	if firstToken.Header["kid"] == secondToken.Header["kid"] {
+		t.Error("Expected the signing key to rotate")
+	}
+}
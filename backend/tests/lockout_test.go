@@ -0,0 +1,127 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/harip/GoTasker/audit"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/lockout"
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+)
+
+func setupLockout(t *testing.T, db *gorm.DB, policy lockout.Policy) {
+	t.Helper()
+	lockout.Init(db, policy)
+	audit.Init(db)
+	t.Cleanup(func() {
+		lockout.Init(nil, lockout.Policy{})
+		audit.Init(nil)
+	})
+}
+
+func loginFrom(t *testing.T, ip, username, pass string) *httptest.ResponseRecorder {
+	t.Helper()
+	body, _ := json.Marshal(map[string]string{"username": username, "password": pass})
+	req, err := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.RemoteAddr = ip + ":40000"
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+	return rr
+}
+
+func TestAccountLockoutAndUnlock(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.UserToken{}, &models.RefreshToken{}, &models.LoginThrottle{}, &models.AuditEvent{})
+	setupLockout(t, db, lockout.Policy{
+		MaxFailures:      3,
+		MaxFailuresPerIP: 100,
+		BackoffAfter:     10,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	})
+	outbox := &recordingMailer{}
+	handlers.SetMailer(outbox)
+	defer handlers.SetMailer(nil)
+
+	postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "guessed",
+		"password": "password123",
+		"email":    "guessed@example.com",
+	})
+	outbox.messages = nil
+
+	for i := 0; i < 3; i++ {
+		if rr := loginFrom(t, "198.51.100.7", "guessed", "wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %v for wrong password %d, got %v", http.StatusUnauthorized, i+1, rr.Code)
+		}
+	}
+
+	// Even the right password is refused while locked
+	rr := loginFrom(t, "198.51.100.8", "guessed", "password123")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %v while locked, got %v: %s", http.StatusTooManyRequests, rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+
+	var events int64
+	db.Model(&models.AuditEvent{}).Where("event = ?", audit.AccountLocked).Count(&events)
+	if events != 1 {
+		t.Errorf("Expected 1 %s audit event, got %d", audit.AccountLocked, events)
+	}
+	db.Model(&models.AuditEvent{}).Where("event = ?", audit.LoginFailed).Count(&events)
+	if events != 3 {
+		t.Errorf("Expected 3 %s audit events, got %d", audit.LoginFailed, events)
+	}
+
+	token := outbox.lastToken(t)
+	if rr := postJSON(t, handlers.UnlockAccount, "/account/unlock", map[string]string{"token": token}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on unlock, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := loginFrom(t, "198.51.100.8", "guessed", "password123"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v after unlock, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
+
+func TestLoginBackoffAndPerIPLimit(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.LoginThrottle{}, &models.AuditEvent{})
+	setupLockout(t, db, lockout.Policy{
+		MaxFailures:      100,
+		MaxFailuresPerIP: 3,
+		BackoffAfter:     1,
+		BackoffBase:      time.Hour,
+		BackoffMax:       2 * time.Hour,
+		LockoutDuration:  time.Hour,
+		Window:           time.Hour,
+	})
+
+	// The second failure for a username starts a backoff
+	loginFrom(t, "203.0.113.1", "alice", "wrong")
+	loginFrom(t, "203.0.113.2", "alice", "wrong")
+	rr := loginFrom(t, "203.0.113.3", "alice", "wrong")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected status %v during backoff, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+
+	// One address guessing across many usernames is blocked too
+	loginFrom(t, "203.0.113.9", "bob", "wrong")
+	loginFrom(t, "203.0.113.9", "carol", "wrong")
+	loginFrom(t, "203.0.113.9", "dave", "wrong")
+	if rr := loginFrom(t, "203.0.113.9", "erin", "wrong"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected status %v for a blocked address, got %v", http.StatusTooManyRequests, rr.Code)
+	}
+	if rr := loginFrom(t, "203.0.113.10", "erin", "wrong"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v from another address, got %v", http.StatusUnauthorized, rr.Code)
+	}
+}
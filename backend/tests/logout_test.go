@@ -0,0 +1,173 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/keyring"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/revocation"
+)
+
+var okHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+})
+
+func authedRequest(t *testing.T, handler http.Handler, method, path, token string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatalf("Failed to encode payload: %v", err)
+		}
+	}
+	req, err := http.NewRequest(method, path, &body)
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestLogoutRevokesToken(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+
+	rr := postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "leaving",
+		"password": "password123",
+		"email":    "leaving@example.com",
+	})
+	tokens := decodeTokens(t, rr)
+	protected := middleware.RequireLogin(okHandler)
+
+	if rr := authedRequest(t, protected, "GET", "/tasks", tokens["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v before logout, got %v", http.StatusOK, rr.Code)
+	}
+
+	logout := middleware.RequireLogin(http.HandlerFunc(handlers.Logout))
+	rr = authedRequest(t, logout, "POST", "/logout", tokens["token"], map[string]string{"refresh_token": tokens["refresh_token"]})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on logout, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	if rr := authedRequest(t, protected, "GET", "/tasks", tokens["token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v after logout, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	rr = postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": tokens["refresh_token"]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected refresh token to be revoked on logout, got %v", rr.Code)
+	}
+
+	// A fresh load from the database must still know about the revocation
+	if err := revocation.Init(db, time.Hour); err != nil {
+		t.Fatalf("Failed to reload revocations: %v", err)
+	}
+	if rr := authedRequest(t, protected, "GET", "/tasks", tokens["token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v after reload, got %v", http.StatusUnauthorized, rr.Code)
+	}
+}
+
+func TestLogoutAllRevokesEverySession(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+
+	creds := map[string]string{
+		"username": "everywhere",
+		"password": "password123",
+		"email":    "everywhere@example.com",
+	}
+	first := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))
+	second := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+
+	logoutAll := middleware.RequireLogin(http.HandlerFunc(handlers.LogoutAll))
+	if rr := authedRequest(t, logoutAll, "POST", "/logout-all", first["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on logout-all, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// Tokens carry second-resolution iat, so step past the cutoff second
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	protected := middleware.RequireLogin(okHandler)
+	for _, tokens := range []map[string]string{first, second} {
+		if rr := authedRequest(t, protected, "GET", "/tasks", tokens["token"], nil); rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %v after logout-all, got %v", http.StatusUnauthorized, rr.Code)
+		}
+		rr := postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": tokens["refresh_token"]})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("Expected refresh token to be revoked, got %v", rr.Code)
+		}
+	}
+
+	third := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+	if rr := authedRequest(t, protected, "GET", "/tasks", third["token"], nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected a new login to work after logout-all, got %v", rr.Code)
+	}
+}
+
+func TestLogoutAllOutlivesLegacyTokens(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+	if err := keyring.Init(db, keyring.Options{
+		Algorithm:        keyring.HS256,
+		RotationInterval: time.Hour,
+		MaxTokenTTL:      15 * time.Minute,
+		LegacySecret:     "legacy-secret",
+	}); err != nil {
+		t.Fatalf("Failed to initialize keyring: %v", err)
+	}
+	if ttl := keyring.AcceptedTokenTTL(); ttl != keyring.LegacyTokenTTL {
+		t.Fatalf("Expected legacy tokens to set the accepted lifetime, got %v", ttl)
+	}
+	if err := revocation.Init(db, keyring.AcceptedTokenTTL()); err != nil {
+		t.Fatalf("Failed to initialize revocation store: %v", err)
+	}
+
+	tokens := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "legacy",
+		"password": "password123",
+		"email":    "legacy@example.com",
+	}))
+	var user models.User
+	db.Where("username = ?", "legacy").First(&user)
+
+	// A day-long token without a kid, issued before the server had keys
+	issued := time.Now().Add(-2 * time.Hour)
+	legacy, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":  float64(user.ID),
+		"username": user.Username,
+		"iat":      issued.Unix(),
+		"exp":      issued.Add(keyring.LegacyTokenTTL).Unix(),
+	}).SignedString([]byte("legacy-secret"))
+	if err != nil {
+		t.Fatalf("Failed to sign legacy token: %v", err)
+	}
+	protected := middleware.RequireLogin(okHandler)
+	if rr := authedRequest(t, protected, "GET", "/tasks", legacy, nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the legacy token to be accepted, got %v", rr.Code)
+	}
+
+	logoutAll := middleware.RequireLogin(http.HandlerFunc(handlers.LogoutAll))
+	if rr := authedRequest(t, logoutAll, "POST", "/logout-all", tokens["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on logout-all, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// Long after current access tokens have expired, the cutoff must still
+	// stop the legacy token
+	db.Model(&models.TokenCutoff{}).Where("user_id = ?", user.ID).Update("not_before", time.Now().Add(-time.Hour))
+	if err := revocation.Purge(); err != nil {
+		t.Fatalf("Failed to purge revocations: %v", err)
+	}
+	if rr := authedRequest(t, protected, "GET", "/tasks", legacy, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v for the legacy token after a purge, got %v", http.StatusUnauthorized, rr.Code)
+	}
+}
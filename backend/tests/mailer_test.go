@@ -0,0 +1,135 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/harip/GoTasker/mailer"
+)
+
+// smtpSink is a minimal SMTP server that records the DATA of each message.
+type smtpSink struct {
+	listener net.Listener
+	mu       sync.Mutex
+	messages []string
+	rcpts    []string
+}
+
+func newSMTPSink(t *testing.T) *smtpSink {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	sink := &smtpSink{listener: listener}
+	go sink.serve()
+	t.Cleanup(func() { listener.Close() })
+	return sink
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 sink ready")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			s.mu.Lock()
+			s.rcpts = append(s.rcpts, strings.Trim(strings.TrimSpace(line)[8:], "<>"))
+			s.mu.Unlock()
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "DATA"):
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case strings.HasPrefix(cmd, "QUIT"):
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailer(t *testing.T) {
+	sink := newSMTPSink(t)
+	host, port, _ := net.SplitHostPort(sink.listener.Addr().String())
+
+	m := mailer.NewSMTPMailer(host, port, "", "", "no-reply@example.com")
+	err := m.Send(context.Background(), mailer.Message{
+		To:      []string{"user@example.com"},
+		Subject: "Hello\r\nBcc: victim@example.com",
+		Body:    "Line one\nLine two",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if len(sink.messages) != 1 {
+		t.Fatalf("Expected one message, got %d", len(sink.messages))
+	}
+	if len(sink.rcpts) != 1 || sink.rcpts[0] != "user@example.com" {
+		t.Errorf("Unexpected recipients %v", sink.rcpts)
+	}
+	msg := sink.messages[0]
+	if !strings.Contains(msg, "Line one\r\nLine two") {
+		t.Errorf("Expected CRLF body in message, got %q", msg)
+	}
+	if strings.Contains(msg, "\r\nBcc:") {
+		t.Errorf("Expected header injection to be neutralised, got %q", msg)
+	}
+}
+
+func TestLogMailerWritesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mail.log")
+	m := mailer.NewLogMailer(path, "no-reply@example.com")
+	if err := m.Send(context.Background(), mailer.Message{To: []string{"a@example.com"}, Subject: "Hi", Body: "Body"}); err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read mail log: %v", err)
+	}
+	if !strings.Contains(string(data), "Subject: Hi") || !strings.Contains(string(data), "Body") {
+		t.Errorf("Unexpected mail log contents %q", data)
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/retention"
+)
+
+func meRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Handle("/me", middleware.RequireLogin(http.HandlerFunc(handlers.GetMe))).Methods("GET")
+	r.Handle("/me", middleware.RequireLogin(http.HandlerFunc(handlers.UpdateMe))).Methods("PATCH")
+	r.Handle("/me", middleware.RequireLogin(http.HandlerFunc(handlers.DeleteMe))).Methods("DELETE")
+	r.Handle("/me/password", middleware.RequireLogin(http.HandlerFunc(handlers.ChangePassword))).Methods("POST")
+	return r
+}
+
+func TestUpdateProfile(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.UserToken{}, &models.RefreshToken{})
+	outbox := &recordingMailer{}
+	handlers.SetMailer(outbox)
+	defer handlers.SetMailer(nil)
+	router := meRouter()
+
+	postJSON(t, handlers.Register, "/register", map[string]string{"username": "taken", "password": "password123", "email": "taken@example.com"})
+	token := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "alice",
+		"password": "password123",
+		"email":    "alice@example.com",
+	}))["token"]
+	db.Model(&models.User{}).Where("username = ?", "alice").Update("email_verified_at", time.Now())
+
+	if rr := authedRequest(t, router, "PATCH", "/me", token, map[string]string{"username": "taken"}); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v for a taken username, got %v", http.StatusConflict, rr.Code)
+	}
+	if rr := authedRequest(t, router, "PATCH", "/me", token, map[string]string{"username": "alice2"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v renaming, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	// Changing the email needs the password and a fresh verification
+	if rr := authedRequest(t, router, "PATCH", "/me", token, map[string]string{"email": "new@example.com"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v without current password, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := authedRequest(t, router, "PATCH", "/me", token, map[string]string{"email": "taken@example.com", "current_password": "password123"}); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v for a taken email, got %v", http.StatusConflict, rr.Code)
+	}
+	if rr := authedRequest(t, router, "PATCH", "/me", token, map[string]string{"email": "new@example.com", "current_password": "password123"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v changing email, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var user models.User
+	db.Where("username = ?", "alice2").First(&user)
+	if user.Email != "new@example.com" || user.EmailVerifiedAt != nil {
+		t.Errorf("Expected an unverified new email, got %+v", user)
+	}
+	if rr := postJSON(t, handlers.VerifyEmail, "/email/verify", map[string]string{"token": outbox.lastToken(t)}); rr.Code != http.StatusOK {
+		t.Errorf("Expected the new address to be verifiable, got %v", rr.Code)
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+	router := meRouter()
+
+	creds := map[string]string{"username": "bob", "password": "password123", "email": "bob@example.com"}
+	postJSON(t, handlers.Register, "/register", creds)
+	other := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+	current := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+
+	if rr := authedRequest(t, router, "POST", "/me/password", current["token"], map[string]string{"current_password": "wrong", "new_password": "newpassword456"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v for a wrong current password, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	rr := authedRequest(t, router, "POST", "/me/password", current["token"], map[string]string{"current_password": "password123", "new_password": "newpassword456"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	fresh := decodeTokens(t, rr)
+
+	if rr := authedRequest(t, router, "GET", "/me", other["token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected other sessions to be signed out, got %v", rr.Code)
+	}
+	if rr := postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": other["refresh_token"]}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected other refresh tokens to be revoked, got %v", rr.Code)
+	}
+	if rr := authedRequest(t, router, "GET", "/me", fresh["token"], nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected the returned token to work, got %v", rr.Code)
+	}
+	creds["password"] = "newpassword456"
+	if rr := postJSON(t, handlers.Login, "/login", creds); rr.Code != http.StatusOK {
+		t.Errorf("Expected login with the new password to succeed, got %v", rr.Code)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{})
+	router := meRouter()
+
+	creds := map[string]string{"username": "carol", "password": "password123", "email": "carol@example.com"}
+	token := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))["token"]
+	var user models.User
+	db.Where("username = ?", "carol").First(&user)
+	db.Create(&models.Task{UserID: int(user.ID), Title: "Keep me?", Status: "Pending"})
+
+	if rr := authedRequest(t, router, "DELETE", "/me", token, map[string]string{"password": "wrong"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v for a wrong password, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	if rr := authedRequest(t, router, "DELETE", "/me", token, map[string]string{"password": "password123"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	var tasks int64
+	db.Model(&models.Task{}).Where("user_id = ?", user.ID).Count(&tasks)
+	if tasks != 0 {
+		t.Errorf("Expected the user's tasks to be deleted, found %d", tasks)
+	}
+	if rr := postJSON(t, handlers.Login, "/login", creds); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a deleted user to be unable to log in, got %v", rr.Code)
+	}
+	if rr := postJSON(t, handlers.Register, "/register", creds); rr.Code != http.StatusConflict {
+		t.Errorf("Expected the username to stay reserved during the grace period, got %v", rr.Code)
+	}
+
+	// Within the grace period nothing is erased
+	retention.Init(db, time.Hour)
+	if n, err := retention.PurgeDeletedAccounts(); err != nil || n != 0 {
+		t.Fatalf("Expected no purge within the grace period, got %d, %v", n, err)
+	}
+	retention.Init(db, 0)
+	if n, err := retention.PurgeDeletedAccounts(); err != nil || n != 1 {
+		t.Fatalf("Expected 1 purged account, got %d, %v", n, err)
+	}
+	db.Unscoped().Model(&models.Task{}).Where("user_id = ?", user.ID).Count(&tasks)
+	var users int64
+	db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Count(&users)
+	if tasks != 0 || users != 0 {
+		t.Errorf("Expected rows to be erased, found %d users and %d tasks", users, tasks)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/totp"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vector, truncated to six digits
+	secret := "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	code, err := totp.Code(secret, time.Unix(59, 0))
+	if err != nil {
+		t.Fatalf("Failed to compute code: %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("Expected code 287082, got %s", code)
+	}
+	if step, ok := totp.Validate(secret, code, time.Unix(59+30, 0), 1); !ok || step != 1 {
+		t.Errorf("Expected code to validate within skew at step 1, got step=%d ok=%v", step, ok)
+	}
+	if _, ok := totp.Validate(secret, code, time.Unix(59+90, 0), 1); ok {
+		t.Error("Expected code outside the skew window to be rejected")
+	}
+}
+
+func TestTOTPLoginFlow(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.TokenCutoff{}, &models.RecoveryCode{})
+
+	creds := map[string]string{
+		"username": "twofactor",
+		"password": "password123",
+		"email":    "twofactor@example.com",
+	}
+	tokens := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))
+
+	rr := authedRequest(t, middleware.RequireLogin(http.HandlerFunc(handlers.EnrollTOTP)), "POST", "/mfa/totp/enroll", tokens["token"], nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on enroll, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var enrollment map[string]string
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+	secret := enrollment["secret"]
+	if !strings.HasPrefix(enrollment["otpauth_uri"], "otpauth://totp/") {
+		t.Errorf("Unexpected provisioning URI %q", enrollment["otpauth_uri"])
+	}
+
+	now := time.Now()
+	code, _ := totp.CodeAt(secret, totp.Step(now))
+	rr = authedRequest(t, middleware.RequireLogin(http.HandlerFunc(handlers.ConfirmTOTP)), "POST", "/mfa/totp/confirm", tokens["token"], map[string]string{"code": code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on confirm, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var confirmation struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&confirmation)
+	if len(confirmation.RecoveryCodes) != 10 {
+		t.Fatalf("Expected 10 recovery codes, got %d", len(confirmation.RecoveryCodes))
+	}
+
+	// The password alone now yields only a pending token
+	login := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+	if login["mfa_required"] != "true" || login["token"] != "" {
+		t.Fatalf("Expected an MFA challenge instead of tokens, got %v", login)
+	}
+	if rr := authedRequest(t, middleware.RequireLogin(okHandler), "GET", "/tasks", login["mfa_token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the pending MFA token to be refused as an access token, got %v", rr.Code)
+	}
+
+	// The code used to confirm enrollment cannot be replayed
+	if rr := postJSON(t, handlers.LoginMFA, "/login/mfa", map[string]string{"mfa_token": login["mfa_token"], "code": code}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed code to be rejected, got %v", rr.Code)
+	}
+	next, _ := totp.CodeAt(secret, totp.Step(now)+1)
+	rr = postJSON(t, handlers.LoginMFA, "/login/mfa", map[string]string{"mfa_token": login["mfa_token"], "code": next})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on MFA login, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if decodeTokens(t, rr)["token"] == "" {
+		t.Error("Expected an access token after MFA login")
+	}
+	// Pending tokens are single-use
+	if rr := postJSON(t, handlers.LoginMFA, "/login/mfa", map[string]string{"mfa_token": login["mfa_token"], "recovery_code": confirmation.RecoveryCodes[0]}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used MFA token to be rejected, got %v", rr.Code)
+	}
+
+	// Recovery codes work once each
+	login = decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+	if rr := postJSON(t, handlers.LoginMFA, "/login/mfa", map[string]string{"mfa_token": login["mfa_token"], "recovery_code": strings.ToUpper(confirmation.RecoveryCodes[0])}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v with a recovery code, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	login = decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+	if rr := postJSON(t, handlers.LoginMFA, "/login/mfa", map[string]string{"mfa_token": login["mfa_token"], "recovery_code": confirmation.RecoveryCodes[0]}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", rr.Code)
+	}
+}
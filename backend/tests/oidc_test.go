@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/harip/GoTasker/config"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/oidc"
+)
+
+// mockIdP is a minimal OpenID provider that signs ID tokens for whichever
+// user the test has chosen to "sign in".
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	mu            sync.Mutex
+	subject       string
+	email         string
+	emailVerified bool
+	grants        map[string]url.Values
+}
+
+func newMockIdP(t *testing.T, clientID string) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	idp := &mockIdP{key: key, clientID: clientID, grants: make(map[string]url.Values)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                idp.server.URL,
+			"authorization_endpoint":                idp.server.URL + "/authorize",
+			"token_endpoint":                        idp.server.URL + "/token",
+			"jwks_uri":                              idp.server.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock-1",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	// The user approves immediately
+	mux.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		idp.mu.Lock()
+		code := "code-" + q.Get("state")
+		idp.grants[code] = q
+		idp.mu.Unlock()
+		http.Redirect(w, r, q.Get("redirect_uri")+"?code="+url.QueryEscape(code)+"&state="+url.QueryEscape(q.Get("state")), http.StatusFound)
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		idp.mu.Lock()
+		grant, ok := idp.grants[r.PostForm.Get("code")]
+		delete(idp.grants, r.PostForm.Get("code"))
+		subject, email, verified := idp.subject, idp.email, idp.emailVerified
+		idp.mu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.server.URL,
+			"sub":            subject,
+			"aud":            idp.clientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Minute).Unix(),
+			"nonce":          grant.Get("nonce"),
+			"email":          email,
+			"email_verified": verified,
+		})
+		token.Header["kid"] = "mock-1"
+		signed, _ := token.SignedString(key)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "at", "token_type": "Bearer", "id_token": signed})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) signInAs(subject, email string, verified bool) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.subject, idp.email, idp.emailVerified = subject, email, verified
+}
+
+// oidcLogin runs the browser side of the flow and returns the fragment the
+// app was redirected to.
+func oidcLogin(t *testing.T) url.Values {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handlers.OIDCLogin(rr, httptest.NewRequest("GET", "/auth/oidc/login", nil))
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to provider, got %v: %s", rr.Code, rr.Body.String())
+	}
+	cookies := rr.Result().Cookies()
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(rr.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("Authorize request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	req := httptest.NewRequest("GET", resp.Header.Get("Location"), nil)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	rr = httptest.NewRecorder()
+	handlers.OIDCCallback(rr, req)
+	if rr.Code != http.StatusFound {
+		t.Fatalf("Expected redirect to app, got %v: %s", rr.Code, rr.Body.String())
+	}
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	fragment, _ := url.ParseQuery(location.Fragment)
+	return fragment
+}
+
+func TestOIDCLogin(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.UserIdentity{}, &models.RefreshToken{})
+	idp := newMockIdP(t, "gotasker")
+	handlers.SetOIDCProvider(oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "gotasker",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+	}))
+	defer handlers.SetOIDCProvider(nil)
+	config.AppConfig.OIDCAutoProvision = true
+
+	// First sign-in provisions a user
+	idp.signInAs("sub-1", "Jane.Doe@example.com", true)
+	result := oidcLogin(t)
+	if result.Get("token") == "" {
+		t.Fatalf("Expected tokens after OIDC login, got %v", result)
+	}
+	var user models.User
+	if err := db.Where("email = ?", "Jane.Doe@example.com").First(&user).Error; err != nil {
+		t.Fatalf("Expected a provisioned user: %v", err)
+	}
+	if user.Username != "Jane.Doe" || user.EmailVerifiedAt == nil {
+		t.Errorf("Unexpected provisioned user %+v", user)
+	}
+
+	// The same subject signs in to the same user even if the email changes
+	idp.signInAs("sub-1", "jane@example.com", true)
+	oidcLogin(t)
+	var count int64
+	db.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected 1 user after second login, got %d", count)
+	}
+
+	// An existing password account is linked by verified email
+	postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "bob",
+		"password": "password123",
+		"email":    "bob@example.com",
+	})
+	idp.signInAs("sub-2", "BOB@example.com", true)
+	if oidcLogin(t).Get("token") == "" {
+		t.Fatal("Expected tokens when linking an existing user")
+	}
+	var identity models.UserIdentity
+	db.Where("subject = ?", "sub-2").First(&identity)
+	var bob models.User
+	db.Where("username = ?", "bob").First(&bob)
+	if identity.UserID != bob.ID {
+		t.Errorf("Expected identity linked to user %d, got %d", bob.ID, identity.UserID)
+	}
+
+	// Unverified emails are never linked or provisioned
+	idp.signInAs("sub-3", "mallory@example.com", false)
+	if got := oidcLogin(t).Get("error"); got != "email_not_verified" {
+		t.Errorf("Expected email_not_verified error, got %q", got)
+	}
+}
+
+func TestOIDCCallbackRejectsForgedState(t *testing.T) {
+	setupAuthTestDB()
+	idp := newMockIdP(t, "gotasker")
+	handlers.SetOIDCProvider(oidc.NewProvider(oidc.Config{
+		IssuerURL:   idp.server.URL,
+		ClientID:    "gotasker",
+		RedirectURL: "http://localhost:8080/auth/oidc/callback",
+	}))
+	defer handlers.SetOIDCProvider(nil)
+
+	rr := httptest.NewRecorder()
+	handlers.OIDCCallback(rr, httptest.NewRequest("GET", "/auth/oidc/callback?code=abc&state=forged", nil))
+	location, _ := url.Parse(rr.Header().Get("Location"))
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if fragment.Get("error") != "invalid_state" {
+		t.Errorf("Expected invalid_state error, got %q", location.Fragment)
+	}
+}
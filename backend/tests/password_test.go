@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/harip/GoTasker/password"
+)
+
+func TestPasswordHashAndVerify(t *testing.T) {
+	for _, algo := range []string{password.Argon2id, password.Bcrypt} {
+		params := password.DefaultParams()
+		params.Algorithm = algo
+		params.BcryptCost = 4
+
+		hash, err := password.HashWithParams("correct horse", params)
+		if err != nil {
+			t.Fatalf("%s: failed to hash: %v", algo, err)
+		}
+		if strings.Contains(hash, "correct horse") {
+			t.Errorf("%s: hash contains the plaintext", algo)
+		}
+		if ok, err := password.Verify("correct horse", hash); err != nil || !ok {
+			t.Errorf("%s: expected password to verify, got ok=%v err=%v", algo, ok, err)
+		}
+		if ok, _ := password.Verify("battery staple", hash); ok {
+			t.Errorf("%s: expected wrong password to fail", algo)
+		}
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	if !password.NeedsRehash("plaintext") {
+		t.Error("Expected plaintext to need rehash")
+	}
+	if ok, _ := password.Verify("plaintext", "plaintext"); !ok {
+		t.Error("Expected legacy plaintext to verify")
+	}
+
+	weak := password.DefaultParams()
+	weak.Iterations = 1
+	hash, err := password.HashWithParams("secret", weak)
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	if !password.NeedsRehash(hash) {
+		t.Error("Expected hash with fewer iterations to need rehash")
+	}
+
+	bcryptParams := password.DefaultParams()
+	bcryptParams.Algorithm = password.Bcrypt
+	bcryptParams.BcryptCost = 4
+	hash, err = password.HashWithParams("secret", bcryptParams)
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	if !password.NeedsRehash(hash) {
+		t.Error("Expected bcrypt hash to need rehash when argon2id is the default")
+	}
+
+	current, err := password.Hash("secret")
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	if password.NeedsRehash(current) {
+		t.Error("Expected hash with default parameters not to need rehash")
+	}
+}
@@ -0,0 +1,234 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/recurrence"
+)
+
+func TestParseRecurrence(t *testing.T) {
+	for _, s := range []string{"", "INTERVAL=2", "FREQ=HOURLY", "FREQ=DAILY;COUNT=0", "FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=WEEKLY;BYDAY=2MO", "FREQ=DAILY;COUNT=3;UNTIL=20300101", "FREQ=DAILY;FREQ=WEEKLY", "FREQ=DAILY;BYSETPOS=1"} {
+		if _, err := recurrence.Parse(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+
+	rule, err := recurrence.Parse("RRULE:freq=monthly;byday=-1fr;interval=1")
+	if err != nil {
+		t.Fatalf("Expected rule to parse, got %v", err)
+	}
+	if got := rule.String(); got != "FREQ=MONTHLY;BYDAY=-1FR" {
+		t.Errorf("Expected normalized rule FREQ=MONTHLY;BYDAY=-1FR, got %s", got)
+	}
+}
+
+func TestRecurrenceOccurrences(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("Failed to load time zone: %v", err)
+	}
+	dates := func(times []time.Time) []string {
+		out := make([]string, len(times))
+		for i, tm := range times {
+			out[i] = tm.Format("2006-01-02 15:04")
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		rule  string
+		start time.Time
+		loc   *time.Location
+		want  []string
+		ends  bool
+	}{
+		{
+			name:  "weekly on two days",
+			rule:  "FREQ=WEEKLY;BYDAY=MO,WE",
+			start: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), // Monday
+			loc:   time.UTC,
+			want:  []string{"2024-01-03 10:00", "2024-01-08 10:00", "2024-01-10 10:00", "2024-01-15 10:00"},
+		},
+		{
+			name:  "last Friday of the month",
+			rule:  "FREQ=MONTHLY;BYDAY=-1FR",
+			start: time.Date(2024, 1, 26, 9, 0, 0, 0, time.UTC),
+			loc:   time.UTC,
+			want:  []string{"2024-02-23 09:00", "2024-03-29 09:00", "2024-04-26 09:00"},
+		},
+		{
+			name:  "31st skips short months",
+			rule:  "FREQ=MONTHLY;BYMONTHDAY=31",
+			start: time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC),
+			loc:   time.UTC,
+			want:  []string{"2024-03-31 09:00", "2024-05-31 09:00", "2024-07-31 09:00"},
+		},
+		{
+			name:  "count includes the start",
+			rule:  "FREQ=DAILY;COUNT=3",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			loc:   time.UTC,
+			want:  []string{"2024-01-02 09:00", "2024-01-03 09:00"},
+			ends:  true,
+		},
+		{
+			name:  "until is inclusive",
+			rule:  "FREQ=WEEKLY;INTERVAL=2;UNTIL=20240129",
+			start: time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			loc:   time.UTC,
+			want:  []string{"2024-01-15 09:00", "2024-01-29 09:00"},
+			ends:  true,
+		},
+		{
+			name:  "wall clock kept across daylight saving",
+			rule:  "FREQ=DAILY",
+			start: time.Date(2024, 3, 9, 9, 0, 0, 0, newYork),
+			loc:   newYork,
+			want:  []string{"2024-03-10 09:00", "2024-03-11 09:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		rule, err := recurrence.Parse(tt.rule)
+		if err != nil {
+			t.Fatalf("%s: failed to parse rule: %v", tt.name, err)
+		}
+		n := len(tt.want)
+		if tt.ends {
+			n++
+		}
+		got := dates(rule.Between(tt.start, tt.start, tt.loc, n))
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	// Across the change the UTC offset moves while 09:00 local stays put
+	rule, _ := recurrence.Parse("FREQ=DAILY")
+	start := time.Date(2024, 3, 9, 9, 0, 0, 0, newYork)
+	next, ok := rule.Next(start, start.Add(24*time.Hour), newYork)
+	if !ok || next.UTC().Hour() != 13 {
+		t.Errorf("Expected the occurrence after the change at 13:00 UTC, got %v", next.UTC())
+	}
+}
+
+func recurrenceRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tasks", handlers.CreateTask).Methods("POST")
+	r.HandleFunc("/tasks/{id}", handlers.UpdateTask).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/occurrences", handlers.GetOccurrences).Methods("GET")
+	return r
+}
+
+func TestRecurringTaskCompletion(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.User{})
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags", &models.User{})
+	router := recurrenceRouter()
+
+	db.Create(&models.User{ID: 1, Username: "alice", Email: "alice@example.com", Timezone: "America/New_York"})
+
+	newYork, _ := time.LoadLocation("America/New_York")
+	due := time.Date(2024, 3, 8, 9, 0, 0, 0, newYork) // Friday
+	create := map[string]interface{}{"title": "Standup", "due_date": due, "recurrence": "RRULE:FREQ=WEEKLY;BYDAY=MO,FR"}
+	rr := userRequest(router, 1, "POST", "/tasks", create)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var task models.Task
+	json.Unmarshal(rr.Body.Bytes(), &task)
+	if task.Recurrence != "FREQ=WEEKLY;BYDAY=MO,FR" {
+		t.Errorf("Expected normalized recurrence, got %q", task.Recurrence)
+	}
+
+	if rr := userRequest(router, 1, "POST", "/tasks", map[string]interface{}{"title": "No date", "recurrence": "FREQ=DAILY"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for a recurring task without a due date, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	rr = userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d/occurrences?count=2", task.ID), nil)
+	var preview struct {
+		Occurrences []time.Time `json:"occurrences"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &preview)
+	if len(preview.Occurrences) != 2 || preview.Occurrences[0].Weekday() != time.Monday || preview.Occurrences[0].Hour() != 9 {
+		t.Errorf("Expected two occurrences starting Monday 09:00 local, got %v", preview.Occurrences)
+	}
+
+	// Completing moves the rule on to a new instance due the next Monday,
+	// still at 09:00 New York time after the clocks change
+	complete := map[string]interface{}{"title": "Standup", "status": "Completed", "due_date": due}
+	rr = userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", task.ID), complete)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var completed models.Task
+	json.Unmarshal(rr.Body.Bytes(), &completed)
+	if completed.Recurrence != "" || completed.NextOccurrence == nil {
+		t.Fatalf("Expected the rule to move to a next occurrence, got %+v", completed)
+	}
+	next := *completed.NextOccurrence
+	if want := time.Date(2024, 3, 11, 9, 0, 0, 0, newYork); !next.DueDate.Equal(want) {
+		t.Errorf("Expected next occurrence due %v, got %v", want, next.DueDate)
+	}
+	if next.Status != "Pending" || next.Recurrence != task.Recurrence {
+		t.Errorf("Expected a pending instance carrying the rule, got %+v", next)
+	}
+
+	// Stopping the series completes the instance without a successor
+	complete["due_date"] = next.DueDate
+	rr = userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d?recurrence=stop", next.ID), complete)
+	var stopped models.Task
+	json.Unmarshal(rr.Body.Bytes(), &stopped)
+	if rr.Code != http.StatusOK || stopped.NextOccurrence != nil || stopped.Recurrence != "" {
+		t.Errorf("Expected the series to stop, got %v: %s", rr.Code, rr.Body.String())
+	}
+	var count int64
+	db.Model(&models.Task{}).Where("user_id = ?", 1).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 tasks, got %d", count)
+	}
+
+	// A recurring subtask completed by its parent's cascade moves its rule
+	// and reminders on just as if it had been completed itself
+	rr = userRequest(router, 1, "POST", "/tasks", map[string]interface{}{"title": "Sprint"})
+	var sprint models.Task
+	json.Unmarshal(rr.Body.Bytes(), &sprint)
+	rr = userRequest(router, 1, "POST", "/tasks", map[string]interface{}{
+		"title": "Retro", "parent_id": sprint.ID, "due_date": due, "recurrence": "FREQ=WEEKLY;BYDAY=FR",
+	})
+	var retro models.Task
+	json.Unmarshal(rr.Body.Bytes(), &retro)
+	offset := 30
+	db.Create(&models.Reminder{UserID: 1, TaskID: retro.ID, OffsetMinutes: &offset, Status: models.ReminderPending})
+
+	rr = userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d?subtasks=cascade", sprint.ID), map[string]interface{}{"title": "Sprint", "status": "Completed"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	db.First(&retro, retro.ID)
+	if retro.StatusCategory != models.CategoryDone || retro.Recurrence != "" {
+		t.Errorf("Expected the subtask to be completed with its rule moved on, got %+v", retro)
+	}
+	var nextRetro models.Task
+	if err := db.Where("title = ? AND id <> ?", "Retro", retro.ID).First(&nextRetro).Error; err != nil {
+		t.Fatalf("Expected a next occurrence of the subtask: %v", err)
+	}
+	if want := time.Date(2024, 3, 15, 9, 0, 0, 0, newYork); nextRetro.Status != "Pending" || nextRetro.Recurrence != "FREQ=WEEKLY;BYDAY=FR" ||
+		nextRetro.ParentID == nil || *nextRetro.ParentID != sprint.ID || !nextRetro.DueDate.Equal(want) {
+		t.Errorf("Expected a pending instance under Sprint due %v carrying the rule, got %+v", want, nextRetro)
+	}
+	var copied int64
+	db.Model(&models.Reminder{}).Where("task_id = ? AND offset_minutes = ?", nextRetro.ID, offset).Count(&copied)
+	if copied != 1 {
+		t.Errorf("Expected the subtask's reminder to be copied to its next occurrence, got %d", copied)
+	}
+}
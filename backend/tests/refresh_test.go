@@ -0,0 +1,80 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+)
+
+func postJSON(t *testing.T, handler http.HandlerFunc, path string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	body, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("Failed to marshal payload: %v", err)
+	}
+	req, err := http.NewRequest("POST", path, bytes.NewBuffer(body))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func decodeTokens(t *testing.T, rr *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+	var response map[string]string
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to unmarshal response %q: %v", rr.Body.String(), err)
+	}
+	return response
+}
+
+func TestRefreshTokenRotationAndReuse(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.RefreshToken{})
+
+	rr := postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "refresher",
+		"password": "password123",
+		"email":    "refresher@example.com",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	first := decodeTokens(t, rr)
+	if first["refresh_token"] == "" {
+		t.Fatal("Expected a refresh token on register")
+	}
+
+	rr = postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": first["refresh_token"]})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on refresh, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	second := decodeTokens(t, rr)
+	if second["token"] == "" || second["refresh_token"] == "" || second["refresh_token"] == first["refresh_token"] {
+		t.Fatalf("Expected a rotated token pair, got %v", second)
+	}
+
+	// Replaying the first token must fail and revoke the whole family
+	rr = postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": first["refresh_token"]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v on reuse, got %v", http.StatusUnauthorized, rr.Code)
+	}
+	rr = postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": second["refresh_token"]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %v for a token in a revoked family, got %v", http.StatusUnauthorized, rr.Code)
+	}
+
+	var active int64
+	db.Model(&models.RefreshToken{}).Where("revoked_at IS NULL").Count(&active)
+	if active != 0 {
+		t.Errorf("Expected every token in the family to be revoked, %d still active", active)
+	}
+}
@@ -0,0 +1,262 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/notify"
+	"github.com/harip/GoTasker/reminders"
+)
+
+// recordingNotifier keeps what it was asked to send, failing if err is set
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent []notify.Message
+	err  error
+}
+
+func (n *recordingNotifier) Notify(ctx context.Context, msg notify.Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.err != nil {
+		return n.err
+	}
+	n.sent = append(n.sent, msg)
+	return nil
+}
+
+func remindersRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tasks/{id}", handlers.UpdateTask).Methods("PUT")
+	r.HandleFunc("/tasks/{id}/reminders", handlers.GetReminders).Methods("GET")
+	r.HandleFunc("/tasks/{id}/reminders", handlers.CreateReminder).Methods("POST")
+	r.HandleFunc("/tasks/{id}/reminders/{reminder_id}", handlers.DeleteReminder).Methods("DELETE")
+	r.HandleFunc("/me/notifications", handlers.GetNotifications).Methods("GET")
+	r.HandleFunc("/me/notifications/read", handlers.MarkNotificationRead).Methods("POST")
+	return r
+}
+
+func TestTaskReminders(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.User{}, &models.Notification{})
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags", &models.Reminder{}, &models.Notification{}, &models.User{})
+	router := remindersRouter()
+
+	db.Create(&models.User{ID: 1, Username: "alice", Email: "alice@example.com"})
+	due := time.Now().Add(48 * time.Hour).Truncate(time.Second)
+	task := models.Task{Title: "Report", Status: "Pending", DueDate: &due, UserID: 1}
+	db.Create(&task)
+	undated := models.Task{Title: "Someday", Status: "Pending", UserID: 1}
+	db.Create(&undated)
+
+	path := fmt.Sprintf("/tasks/%d/reminders", task.ID)
+	rr := userRequest(router, 1, "POST", path, map[string]interface{}{"offset_minutes": 30})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var reminder models.Reminder
+	json.Unmarshal(rr.Body.Bytes(), &reminder)
+	if reminder.Channel != models.ReminderInbox || !reminder.FireAt.Equal(due.Add(-30*time.Minute)) {
+		t.Errorf("Expected an inbox reminder 30 minutes before the due date, got %+v", reminder)
+	}
+
+	for name, payload := range map[string]interface{}{
+		"both kinds":      map[string]interface{}{"offset_minutes": 5, "remind_at": due},
+		"neither kind":    map[string]interface{}{"channel": "email"},
+		"past time":       map[string]interface{}{"remind_at": time.Now().Add(-time.Hour)},
+		"unknown channel": map[string]interface{}{"offset_minutes": 5, "channel": "sms"},
+		"no webhook url":  map[string]interface{}{"offset_minutes": 5, "channel": "webhook"},
+	} {
+		if rr := userRequest(router, 1, "POST", path, payload); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status %v, got %v", name, http.StatusBadRequest, rr.Code)
+		}
+	}
+	if rr := userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/reminders", undated.ID), map[string]int{"offset_minutes": 5}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for an offset on a task without a due date, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if rr := userRequest(router, 2, "POST", path, map[string]int{"offset_minutes": 5}); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v for another user's task, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	// Offset reminders follow the due date when it moves
+	moved := due.Add(24 * time.Hour)
+	userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", task.ID), map[string]interface{}{"title": "Report", "due_date": moved})
+	db.First(&reminder, reminder.ID)
+	if !reminder.FireAt.Equal(moved.Add(-30 * time.Minute)) {
+		t.Errorf("Expected the reminder to move to %v, got %v", moved.Add(-30*time.Minute), reminder.FireAt)
+	}
+
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("%s/%d", path, reminder.ID), nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v, got %v", http.StatusOK, rr.Code)
+	}
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("%s/%d", path, reminder.ID), nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v deleting twice, got %v", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestReminderScheduler(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.User{}, &models.Notification{})
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags", &models.Reminder{}, &models.Notification{}, &models.User{})
+	router := remindersRouter()
+
+	email := &recordingNotifier{err: errors.New("smtp unavailable")}
+	reminders.Init(db, map[string]notify.Notifier{
+		models.ReminderInbox: notify.NewInboxNotifier(db),
+		models.ReminderEmail: email,
+	})
+	defer reminders.Init(nil, nil)
+
+	db.Create(&models.User{ID: 1, Username: "alice", Email: "alice@example.com"})
+	newTask := func(title, status, category string) models.Task {
+		task := models.Task{Title: title, Status: status, StatusCategory: category, UserID: 1}
+		db.Create(&task)
+		return task
+	}
+	newReminder := func(task models.Task, channel string, fireIn time.Duration) models.Reminder {
+		at := time.Now().Add(fireIn)
+		reminder := models.Reminder{UserID: 1, TaskID: task.ID, Channel: channel, RemindAt: &at, FireAt: &at, Status: models.ReminderPending}
+		db.Create(&reminder)
+		return reminder
+	}
+
+	// Three reminders missed while the scheduler was down go out once
+	missed := newTask("Missed", "Pending", models.CategoryTodo)
+	var missedReminders []models.Reminder
+	for _, ago := range []time.Duration{3 * time.Hour, 2 * time.Hour, time.Hour} {
+		missedReminders = append(missedReminders, newReminder(missed, models.ReminderInbox, -ago))
+	}
+	done := newReminder(newTask("Done", "Completed", models.CategoryDone), models.ReminderInbox, -time.Minute)
+	later := newReminder(newTask("Later", "Pending", models.CategoryTodo), models.ReminderInbox, time.Hour)
+	failing := newReminder(newTask("Mailed", "Pending", models.CategoryTodo), models.ReminderEmail, -time.Minute)
+
+	sent, err := reminders.Run(context.Background())
+	if err != nil || sent != 1 {
+		t.Fatalf("Expected 1 reminder sent, got %d (%v)", sent, err)
+	}
+	status := func(reminder models.Reminder) string {
+		db.First(&reminder, reminder.ID)
+		return reminder.Status
+	}
+	for i, reminder := range missedReminders {
+		want := models.ReminderSkipped
+		if i == len(missedReminders)-1 {
+			want = models.ReminderSent
+		}
+		if got := status(reminder); got != want {
+			t.Errorf("Expected missed reminder %d to be %s, got %s", i, want, got)
+		}
+	}
+	if got := status(done); got != models.ReminderSkipped {
+		t.Errorf("Expected the completed task's reminder to be skipped, got %s", got)
+	}
+	if got := status(later); got != models.ReminderPending {
+		t.Errorf("Expected the future reminder to stay pending, got %s", got)
+	}
+	db.First(&failing, failing.ID)
+	if failing.Status != models.ReminderPending || failing.Attempts != 1 || failing.ClaimedUntil == nil {
+		t.Errorf("Expected the failed delivery to be held for a retry, got %+v", failing)
+	}
+
+	// A second run finds nothing new, and the held reminder is not retried early
+	if sent, err := reminders.Run(context.Background()); err != nil || sent != 0 {
+		t.Errorf("Expected nothing sent on the second run, got %d (%v)", sent, err)
+	}
+	db.First(&failing, failing.ID)
+	if failing.Attempts != 1 {
+		t.Errorf("Expected no retry before the claim runs out, got %d attempts", failing.Attempts)
+	}
+
+	rr := userRequest(router, 1, "GET", "/me/notifications", nil)
+	var inbox struct {
+		Notifications []models.Notification `json:"notifications"`
+		Unread        int                   `json:"unread"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &inbox)
+	if inbox.Unread != 1 || len(inbox.Notifications) != 1 || inbox.Notifications[0].Title != "Reminder: Missed" {
+		t.Fatalf("Expected one unread reminder in the inbox, got %s", rr.Body.String())
+	}
+	userRequest(router, 1, "POST", "/me/notifications/read", nil)
+	rr = userRequest(router, 1, "GET", "/me/notifications?unread=true", nil)
+	json.Unmarshal(rr.Body.Bytes(), &inbox)
+	if inbox.Unread != 0 || len(inbox.Notifications) != 0 {
+		t.Errorf("Expected the inbox to be read, got %s", rr.Body.String())
+	}
+}
+
+func TestReminderLongTaskTitle(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&models.User{}, &models.Notification{})
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, "task_tags", &models.Reminder{}, &models.Notification{}, &models.User{})
+
+	reminders.Init(db, map[string]notify.Notifier{models.ReminderInbox: notify.NewInboxNotifier(db)})
+	defer reminders.Init(nil, nil)
+
+	db.Create(&models.User{ID: 1, Username: "alice", Email: "alice@example.com"})
+	task := models.Task{Title: strings.Repeat("é", 255), Status: "Pending", UserID: 1}
+	db.Create(&task)
+	at := time.Now().Add(-time.Minute)
+	db.Create(&models.Reminder{UserID: 1, TaskID: task.ID, Channel: models.ReminderInbox, RemindAt: &at, FireAt: &at, Status: models.ReminderPending})
+
+	if sent, err := reminders.Run(context.Background()); err != nil || sent != 1 {
+		t.Fatalf("Expected 1 reminder sent, got %d (%v)", sent, err)
+	}
+	var notification models.Notification
+	db.First(&notification)
+	if n := utf8.RuneCountInString(notification.Title); n > notify.MaxTitleLength {
+		t.Errorf("Expected the title to fit in %d characters, got %d", notify.MaxTitleLength, n)
+	}
+	if !strings.HasPrefix(notification.Title, "Reminder: éé") || !strings.HasSuffix(notification.Title, "…") {
+		t.Errorf("Expected a shortened reminder title, got %q", notification.Title)
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var body []byte
+	var signature, timestamp string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get("X-GoTasker-Signature")
+		timestamp = r.Header.Get("X-GoTasker-Timestamp")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	taskID := 7
+	msg := notify.Message{
+		User:   models.User{ID: 1, WebhookURL: server.URL + "/hook"},
+		Kind:   notify.KindReminder,
+		Title:  "Reminder: Report",
+		TaskID: &taskID,
+		SentAt: time.Now(),
+	}
+	if err := notify.NewWebhookNotifier("s3cret", true).Notify(context.Background(), msg); err != nil {
+		t.Fatalf("Expected the webhook to be delivered, got %v", err)
+	}
+	if want := "sha256=" + notify.Sign("s3cret", timestamp, body); signature != want {
+		t.Errorf("Expected signature %s, got %s", want, signature)
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(body, &payload)
+	if payload["title"] != "Reminder: Report" || payload["task_id"] != float64(7) {
+		t.Errorf("Unexpected payload %s", body)
+	}
+
+	// User-chosen URLs may not reach internal services
+	if err := notify.NewWebhookNotifier("s3cret", false).Notify(context.Background(), msg); !errors.Is(err, notify.ErrPrivateAddress) {
+		t.Errorf("Expected a loopback webhook to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/middleware"
+	"github.com/harip/GoTasker/models"
+)
+
+// cookieRequest sends a request authenticated only by cookies, with an
+// optional CSRF header
+func cookieRequest(t *testing.T, handler http.Handler, method, path string, cookies []*http.Cookie, csrf string, payload interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+	req := httptest.NewRequest(method, path, &body)
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	if csrf != "" {
+		req.Header.Set(middleware.CSRFHeaderName, csrf)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCookieSessionLogin(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.Session{})
+
+	r := mux.NewRouter()
+	r.Handle("/me", middleware.RequireLogin(http.HandlerFunc(handlers.GetMe))).Methods("GET")
+	r.Handle("/session/csrf", middleware.RequireLogin(http.HandlerFunc(handlers.GetCSRFToken))).Methods("GET")
+	r.Handle("/logout", middleware.RequireLogin(http.HandlerFunc(handlers.Logout))).Methods("POST")
+	r.Handle("/tasks", middleware.RequireScope(models.ScopeTasksWrite)(http.HandlerFunc(handlers.CreateTask))).Methods("POST")
+	router := middleware.CSRF(r)
+
+	creds := map[string]string{"username": "browser", "password": "password123", "email": "browser@example.com"}
+	bearer := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))["token"]
+
+	creds["session"] = "cookie"
+	rr := postJSON(t, handlers.Login, "/login", creds)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var login map[string]string
+	json.NewDecoder(rr.Body).Decode(&login)
+	if login["token"] != "" || login["csrf_token"] == "" {
+		t.Errorf("Expected a CSRF token and no bearer token, got %v", login)
+	}
+	cookies := rr.Result().Cookies()
+	var session *http.Cookie
+	for _, c := range cookies {
+		if c.Name == middleware.SessionCookieName {
+			session = c
+		}
+	}
+	if session == nil || !session.HttpOnly || session.SameSite != http.SameSiteLaxMode {
+		t.Fatalf("Expected an HttpOnly SameSite=Lax session cookie, got %+v", session)
+	}
+
+	if rr := cookieRequest(t, router, "GET", "/me", cookies, "", nil); rr.Code != http.StatusOK {
+		t.Errorf("Expected the session cookie to authenticate, got %v", rr.Code)
+	}
+	rr = cookieRequest(t, router, "GET", "/session/csrf", cookies, "", nil)
+	var csrf map[string]string
+	json.NewDecoder(rr.Body).Decode(&csrf)
+	if csrf["csrf_token"] != login["csrf_token"] {
+		t.Errorf("Expected /session/csrf to return the login CSRF token, got %v", csrf)
+	}
+
+	// State-changing requests need the CSRF header
+	task := map[string]string{"title": "From the browser"}
+	if rr := cookieRequest(t, router, "POST", "/tasks", cookies, "", task); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v without a CSRF token, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := cookieRequest(t, router, "POST", "/tasks", cookies, "forged", task); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status %v with a wrong CSRF token, got %v", http.StatusForbidden, rr.Code)
+	}
+	if rr := cookieRequest(t, router, "POST", "/tasks", cookies, login["csrf_token"], task); rr.Code != http.StatusCreated {
+		t.Errorf("Expected status %v with the CSRF token, got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	// Bearer tokens are not sent automatically, so they need no CSRF token
+	if rr := authedRequest(t, router, "POST", "/tasks", bearer, task); rr.Code != http.StatusCreated {
+		t.Errorf("Expected bearer requests to skip the CSRF check, got %v", rr.Code)
+	}
+
+	rr = cookieRequest(t, router, "POST", "/logout", cookies, login["csrf_token"], nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v on logout, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	for _, c := range rr.Result().Cookies() {
+		if c.MaxAge >= 0 {
+			t.Errorf("Expected cookie %s to be cleared, got %+v", c.Name, c)
+		}
+	}
+	if rr := cookieRequest(t, router, "GET", "/me", cookies, "", nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the session to be revoked after logout, got %v", rr.Code)
+	}
+}
+
+func TestListAndRevokeSessions(t *testing.T) {
+	db := setupAuthTestDB()
+	defer db.Migrator().DropTable(&models.User{}, &models.Task{}, &models.RefreshToken{}, &models.Session{})
+
+	r := mux.NewRouter()
+	r.Handle("/me/sessions", middleware.RequireLogin(http.HandlerFunc(handlers.GetSessions))).Methods("GET")
+	r.Handle("/me/sessions/{id}", middleware.RequireLogin(http.HandlerFunc(handlers.RevokeSession))).Methods("DELETE")
+
+	creds := map[string]string{"username": "traveller", "password": "password123", "email": "traveller@example.com"}
+	laptop := decodeTokens(t, postJSON(t, handlers.Register, "/register", creds))
+	phone := decodeTokens(t, postJSON(t, handlers.Login, "/login", creds))
+
+	listSessions := func(token string) []map[string]interface{} {
+		t.Helper()
+		rr := authedRequest(t, r, "GET", "/me/sessions", token, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status %v listing sessions, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		var body struct {
+			Sessions []map[string]interface{} `json:"sessions"`
+		}
+		json.NewDecoder(rr.Body).Decode(&body)
+		return body.Sessions
+	}
+
+	sessions := listSessions(laptop["token"])
+	if len(sessions) != 2 {
+		t.Fatalf("Expected 2 sessions, got %v", sessions)
+	}
+	var phoneID float64
+	for _, s := range sessions {
+		if s["user_agent"] == nil || s["ip"] == nil {
+			t.Errorf("Expected IP and user agent on each session, got %v", s)
+		}
+		if s["current"] != true {
+			phoneID = s["id"].(float64)
+		}
+	}
+	if phoneID == 0 {
+		t.Fatalf("Expected exactly one session to be marked current, got %v", sessions)
+	}
+
+	// Last-seen times are written in batches, not on every request
+	db.Model(&models.Session{}).Where("1 = 1").Update("last_seen_at", nil)
+	listSessions(phone["token"])
+	if err := middleware.FlushSessionActivity(); err != nil {
+		t.Fatalf("Failed to flush session activity: %v", err)
+	}
+	var seen models.Session
+	db.First(&seen, uint(phoneID))
+	if seen.LastSeenAt == nil {
+		t.Error("Expected the flush to record when the session was last seen")
+	}
+
+	path := "/me/sessions/" + strconv.Itoa(int(phoneID))
+	if rr := authedRequest(t, r, "DELETE", path, laptop["token"], nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v revoking a session, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if rr := authedRequest(t, r, "GET", "/me/sessions", phone["token"], nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked session's access token to be rejected, got %v", rr.Code)
+	}
+	rr := postJSON(t, handlers.RefreshToken, "/token/refresh", map[string]string{"refresh_token": phone["refresh_token"]})
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked session's refresh token to be rejected, got %v", rr.Code)
+	}
+	if sessions := listSessions(laptop["token"]); len(sessions) != 1 {
+		t.Errorf("Expected 1 session after revoking, got %v", sessions)
+	}
+
+	other := decodeTokens(t, postJSON(t, handlers.Register, "/register", map[string]string{
+		"username": "stranger", "password": "password123", "email": "stranger@example.com",
+	}))
+	var laptopSession models.Session
+	db.Where("revoked_at IS NULL").Order("id asc").First(&laptopSession)
+	if rr := authedRequest(t, r, "DELETE", "/me/sessions/"+strconv.Itoa(int(laptopSession.ID)), other["token"], nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v revoking another user's session, got %v", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestCORSAllowsConfiguredOriginsWithCredentials(t *testing.T) {
+	handler := middleware.CORS("https://app.example.com, http://localhost:3000")(okHandler)
+
+	preflight := func(origin string) http.Header {
+		req := httptest.NewRequest("OPTIONS", "/tasks", nil)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Access-Control-Request-Method", "POST")
+		req.Header.Set("Access-Control-Request-Headers", middleware.CSRFHeaderName)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Header()
+	}
+
+	h := preflight("https://app.example.com")
+	if h.Get("Access-Control-Allow-Origin") != "https://app.example.com" || h.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Expected the configured origin to be allowed with credentials, got %v", h)
+	}
+	if h := preflight("https://evil.example.com"); h.Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("Expected an unlisted origin to be refused, got %v", h)
+	}
+}
@@ -0,0 +1,130 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+)
+
+func subtasksRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tasks", handlers.CreateTask).Methods("POST")
+	r.HandleFunc("/tasks/{id}", handlers.GetTaskByID).Methods("GET")
+	r.HandleFunc("/tasks/{id}", handlers.UpdateTask).Methods("PUT")
+	r.HandleFunc("/tasks/{id}", handlers.DeleteTask).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}/children", handlers.GetSubtasks).Methods("GET")
+	r.HandleFunc("/tasks/{id}/move", handlers.MoveTask).Methods("POST")
+	return r
+}
+
+func TestSubtaskHierarchy(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, "task_tags")
+	router := subtasksRouter()
+
+	create := func(title string, parentID *int) models.Task {
+		t.Helper()
+		rr := userRequest(router, 1, "POST", "/tasks", map[string]interface{}{"title": title, "parent_id": parentID})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %v creating %s, got %v: %s", http.StatusCreated, title, rr.Code, rr.Body.String())
+		}
+		var task models.Task
+		json.NewDecoder(rr.Body).Decode(&task)
+		return task
+	}
+	get := func(id int) models.Task {
+		t.Helper()
+		var task models.Task
+		json.NewDecoder(userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d", id), nil).Body).Decode(&task)
+		return task
+	}
+
+	release := create("Release", nil)
+	build := create("Build", &release.ID)
+	compile := create("Compile", &build.ID)
+	create("Link", &build.ID)
+	docs := create("Docs", &release.ID)
+
+	stranger := models.Task{Title: "Someone else's", Status: "Pending", UserID: 2}
+	db.Create(&stranger)
+	if rr := userRequest(router, 1, "POST", "/tasks", map[string]interface{}{"title": "Sneaky", "parent_id": stranger.ID}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v nesting under another user's task, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	rr := userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d/children", release.ID), nil)
+	var children struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	json.NewDecoder(rr.Body).Decode(&children)
+	if len(children.Tasks) != 2 || children.Tasks[0].ID != build.ID || children.Tasks[1].ID != docs.ID {
+		t.Fatalf("Expected Build and Docs as children, got %+v", children.Tasks)
+	}
+	if p := children.Tasks[0].Progress; p == nil || *p != 0 {
+		t.Errorf("Expected Build to report 0%% progress, got %v", p)
+	}
+	if children.Tasks[1].Progress != nil {
+		t.Errorf("Expected no progress on a task without subtasks, got %v", *children.Tasks[1].Progress)
+	}
+
+	// Completing a parent with open subtasks is blocked unless cascaded
+	complete := map[string]string{"title": "Build", "status": "Completed"}
+	if rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", build.ID), complete); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v completing a parent with open subtasks, got %v", http.StatusConflict, rr.Code)
+	}
+	userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", compile.ID), map[string]string{"title": "Compile", "status": "Completed"})
+	if p := get(release.ID).Progress; p == nil || *p != 25 {
+		t.Errorf("Expected Release to be 25%% done with one of four descendants completed, got %v", p)
+	}
+	if rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d?subtasks=cascade", build.ID), complete); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v completing with subtasks=cascade, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if p := get(release.ID).Progress; p == nil || *p != 75 {
+		t.Errorf("Expected Release to be 75%% done after the cascade, got %v", p)
+	}
+
+	// A subtree cannot be moved under itself
+	if rr := userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/move", release.ID), map[string]interface{}{"parent_id": compile.ID}); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v moving a task under its own subtask, got %v", http.StatusConflict, rr.Code)
+	}
+	if rr := userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/move", build.ID), map[string]interface{}{"parent_id": docs.ID}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v moving a subtree, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if parent := get(build.ID).ParentID; parent == nil || *parent != docs.ID {
+		t.Errorf("Expected Build to move under Docs, got parent %v", parent)
+	}
+
+	// Deleting re-parents the subtasks by default
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("/tasks/%d", docs.ID), nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v deleting Docs, got %v", http.StatusOK, rr.Code)
+	}
+	if parent := get(build.ID).ParentID; parent == nil || *parent != release.ID {
+		t.Errorf("Expected Build to move up to Release, got parent %v", parent)
+	}
+
+	// or removes the whole subtree with subtasks=cascade
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("/tasks/%d?subtasks=cascade", release.ID), nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v deleting Release, got %v", http.StatusOK, rr.Code)
+	}
+	var remaining int64
+	db.Model(&models.Task{}).Where("user_id = ?", 1).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("Expected the cascade to delete every subtask, %d remain", remaining)
+	}
+
+	// Should parent links ever form a cycle, reading and moving still end
+	first := create("First", nil)
+	second := create("Second", &first.ID)
+	db.Model(&models.Task{}).Where("id = ?", first.ID).Update("parent_id", second.ID)
+	if p := get(first.ID).Progress; p == nil || *p != 0 {
+		t.Errorf("Expected progress despite the cycle, got %v", p)
+	}
+	loose := create("Loose", nil)
+	if rr := userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/move", loose.ID), map[string]interface{}{"parent_id": second.ID}); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v moving under a task in a cycle, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,151 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+)
+
+func tagsRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/tags", handlers.GetTags).Methods("GET")
+	r.HandleFunc("/tags", handlers.CreateTag).Methods("POST")
+	r.HandleFunc("/tags/{id}", handlers.UpdateTag).Methods("PUT")
+	r.HandleFunc("/tags/{id}", handlers.DeleteTag).Methods("DELETE")
+	r.HandleFunc("/tasks/{id}", handlers.GetTaskByID).Methods("GET")
+	r.HandleFunc("/tasks/{id}/tags/{tag_id}", handlers.AttachTag).Methods("POST")
+	r.HandleFunc("/tasks/{id}/tags/{tag_id}", handlers.DetachTag).Methods("DELETE")
+	return r
+}
+
+// userRequest sends a request as userID straight to handler
+func userRequest(handler http.Handler, userID int, method, path string, payload interface{}) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	if payload != nil {
+		json.NewEncoder(&body).Encode(payload)
+	}
+	req, _ := http.NewRequest(method, path, &body)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, withUser(req, userID))
+	return rr
+}
+
+func TestTagCRUDAndAttach(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, "task_tags")
+	router := tagsRouter()
+
+	createTag := func(userID int, name string) models.Tag {
+		t.Helper()
+		rr := userRequest(router, userID, "POST", "/tags", map[string]string{"name": name, "color": "#1f77b4"})
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %v creating tag %s, got %v: %s", http.StatusCreated, name, rr.Code, rr.Body.String())
+		}
+		var tag models.Tag
+		json.NewDecoder(rr.Body).Decode(&tag)
+		return tag
+	}
+	bug := createTag(1, "bug")
+	createTag(2, "bug") // names are unique per user only
+
+	if rr := userRequest(router, 1, "POST", "/tags", map[string]string{"name": "bug"}); rr.Code != http.StatusConflict {
+		t.Errorf("Expected status %v for a duplicate name, got %v", http.StatusConflict, rr.Code)
+	}
+	if rr := userRequest(router, 1, "POST", "/tags", map[string]string{"name": "-bug"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for a name starting with -, got %v", http.StatusBadRequest, rr.Code)
+	}
+	if rr := userRequest(router, 1, "POST", "/tags", map[string]string{"name": "red", "color": "red"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for a non-hex color, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	task := models.Task{Title: "Fix login", Status: "Pending", UserID: 1}
+	db.Create(&task)
+	other := models.Task{Title: "Not mine", Status: "Pending", UserID: 2}
+	db.Create(&other)
+
+	rr := userRequest(router, 1, "POST", fmt.Sprintf("/tasks/%d/tags/%d", task.ID, bug.ID), nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v attaching tag, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var tagged models.Task
+	json.NewDecoder(rr.Body).Decode(&tagged)
+	if len(tagged.Tags) != 1 || tagged.Tags[0].Name != "bug" || tagged.Tags[0].Color != "#1f77b4" {
+		t.Errorf("Expected the task JSON to include the tag, got %+v", tagged.Tags)
+	}
+	if rr := userRequest(router, 2, "POST", fmt.Sprintf("/tasks/%d/tags/%d", other.ID, bug.ID), nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected status %v attaching another user's tag, got %v", http.StatusNotFound, rr.Code)
+	}
+
+	// Renaming reaches every task and marks it updated
+	db.Model(&task).Update("updated_at", time.Now().Add(-time.Hour))
+	if rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tags/%d", bug.ID), map[string]string{"name": "defect"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v renaming tag, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d", task.ID), nil)
+	var renamed models.Task
+	json.NewDecoder(rr.Body).Decode(&renamed)
+	if len(renamed.Tags) != 1 || renamed.Tags[0].Name != "defect" {
+		t.Errorf("Expected the renamed tag on the task, got %+v", renamed.Tags)
+	}
+	if time.Since(renamed.UpdatedAt) > time.Minute {
+		t.Errorf("Expected renaming to touch the task, updated_at is %v", renamed.UpdatedAt)
+	}
+
+	if rr := userRequest(router, 1, "DELETE", fmt.Sprintf("/tags/%d", bug.ID), nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v deleting tag, got %v", http.StatusOK, rr.Code)
+	}
+	var links int64
+	db.Table("task_tags").Count(&links)
+	if links != 0 {
+		t.Errorf("Expected deleting the tag to detach it from every task, %d links remain", links)
+	}
+}
+
+func TestGetTasksTagFilter(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, "task_tags")
+
+	tags := map[string]models.Tag{}
+	for _, name := range []string{"backend", "bug", "q4"} {
+		tag := models.Tag{UserID: 1, Name: name, Color: models.DefaultTagColor}
+		db.Create(&tag)
+		tags[name] = tag
+	}
+	for title, names := range map[string][]string{
+		"Backend bug":  {"backend", "bug"},
+		"Backend Q4":   {"backend", "q4"},
+		"Frontend bug": {"bug"},
+		"Untagged":     nil,
+	} {
+		task := models.Task{Title: title, Status: "Pending", UserID: 1}
+		for _, name := range names {
+			task.Tags = append(task.Tags, tags[name])
+		}
+		db.Create(&task)
+	}
+
+	cases := []struct {
+		query string
+		want  []string
+	}{
+		{"tags=backend,bug", []string{"Backend Q4", "Backend bug", "Frontend bug"}},
+		{"tags=backend,bug&tag_mode=all", []string{"Backend bug"}},
+		{"tags=-bug", []string{"Backend Q4", "Untagged"}},
+		{"tags=backend,-q4", []string{"Backend bug"}},
+		{"tags=missing&tag_mode=all", []string{}},
+	}
+	for _, c := range cases {
+		if got := listTaskTitles(t, c.query+"&sort_by=title"); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("GET /tasks?%s: expected %v, got %v", c.query, c.want, got)
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/auth"
 	"github.com/harip/GoTasker/handlers"
 	"github.com/harip/GoTasker/models"
 	"gorm.io/driver/sqlite"
@@ -19,11 +22,16 @@ func setupTestDB() *gorm.DB {
 	if err != nil {
 		panic("Failed to connect to test database: " + err.Error())
 	}
-	db.AutoMigrate(&models.Task{})
+	db.AutoMigrate(&models.Task{}, &models.Tag{}, &models.TaskDependency{}, &models.Reminder{}, &models.Comment{}, &models.Attachment{}, &models.Workflow{}, &models.WorkflowStatus{}, &models.WorkflowTransition{})
 	handlers.InitDB(db)
 	return db
 }
 
+// withUser attaches an authenticated user the way RequireLogin does
+func withUser(req *http.Request, userID int) *http.Request {
+	return req.WithContext(auth.NewContext(req.Context(), &auth.Principal{UserID: uint(userID), Method: auth.MethodJWT}))
+}
+
 func TestCreateTask(t *testing.T) {
 	db := setupTestDB()
 	defer db.Migrator().DropTable(&models.Task{})
@@ -36,6 +44,7 @@ func TestCreateTask(t *testing.T) {
 	body, _ := json.Marshal(task)
 
 	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(body))
+	req = withUser(req, 1)
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
@@ -57,10 +66,11 @@ func TestGetTasks(t *testing.T) {
 	db := setupTestDB()
 	defer db.Migrator().DropTable(&models.Task{})
 
-	db.Create(&models.Task{Title: "Task 1", Status: "Pending"})
-	db.Create(&models.Task{Title: "Task 2", Status: "In Progress"})
+	db.Create(&models.Task{Title: "Task 1", Status: "Pending", UserID: 1})
+	db.Create(&models.Task{Title: "Task 2", Status: "In Progress", StatusCategory: models.CategoryDoing, UserID: 1})
 
 	req, _ := http.NewRequest("GET", "/tasks?page=1&limit=10", nil)
+	req = withUser(req, 1)
 	rr := httptest.NewRecorder()
 
 	handler := http.HandlerFunc(handlers.GetTasks)
@@ -82,10 +92,11 @@ func TestGetTaskByID(t *testing.T) {
 	db := setupTestDB()
 	defer db.Migrator().DropTable(&models.Task{})
 
-	task := models.Task{Title: "Test Task", Status: "Pending"}
+	task := models.Task{Title: "Test Task", Status: "Pending", UserID: 1}
 	db.Create(&task)
 
 	req, _ := http.NewRequest("GET", "/tasks/1", nil)
+	req = withUser(req, 1)
 	rr := httptest.NewRecorder()
 
 	router := mux.NewRouter()
@@ -102,3 +113,74 @@ func TestGetTaskByID(t *testing.T) {
 		t.Errorf("Expected ID %v, got %v", task.ID, fetchedTask.ID)
 	}
 }
+
+// listTaskTitles calls GetTasks with query and returns the titles in order
+func listTaskTitles(t *testing.T, query string) []string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/tasks?"+query, nil)
+	req = withUser(req, 1)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.GetTasks).ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response struct {
+		Tasks []models.Task `json:"tasks"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &response)
+	titles := make([]string, len(response.Tasks))
+	for i, task := range response.Tasks {
+		titles[i] = task.Title
+	}
+	return titles
+}
+
+func TestTaskPriority(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{})
+
+	body, _ := json.Marshal(map[string]string{"title": "Bad", "priority": "critical"})
+	req, _ := http.NewRequest("POST", "/tasks", bytes.NewBuffer(body))
+	req = withUser(req, 1)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(handlers.CreateTask).ServeHTTP(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for an unknown priority, got %v", http.StatusBadRequest, rr.Code)
+	}
+
+	now := time.Now()
+	yesterday, tomorrow, nextWeek := now.Add(-24*time.Hour), now.Add(24*time.Hour), now.Add(7*24*time.Hour)
+	db.Create(&models.Task{Title: "Someday", Status: "Pending", UserID: 1})
+	db.Create(&models.Task{Title: "Urgent next week", Status: "Pending", Priority: models.PriorityUrgent, DueDate: &nextWeek, UserID: 1})
+	db.Create(&models.Task{Title: "Low overdue", Status: "Pending", Priority: models.PriorityLow, DueDate: &yesterday, UserID: 1})
+	db.Create(&models.Task{Title: "High tomorrow", Status: "In Progress", StatusCategory: models.CategoryDoing, Priority: models.PriorityHigh, DueDate: &tomorrow, UserID: 1})
+	db.Create(&models.Task{Title: "Urgent tomorrow", Status: "Pending", Priority: models.PriorityUrgent, DueDate: &tomorrow, UserID: 1})
+	db.Create(&models.Task{Title: "Done overdue", Status: "Completed", StatusCategory: models.CategoryDone, Priority: models.PriorityMedium, DueDate: &yesterday, UserID: 1})
+
+	var someday models.Task
+	db.Where("title = ?", "Someday").First(&someday)
+	if someday.Priority != models.PriorityNone {
+		t.Errorf("Expected tasks to default to priority %q, got %q", models.PriorityNone, someday.Priority)
+	}
+
+	// Ranked by urgency, not alphabetically
+	want := []string{"Urgent next week", "Urgent tomorrow", "High tomorrow", "Done overdue", "Low overdue", "Someday"}
+	if got := listTaskTitles(t, "sort_by=priority&sort_order=desc"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected priority order %v, got %v", want, got)
+	}
+
+	want = []string{"Low overdue", "Urgent tomorrow", "Urgent next week", "High tomorrow", "Done overdue", "Someday"}
+	if got := listTaskTitles(t, "sort_by=smart"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected smart order %v, got %v", want, got)
+	}
+
+	want = []string{"Urgent next week", "High tomorrow", "Urgent tomorrow"}
+	if got := listTaskTitles(t, "priority=high,urgent&sort_by=id"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected only high and urgent tasks, got %v", got)
+	}
+
+	// Unknown sort columns fall back to creation order instead of reaching SQL
+	if got := listTaskTitles(t, "sort_by=title;drop table tasks"); len(got) != 6 {
+		t.Errorf("Expected an unknown sort_by to be ignored, got %v", got)
+	}
+}
@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/harip/GoTasker/handlers"
+	"github.com/harip/GoTasker/models"
+	"github.com/harip/GoTasker/workflows"
+)
+
+func workflowsRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.HandleFunc("/workflow", handlers.GetWorkflow).Methods("GET")
+	r.HandleFunc("/workflow", handlers.UpdateWorkflow).Methods("PUT")
+	r.HandleFunc("/tasks", handlers.CreateTask).Methods("POST")
+	r.HandleFunc("/tasks", handlers.GetTasks).Methods("GET")
+	r.HandleFunc("/tasks/{id}", handlers.GetTaskByID).Methods("GET")
+	r.HandleFunc("/tasks/{id}", handlers.UpdateTask).Methods("PUT")
+	return r
+}
+
+func TestWorkflowStatusesAndTransitions(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, "task_tags", &models.Workflow{}, &models.WorkflowStatus{}, &models.WorkflowTransition{})
+	router := workflowsRouter()
+
+	decodeWorkflow := func(body string) models.Workflow {
+		t.Helper()
+		var workflow models.Workflow
+		if err := json.Unmarshal([]byte(body), &workflow); err != nil {
+			t.Fatalf("Failed to decode workflow: %v", err)
+		}
+		return workflow
+	}
+	rr := userRequest(router, 1, "GET", "/workflow", nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	defaults := decodeWorkflow(rr.Body.String())
+	if !reflect.DeepEqual(workflows.Names(&defaults), []string{"Pending", "In Progress", "Completed"}) {
+		t.Fatalf("Expected the default workflow, got %v", workflows.Names(&defaults))
+	}
+	if got := defaults.Statuses[1].Transitions; !reflect.DeepEqual(got, []string{"Pending", "Completed"}) {
+		t.Errorf("Expected In Progress to move anywhere, got %v", got)
+	}
+	pending, inProgress, completed := defaults.Statuses[0], defaults.Statuses[1], defaults.Statuses[2]
+
+	create := func(payload map[string]interface{}) models.Task {
+		t.Helper()
+		rr := userRequest(router, 1, "POST", "/tasks", payload)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("Expected status %v creating %v, got %v: %s", http.StatusCreated, payload["title"], rr.Code, rr.Body.String())
+		}
+		var task models.Task
+		json.NewDecoder(rr.Body).Decode(&task)
+		return task
+	}
+	update := func(task models.Task, status string) (models.Task, int) {
+		t.Helper()
+		rr := userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d", task.ID), map[string]interface{}{
+			"title": task.Title, "status": status, "due_date": task.DueDate, "recurrence": task.Recurrence,
+		})
+		var updated models.Task
+		json.NewDecoder(rr.Body).Decode(&updated)
+		return updated, rr.Code
+	}
+
+	legacy := create(map[string]interface{}{"title": "Legacy"})
+	if legacy.Status != "Pending" || legacy.StatusCategory != models.CategoryTodo {
+		t.Errorf("Expected a new task to start in Pending (todo), got %s (%s)", legacy.Status, legacy.StatusCategory)
+	}
+
+	put := func(statuses []map[string]interface{}) *httptest.ResponseRecorder {
+		return userRequest(router, 1, "PUT", "/workflow", map[string]interface{}{"statuses": statuses})
+	}
+	// Pending is still in use, so it cannot simply be dropped
+	custom := []map[string]interface{}{
+		{"name": "Backlog", "category": "todo", "transitions": []string{"Doing"}},
+		{"id": inProgress.ID, "name": "Doing", "category": "doing", "transitions": []string{"Backlog", "Review"}},
+		{"name": "Review", "category": "doing", "transitions": []string{"Doing", "Done"}},
+		{"id": completed.ID, "name": "Done", "category": "done"},
+	}
+	if res := put(custom); res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), "Pending (1)") {
+		t.Errorf("Expected status %v removing a status in use, got %v: %s", http.StatusConflict, res.Code, res.Body.String())
+	}
+	for name, statuses := range map[string][]map[string]interface{}{
+		"no statuses":        {},
+		"duplicate names":    {{"name": "Open", "category": "todo"}, {"name": "open", "category": "done"}},
+		"quoted name":        {{"name": `"Open"`, "category": "todo"}},
+		"unknown category":   {{"name": "Open", "category": "later"}},
+		"unknown transition": {{"name": "Open", "category": "todo", "transitions": []string{"Closed"}}},
+		"self transition":    {{"name": "Open", "category": "todo", "transitions": []string{"Open"}}},
+		"unknown ID":         {{"id": completed.ID + 100, "name": "Open", "category": "todo"}},
+	} {
+		if res := put(statuses); res.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %v for %s, got %v: %s", http.StatusBadRequest, name, res.Code, res.Body.String())
+		}
+	}
+
+	// Keeping Pending's ID renames it, and its task follows
+	custom[0]["id"] = pending.ID
+	res := put(custom)
+	if res.Code != http.StatusOK {
+		t.Fatalf("Expected status %v, got %v: %s", http.StatusOK, res.Code, res.Body.String())
+	}
+	workflow := decodeWorkflow(res.Body.String())
+	if !reflect.DeepEqual(workflows.Names(&workflow), []string{"Backlog", "Doing", "Review", "Done"}) {
+		t.Fatalf("Expected the custom workflow, got %v", workflows.Names(&workflow))
+	}
+	if workflow.Statuses[0].ID != pending.ID || workflow.Statuses[3].ID != completed.ID {
+		t.Errorf("Expected statuses sent with an ID to keep it, got %+v", workflow.Statuses)
+	}
+	if got := workflow.Statuses[3].Transitions; !reflect.DeepEqual(got, []string{"Backlog", "Doing", "Review"}) {
+		t.Errorf("Expected Done to move anywhere without a transitions list, got %v", got)
+	}
+	var renamed models.Task
+	db.First(&renamed, legacy.ID)
+	if renamed.Status != "Backlog" || renamed.StatusCategory != models.CategoryTodo {
+		t.Errorf("Expected the task to follow its renamed status, got %s (%s)", renamed.Status, renamed.StatusCategory)
+	}
+
+	rr = userRequest(router, 1, "POST", "/tasks", map[string]interface{}{"title": "Old name", "status": "Pending"})
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "Backlog, Doing, Review, Done") {
+		t.Errorf("Expected status %v listing the workflow, got %v: %s", http.StatusBadRequest, rr.Code, rr.Body.String())
+	}
+
+	// Transitions are enforced, and categories decide what a move means
+	due := time.Date(2030, 1, 7, 9, 0, 0, 0, time.UTC)
+	weekly := create(map[string]interface{}{"title": "Standup notes", "due_date": due, "recurrence": "FREQ=WEEKLY"})
+	if _, code := update(weekly, "Done"); code != http.StatusConflict {
+		t.Errorf("Expected status %v skipping from Backlog to Done, got %v", http.StatusConflict, code)
+	}
+	if _, code := update(weekly, "Someday"); code != http.StatusBadRequest {
+		t.Errorf("Expected status %v for an unknown status, got %v", http.StatusBadRequest, code)
+	}
+	for _, status := range []string{"Doing", "Review"} {
+		updated, code := update(weekly, status)
+		if code != http.StatusOK || updated.StatusCategory != models.CategoryDoing {
+			t.Fatalf("Expected status %v moving to %s, got %v (%s)", http.StatusOK, status, code, updated.StatusCategory)
+		}
+		weekly = updated
+	}
+	done, code := update(weekly, "Done")
+	if code != http.StatusOK || done.StatusCategory != models.CategoryDone {
+		t.Fatalf("Expected status %v completing the task, got %v (%s)", http.StatusOK, code, done.StatusCategory)
+	}
+	next := done.NextOccurrence
+	if next == nil || next.Status != "Backlog" || next.StatusCategory != models.CategoryTodo {
+		t.Fatalf("Expected the next occurrence to start in Backlog, got %+v", next)
+	}
+
+	var list struct {
+		Tasks []models.Task `json:"tasks"`
+		Total int64         `json:"total"`
+	}
+	json.NewDecoder(userRequest(router, 1, "GET", "/tasks?status_category=done", nil).Body).Decode(&list)
+	if list.Total != 1 || list.Tasks[0].ID != weekly.ID {
+		t.Errorf("Expected only the completed task in the done category, got %+v", list.Tasks)
+	}
+	json.NewDecoder(userRequest(router, 1, "GET", "/tasks?status=Backlog", nil).Body).Decode(&list)
+	if list.Total != 2 {
+		t.Errorf("Expected 2 tasks in Backlog, got %d", list.Total)
+	}
+
+	// Completing a parent moves its subtasks too, under the same rules
+	parent := create(map[string]interface{}{"title": "Release"})
+	child := create(map[string]interface{}{"title": "Notes", "parent_id": parent.ID})
+	for _, status := range []string{"Doing", "Review"} {
+		parent, _ = update(parent, status)
+	}
+	get := func(id int) models.Task {
+		t.Helper()
+		var task models.Task
+		json.NewDecoder(userRequest(router, 1, "GET", fmt.Sprintf("/tasks/%d", id), nil).Body).Decode(&task)
+		return task
+	}
+	cascade := func() *httptest.ResponseRecorder {
+		return userRequest(router, 1, "PUT", fmt.Sprintf("/tasks/%d?subtasks=cascade", parent.ID), map[string]interface{}{
+			"title": parent.Title, "status": "Done",
+		})
+	}
+	want := fmt.Sprintf("Subtasks %d (Backlog) cannot move to Done", child.ID)
+	if rr := cascade(); rr.Code != http.StatusConflict || !strings.Contains(rr.Body.String(), want) {
+		t.Errorf("Expected status %v naming the stuck subtask, got %v: %s", http.StatusConflict, rr.Code, rr.Body.String())
+	}
+	if got := get(child.ID); got.Status != "Backlog" {
+		t.Errorf("Expected the refused cascade to leave the subtask in Backlog, got %s", got.Status)
+	}
+	for _, status := range []string{"Doing", "Review"} {
+		child, _ = update(child, status)
+	}
+	if rr := cascade(); rr.Code != http.StatusOK {
+		t.Errorf("Expected status %v once the subtask can move, got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	if got := get(child.ID); got.Status != "Done" {
+		t.Errorf("Expected the cascade to complete the subtask, got %s", got.Status)
+	}
+
+	// Another user still has the default workflow
+	rr = userRequest(router, 2, "GET", "/workflow", nil)
+	if other := decodeWorkflow(rr.Body.String()); !reflect.DeepEqual(workflows.Names(&other), []string{"Pending", "In Progress", "Completed"}) {
+		t.Errorf("Expected user 2 to keep the default workflow, got %v", workflows.Names(&other))
+	}
+}
+
+func TestMigrateTasksOntoDefaultWorkflow(t *testing.T) {
+	db := setupTestDB()
+	defer db.Migrator().DropTable(&models.Task{}, &models.Tag{}, "task_tags")
+
+	// Rows from before workflows only have a status
+	statuses := map[string]string{
+		"Pending":     models.CategoryTodo,
+		"In Progress": models.CategoryDoing,
+		"Completed":   models.CategoryDone,
+		"Blocked":     models.CategoryTodo,
+	}
+	ids := map[string]int{}
+	for status := range statuses {
+		task := models.Task{Title: status, Status: status, UserID: 1}
+		db.Create(&task)
+		ids[status] = task.ID
+	}
+	db.Delete(&models.Task{}, ids["Completed"])
+
+	if err := workflows.MigrateTasks(db); err != nil {
+		t.Fatalf("MigrateTasks failed: %v", err)
+	}
+	for status, category := range statuses {
+		var task models.Task
+		db.Unscoped().First(&task, ids[status])
+		if task.StatusCategory != category {
+			t.Errorf("Expected %s to map to %s, got %s", status, category, task.StatusCategory)
+		}
+	}
+}
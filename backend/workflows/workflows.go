@@ -0,0 +1,255 @@
+// workflows/workflows.go
+package workflows
+
+import (
+	"errors"
+	"time"
+
+	"github.com/harip/GoTasker/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Default returns the statuses every user starts with. Tasks can move
+// freely between them.
+func Default() []models.WorkflowStatus {
+	statuses := []models.WorkflowStatus{
+		{Name: "Pending", Category: models.CategoryTodo},
+		{Name: "In Progress", Category: models.CategoryDoing},
+		{Name: "Completed", Category: models.CategoryDone},
+	}
+	for i := range statuses {
+		statuses[i].Position = i
+		statuses[i].Transitions = allBut(statuses, i)
+	}
+	return statuses
+}
+
+// allBut returns the names of every status except the i'th.
+func allBut(statuses []models.WorkflowStatus, i int) []string {
+	names := []string{}
+	for j, status := range statuses {
+		if j != i {
+			names = append(names, status.Name)
+		}
+	}
+	return names
+}
+
+// ForUser returns the workflow of userID with its statuses in order and
+// their transitions filled in, creating the default workflow the first
+// time it is needed.
+func ForUser(tx *gorm.DB, userID uint) (*models.Workflow, error) {
+	return find(tx, userID, false)
+}
+
+// ForUpdate is ForUser for a workflow about to be replaced. On postgres the
+// workflow stays locked until tx ends, so concurrent edits take turns.
+func ForUpdate(tx *gorm.DB, userID uint) (*models.Workflow, error) {
+	return find(tx, userID, true)
+}
+
+func find(tx *gorm.DB, userID uint, lock bool) (*models.Workflow, error) {
+	var workflow models.Workflow
+	first := func() error {
+		query := tx
+		if lock && tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+		}
+		return query.Where("user_id = ?", userID).First(&workflow).Error
+	}
+	err := first()
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		if err = createDefault(tx, userID); err == nil {
+			err = first()
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := load(tx, &workflow); err != nil {
+		return nil, err
+	}
+	return &workflow, nil
+}
+
+// createDefault gives userID the default workflow, unless a concurrent
+// request has just done so.
+func createDefault(tx *gorm.DB, userID uint) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		workflow := models.Workflow{UserID: userID, CreatedAt: now, UpdatedAt: now}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Omit(clause.Associations).Create(&workflow)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return insertStatuses(tx, workflow.ID, Default())
+	})
+}
+
+// load fills in the statuses of workflow and their transitions.
+func load(tx *gorm.DB, workflow *models.Workflow) error {
+	if err := tx.Where("workflow_id = ?", workflow.ID).Order("position asc").Find(&workflow.Statuses).Error; err != nil {
+		return err
+	}
+	var transitions []models.WorkflowTransition
+	if err := tx.Where("workflow_id = ?", workflow.ID).Find(&transitions).Error; err != nil {
+		return err
+	}
+	allowed := make(map[uint]map[uint]bool, len(workflow.Statuses))
+	for _, t := range transitions {
+		if allowed[t.FromID] == nil {
+			allowed[t.FromID] = map[uint]bool{}
+		}
+		allowed[t.FromID][t.ToID] = true
+	}
+	// Listed in workflow order rather than the order they were stored
+	for i := range workflow.Statuses {
+		from := &workflow.Statuses[i]
+		from.Transitions = []string{}
+		for _, to := range workflow.Statuses {
+			if allowed[from.ID][to.ID] {
+				from.Transitions = append(from.Transitions, to.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// insertStatuses stores statuses, in order, as those of workflowID along
+// with their transitions. A status with an ID keeps it.
+func insertStatuses(tx *gorm.DB, workflowID uint, statuses []models.WorkflowStatus) error {
+	ids := make(map[string]uint, len(statuses))
+	for i := range statuses {
+		status := statuses[i]
+		status.WorkflowID = workflowID
+		status.Position = i
+		if err := tx.Create(&status).Error; err != nil {
+			return err
+		}
+		ids[status.Name] = status.ID
+	}
+	var transitions []models.WorkflowTransition
+	for _, status := range statuses {
+		for _, name := range status.Transitions {
+			transitions = append(transitions, models.WorkflowTransition{
+				WorkflowID: workflowID,
+				FromID:     ids[status.Name],
+				ToID:       ids[name],
+			})
+		}
+	}
+	if len(transitions) == 0 {
+		return nil
+	}
+	return tx.Create(&transitions).Error
+}
+
+// Replace makes statuses the workflow, in order. The statuses must already
+// be valid: named uniquely, with transitions naming other statuses in the
+// list, and workflow should come from ForUpdate. A status carrying the ID
+// of an existing status replaces it, and tasks in a renamed or
+// recategorized status follow it; tasks must already have been moved out
+// of statuses that are left out.
+func Replace(tx *gorm.DB, workflow *models.Workflow, statuses []models.WorkflowStatus) error {
+	previous := make(map[uint]models.WorkflowStatus, len(workflow.Statuses))
+	for _, status := range workflow.Statuses {
+		previous[status.ID] = status
+	}
+
+	// Deleting everything first lets statuses swap names without tripping
+	// the unique index on the way
+	if err := tx.Where("workflow_id = ?", workflow.ID).Delete(&models.WorkflowTransition{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("workflow_id = ?", workflow.ID).Delete(&models.WorkflowStatus{}).Error; err != nil {
+		return err
+	}
+	if err := insertStatuses(tx, workflow.ID, statuses); err != nil {
+		return err
+	}
+
+	// One statement for every renamed status, so swapped names cannot
+	// catch tasks that were just moved
+	var names, categories clause.Expr
+	var changed []string
+	for _, status := range statuses {
+		old, ok := previous[status.ID]
+		if !ok || (old.Name == status.Name && old.Category == status.Category) {
+			continue
+		}
+		names.SQL += " WHEN ? THEN ?"
+		names.Vars = append(names.Vars, old.Name, status.Name)
+		categories.SQL += " WHEN ? THEN ?"
+		categories.Vars = append(categories.Vars, old.Name, status.Category)
+		changed = append(changed, old.Name)
+	}
+	if len(changed) > 0 {
+		names.SQL = "CASE status" + names.SQL + " END"
+		categories.SQL = "CASE status" + categories.SQL + " END"
+		if err := tx.Unscoped().Model(&models.Task{}).Where("user_id = ? AND status IN ?", workflow.UserID, changed).
+			UpdateColumns(map[string]interface{}{"status": names, "status_category": categories, "updated_at": time.Now()}).Error; err != nil {
+			return err
+		}
+	}
+
+	workflow.UpdatedAt = time.Now()
+	if err := tx.Model(workflow).Update("updated_at", workflow.UpdatedAt).Error; err != nil {
+		return err
+	}
+	return load(tx, workflow)
+}
+
+// Status returns the status of workflow called name.
+func Status(workflow *models.Workflow, name string) (models.WorkflowStatus, bool) {
+	for _, status := range workflow.Statuses {
+		if status.Name == name {
+			return status, true
+		}
+	}
+	return models.WorkflowStatus{}, false
+}
+
+// Initial returns the status new tasks start in.
+func Initial(workflow *models.Workflow) models.WorkflowStatus {
+	return workflow.Statuses[0]
+}
+
+// Names lists the statuses of workflow in order.
+func Names(workflow *models.Workflow) []string {
+	names := make([]string, len(workflow.Statuses))
+	for i, status := range workflow.Statuses {
+		names[i] = status.Name
+	}
+	return names
+}
+
+// Allows reports whether a task can move from status from to status to.
+// A task in a status the workflow no longer has can move anywhere.
+func Allows(workflow *models.Workflow, from, to string) bool {
+	status, ok := Status(workflow, from)
+	if !ok {
+		return true
+	}
+	for _, name := range status.Transitions {
+		if name == to {
+			return true
+		}
+	}
+	return false
+}
+
+// MigrateTasks maps tasks from before workflows existed onto the default
+// workflow, giving each the category of its status. A status outside the
+// default workflow counts as to do.
+func MigrateTasks(tx *gorm.DB) error {
+	categories := clause.Expr{SQL: "CASE status"}
+	for _, status := range Default() {
+		categories.SQL += " WHEN ? THEN ?"
+		categories.Vars = append(categories.Vars, status.Name, status.Category)
+	}
+	categories.SQL += " ELSE ? END"
+	categories.Vars = append(categories.Vars, models.CategoryTodo)
+	return tx.Session(&gorm.Session{AllowGlobalUpdate: true}).Unscoped().Model(&models.Task{}).
+		UpdateColumn("status_category", categories).Error
+}
@@ -1,16 +1,23 @@
-import React, { useState } from 'react';
+import React, { useState, useEffect } from 'react';
 import { BrowserRouter as Router, Route, Routes, Navigate } from 'react-router-dom';
 import Login from './components/Login';
 import Signup from './components/Signup';
+import OidcCallback from './components/OidcCallback';
 import TaskList from './components/TaskList';
+import { setTokenListener, logout } from './api/taskService';
 import './App.css';
 
 function App() {
   const [token, setToken] = useState(localStorage.getItem('token') || '');
 
-  const handleLogout = () => {
+  useEffect(() => {
+    setTokenListener(setToken);
+    return () => setTokenListener(null);
+  }, []);
+
+  const handleLogout = async () => {
+    await logout(token);
     setToken('');
-    localStorage.removeItem('token');
   };
 
   return (
@@ -35,6 +42,7 @@ function App() {
             <>
               <Route path="/signup" element={<Signup setToken={setToken} />} />
               <Route path="/login" element={<Login setToken={setToken} />} />
+              <Route path="/auth/callback" element={<OidcCallback setToken={setToken} />} />
               <Route path="*" element={<Navigate to="/signup" />} />
             </>
           )}
@@ -2,12 +2,95 @@ import axios from 'axios';
 
 const API_URL = 'http://localhost:8080';
 
+let onTokenChange = () => {};
+
+// Lets the app keep its token state in sync when a request transparently
+// refreshes the access token, or when the session can no longer be renewed.
+export const setTokenListener = (listener) => {
+  onTokenChange = listener || (() => {});
+};
+
+export const saveSession = (data) => {
+  localStorage.setItem('token', data.token);
+  if (data.refresh_token) {
+    localStorage.setItem('refresh_token', data.refresh_token);
+  }
+};
+
+export const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
+};
+
+export const logout = async (token) => {
+  try {
+    await axios.post(`${API_URL}/logout`, {
+      refresh_token: localStorage.getItem('refresh_token') || '',
+    }, {
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${token}`,
+      },
+    });
+  } catch (error) {
+    console.error('Error logging out:', error.response?.data || error.message);
+  } finally {
+    clearSession();
+  }
+};
+
+export const refreshSession = async (refreshToken) => {
+  const response = await axios.post(`${API_URL}/token/refresh`, { refresh_token: refreshToken }, {
+    headers: {
+      'Content-Type': 'application/json',
+    },
+  });
+  return response.data;
+};
+
+// Refresh tokens rotate on every use, so concurrent 401s must share a single
+// refresh request; a second refresh with the same token would be treated as
+// reuse and sign the user out.
+let pendingRefresh = null;
+
+axios.interceptors.response.use(undefined, async (error) => {
+  const original = error.config;
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (
+    error.response?.status !== 401 ||
+    !original ||
+    original._retried ||
+    !original.headers?.Authorization ||
+    !refreshToken
+  ) {
+    return Promise.reject(error);
+  }
+  original._retried = true;
+
+  try {
+    if (!pendingRefresh) {
+      pendingRefresh = refreshSession(refreshToken).finally(() => {
+        pendingRefresh = null;
+      });
+    }
+    const data = await pendingRefresh;
+    saveSession(data);
+    onTokenChange(data.token);
+    original.headers.Authorization = `Bearer ${data.token}`;
+    return axios(original);
+  } catch (refreshError) {
+    clearSession();
+    onTokenChange('');
+    return Promise.reject(error);
+  }
+});
+
 export const createTask = async (taskData, token) => {
   try {
     const response = await axios.post(`${API_URL}/tasks`, {
       title: taskData.title,
       description: taskData.description || '',
-      status: taskData.status || 'Pending',
+      status: taskData.status || '',
       due_date: taskData.due_date || null,
     }, {
       headers: {
@@ -61,7 +144,7 @@ export const updateTask = async (id, taskData, token) => {
     const response = await axios.put(`${API_URL}/tasks/${id}`, {
       title: taskData.title,
       description: taskData.description || '',
-      status: taskData.status || 'Pending',
+      status: taskData.status || '',
       due_date: taskData.due_date || null,
     }, {
       headers: {
@@ -77,6 +160,22 @@ export const updateTask = async (id, taskData, token) => {
   }
 };
 
+export const getWorkflow = async (token) => {
+  try {
+    const response = await axios.get(`${API_URL}/workflow`, {
+      headers: {
+        'Content-Type': 'application/json',
+        'Authorization': `Bearer ${token}`,
+      },
+    });
+    return response.data;
+  } catch (error) {
+    const errorMessage = error.response?.data?.error || 'Failed to fetch workflow';
+    console.error('Error fetching workflow:', error.response?.data || error.message);
+    throw new Error(errorMessage);
+  }
+};
+
 export const deleteTask = async (id, token) => {
   try {
     const response = await axios.delete(`${API_URL}/tasks/${id}`, {
@@ -1,6 +1,7 @@
 import React, { useState } from 'react';
 import axios from 'axios';
 import { useNavigate } from 'react-router-dom';
+import { saveSession } from '../api/taskService';
 
 function Login({ setToken }) {
   const [username, setUsername] = useState('');
@@ -16,9 +17,8 @@ function Login({ setToken }) {
     }
     try {
       const res = await axios.post('http://localhost:8080/login', { username, password });
-      const token = res.data.token;
-      setToken(token);
-      localStorage.setItem('token', token);
+      saveSession(res.data);
+      setToken(res.data.token);
       setError('');
       navigate('/tasks');
     } catch (err) {
@@ -46,6 +46,9 @@ function Login({ setToken }) {
         />
         <button type="submit">Login</button>
       </form>
+      <p>
+        <a href="http://localhost:8080/auth/oidc/login">Sign in with SSO</a>
+      </p>
       {error && <p style={{ color: 'red' }}>{error}</p>}
     </div>
   );
@@ -0,0 +1,43 @@
+import React, { useEffect, useState } from 'react';
+import { useNavigate } from 'react-router-dom';
+import { saveSession } from '../api/taskService';
+
+const messages = {
+  access_denied: 'Sign-in was cancelled',
+  email_not_verified: 'Your identity provider has not verified your email address',
+  no_account: 'No GoTasker account exists for your email address',
+};
+
+// Receives the tokens the backend puts in the URL fragment after SSO
+function OidcCallback({ setToken }) {
+  const [error, setError] = useState('');
+  const navigate = useNavigate();
+
+  useEffect(() => {
+    const params = new URLSearchParams(window.location.hash.slice(1));
+    window.history.replaceState(null, '', window.location.pathname);
+    if (params.get('token')) {
+      saveSession({
+        token: params.get('token'),
+        refresh_token: params.get('refresh_token'),
+      });
+      setToken(params.get('token'));
+      navigate('/tasks');
+      return;
+    }
+    if (params.get('mfa_required')) {
+      setError('Two-factor authentication is required; sign in with your password and code');
+      return;
+    }
+    setError(messages[params.get('error')] || 'Single sign-on failed');
+  }, [navigate, setToken]);
+
+  return (
+    <div>
+      <h2>Signing in…</h2>
+      {error && <p style={{ color: 'red' }}>{error}</p>}
+    </div>
+  );
+}
+
+export default OidcCallback;
@@ -1,6 +1,7 @@
 import React, { useState } from 'react';
 import axios from 'axios';
 import { useNavigate } from 'react-router-dom';
+import { saveSession } from '../api/taskService';
 
 function Signup({ setToken }) {
   const [username, setUsername] = useState('');
@@ -25,9 +26,8 @@ function Signup({ setToken }) {
     }
     try {
       const res = await axios.post('http://localhost:8080/register', { username, password, email });
-      const token = res.data.token;
-      setToken(token);
-      localStorage.setItem('token', token);
+      saveSession(res.data);
+      setToken(res.data.token);
       setError('');
       navigate('/login');
     } catch (err) {
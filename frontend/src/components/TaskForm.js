@@ -1,34 +1,48 @@
 import React, { useState, useEffect } from 'react';
-import { createTask, updateTask } from '../api/taskService';
+import { createTask, updateTask, getWorkflow } from '../api/taskService';
 
 function TaskForm({ task, onCancel, onSuccess, token }) {
   const [title, setTitle] = useState('');
   const [description, setDescription] = useState('');
-  const [status, setStatus] = useState('Pending');
+  const [status, setStatus] = useState('');
   const [dueDate, setDueDate] = useState('');
+  const [statuses, setStatuses] = useState([]);
   const [error, setError] = useState('');
 
+  useEffect(() => {
+    getWorkflow(token)
+      .then((workflow) => setStatuses(workflow.statuses || []))
+      .catch((err) => console.error('Workflow fetch error:', err));
+  }, [token]);
+
   useEffect(() => {
     if (task) {
       setTitle(task.title || '');
       setDescription(task.description || '');
-      setStatus(task.status || 'Pending');
+      setStatus(task.status || '');
       setDueDate(task.due_date ? new Date(task.due_date).toISOString().slice(0, 16) : '');
     } else {
       setTitle('');
       setDescription('');
-      setStatus('Pending');
+      setStatus('');
       setDueDate('');
     }
   }, [task]);
 
+  // A new task can start in any status; an existing one can stay where it
+  // is or move along one of its status's transitions
+  const current = task && statuses.find((s) => s.name === task.status);
+  const options = current
+    ? statuses.filter((s) => s.name === current.name || current.transitions.includes(s.name))
+    : statuses;
+
   const handleSubmit = async (e) => {
     e.preventDefault();
     if (!title) {
       setError('Title is required');
       return;
     }
-    if (!['Pending', 'In Progress', 'Completed'].includes(status)) {
+    if (status && options.length > 0 && !options.some((s) => s.name === status)) {
       setError('Invalid status');
       return;
     }
@@ -49,7 +63,7 @@ function TaskForm({ task, onCancel, onSuccess, token }) {
       setError('');
       setTitle('');
       setDescription('');
-      setStatus('Pending');
+      setStatus('');
       setDueDate('');
       if (onSuccess) onSuccess();
       if (task && onCancel) onCancel();
@@ -76,10 +90,11 @@ function TaskForm({ task, onCancel, onSuccess, token }) {
           value={description}
           onChange={(e) => setDescription(e.target.value)}
         />
-        <select value={status} onChange={(e) => setStatus(e.target.value)} required>
-          <option value="Pending">Pending</option>
-          <option value="In Progress">In Progress</option>
-          <option value="Completed">Completed</option>
+        <select value={status} onChange={(e) => setStatus(e.target.value)}>
+          {task && !current && <option value={task.status}>{task.status}</option>}
+          {options.map((s) => (
+            <option key={s.id} value={s.name}>{s.name}</option>
+          ))}
         </select>
         <input
           type="datetime-local"